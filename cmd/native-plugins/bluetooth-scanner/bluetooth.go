@@ -12,7 +12,7 @@ import (
 )
 
 type BluetoothScanner struct {
-	eventBus      *events.EventBus
+	eventBus      events.EventBus
 	adapter       *bluetooth.Adapter
 	onStateChange func(state types.State)
 	started       bool
@@ -21,7 +21,7 @@ type BluetoothScanner struct {
 	mu            sync.Mutex
 }
 
-func NewBluetoothScanner(eventBus *events.EventBus, onStateChange func(state types.State)) *BluetoothScanner {
+func NewBluetoothScanner(eventBus events.EventBus, onStateChange func(state types.State)) *BluetoothScanner {
 	adapter := bluetooth.DefaultAdapter
 	err := adapter.Enable()
 	if err != nil {
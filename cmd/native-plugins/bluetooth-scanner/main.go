@@ -22,7 +22,7 @@ func main() {
 	ctx := context.Background()
 	cfg := config.LoadFromEnvPlugin(ctx)
 
-	eventBus, err := events.NewEventBus(cfg.BrokerUrl, p.ID)
+	eventBus, err := events.NewEventBus(events.TransportMQTT, cfg.BrokerConnection, p.ID, plugin.StateWill(p.ID))
 	if err != nil {
 		log.Fatalf("Error setting up event bus : %v", err)
 	}
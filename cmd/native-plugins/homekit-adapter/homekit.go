@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"strings"
+	"sync"
 
 	"github.com/Bastien2203/go-home/shared/events"
 	"github.com/Bastien2203/go-home/shared/types"
@@ -10,13 +12,17 @@ import (
 type HomekitAdapter struct {
 	server  *HomekitServer
 	manager *HomekitManager
+
+	mu      sync.Mutex
+	devices map[string]AccessoryInfo // info of the registered devices, accessories are created on their first data
 }
 
-func NewHomeKitAdapter(eventBus *events.EventBus, onStateChange func(state types.State), homekitDataDir string) (*HomekitAdapter, error) {
+func NewHomeKitAdapter(eventBus events.EventBus, onStateChange func(state types.State), homekitDataDir string) (*HomekitAdapter, error) {
 	server := NewHomekitServer(onStateChange, homekitDataDir)
 	a := &HomekitAdapter{
 		server:  server,
 		manager: NewHomekitManager(server),
+		devices: make(map[string]AccessoryInfo),
 	}
 
 	if err := events.Subscribe(eventBus, events.UpdateDataForAdapter(p.ID), a.onDeviceData); err != nil {
@@ -31,6 +37,10 @@ func NewHomeKitAdapter(eventBus *events.EventBus, onStateChange func(state types
 		return nil, err
 	}
 
+	if err := events.Subscribe(eventBus, events.UpdateDeviceForAdapter(p.ID), a.onDeviceChanged); err != nil {
+		return nil, err
+	}
+
 	return a, nil
 }
 
@@ -51,7 +61,7 @@ func (h *HomekitAdapter) onDeviceData(data types.DeviceStateUpdate) {
 	}
 
 	if !h.manager.AccessoryExists(data.DeviceID) {
-		h.manager.CreateAccessory(data.DeviceName, data.DeviceID, mapping.Type)
+		h.manager.CreateAccessory(data.DeviceID, h.deviceInfo(data.DeviceID, data.DeviceName), mapping.Type)
 		h.manager.CreateService(data.DeviceID, mapping.NewService())
 	}
 
@@ -70,9 +80,45 @@ func (h *HomekitAdapter) onDeviceData(data types.DeviceStateUpdate) {
 }
 
 func (h *HomekitAdapter) onDeviceRegistered(dev types.Device) {
-	// Device auto register when data is received
+	// Device auto register when data is received, only its info is kept
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.devices[dev.ID] = accessoryInfo(dev)
+}
+
+func (h *HomekitAdapter) onDeviceChanged(dev types.Device) {
+	info := accessoryInfo(dev)
+	h.mu.Lock()
+	h.devices[dev.ID] = info
+	h.mu.Unlock()
+
+	h.manager.UpdateAccessoryInfo(dev.ID, info)
 }
 
 func (h *HomekitAdapter) onDeviceUnregistered(dev types.Device) {
+	h.mu.Lock()
+	delete(h.devices, dev.ID)
+	h.mu.Unlock()
+
 	h.manager.RemoveAccessory(dev.ID)
 }
+
+func (h *HomekitAdapter) deviceInfo(id, name string) AccessoryInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	info, ok := h.devices[id]
+	if !ok {
+		return AccessoryInfo{Name: name}
+	}
+	return info
+}
+
+// HomeKit has no room characteristic, the Home app suggests a room when the name starts with one
+func accessoryInfo(dev types.Device) AccessoryInfo {
+	name := dev.Name
+	if dev.Area != "" && !strings.HasPrefix(strings.ToLower(name), strings.ToLower(dev.Area)) {
+		name = dev.Area + " " + name
+	}
+	return AccessoryInfo{Name: name, Manufacturer: dev.Manufacturer, Model: dev.Model}
+}
@@ -24,15 +24,33 @@ func NewHomekitManager(server *HomekitServer) *HomekitManager {
 	}
 }
 
-func (s *HomekitManager) CreateAccessory(name string, id string, accType byte) {
+// Shown in the Home app, the manufacturer and model default to GoHome ones when empty
+type AccessoryInfo struct {
+	Name         string
+	Manufacturer string
+	Model        string
+}
+
+func (i AccessoryInfo) withDefaults() AccessoryInfo {
+	if i.Manufacturer == "" {
+		i.Manufacturer = "GoHome"
+	}
+	if i.Model == "" {
+		i.Model = "Virtual Device"
+	}
+	return i
+}
+
+func (s *HomekitManager) CreateAccessory(id string, info AccessoryInfo, accType byte) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	info = info.withDefaults()
 	accInfo := accessory.Info{
-		Name:         name,
+		Name:         info.Name,
 		SerialNumber: id,
-		Manufacturer: "GoHome",
-		Model:        "Virtual Device",
+		Manufacturer: info.Manufacturer,
+		Model:        info.Model,
 		Firmware:     "1.0.0",
 	}
 
@@ -54,6 +72,22 @@ func (s *HomekitManager) UpdateAccessory(id string, service *service.S) {
 	s.server.ScheduleReload(s.accessories)
 }
 
+// UpdateAccessoryInfo renames an existing accessory, paired controllers are notified of the new values
+func (s *HomekitManager) UpdateAccessoryInfo(id string, info AccessoryInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, exists := s.accessories[id]
+	if !exists {
+		return
+	}
+	info = info.withDefaults()
+	acc.Info.Name.SetValue(info.Name)
+	acc.Info.Manufacturer.SetValue(info.Manufacturer)
+	acc.Info.Model.SetValue(info.Model)
+	log.Printf("[HomeKit] Device renamed : %s", id)
+}
+
 func (s *HomekitManager) GetService(id string, serviceType string) *service.S {
 	s.mu.Lock()
 	defer s.mu.Unlock()
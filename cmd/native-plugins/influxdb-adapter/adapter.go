@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// stopTimeout bounds the last write, the core gives up on a stop that is not acked within 5s
+const stopTimeout = 2 * time.Second
+
+type InfluxAdapter struct {
+	cfg           *InfluxConfig
+	writer        *HttpWriter
+	spool         *Spool
+	onStateChange func(state types.State)
+
+	mu      sync.Mutex
+	running bool
+	buffer  []*Point
+	flushCh chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewInfluxAdapter(eventBus events.EventBus, onStateChange func(state types.State), cfg *InfluxConfig) (*InfluxAdapter, error) {
+	spool, err := NewSpool(cfg.SpoolDir, cfg.SpoolMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &InfluxAdapter{
+		cfg:           cfg,
+		writer:        NewHttpWriter(cfg),
+		spool:         spool,
+		onStateChange: onStateChange,
+	}
+
+	if err := events.Subscribe(eventBus, events.UpdateDataForAdapter(p.ID), a.onDeviceData); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *InfluxAdapter) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running {
+		return fmt.Errorf("influxdb adapter already running")
+	}
+
+	a.running = true
+	a.buffer = make([]*Point, 0, a.cfg.BatchSize)
+	a.flushCh = make(chan struct{}, 1)
+	a.done = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	go a.run(ctx, a.flushCh, a.done)
+
+	a.onStateChange(types.StateRunning)
+	log.Printf("[InfluxDB] Adapter started, writing to %s (%s)", a.cfg.Url, a.cfg.Version)
+	return nil
+}
+
+func (a *InfluxAdapter) Stop() error {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return nil
+	}
+	a.running = false
+	// Interrupts a flush waiting on an unreachable database
+	a.cancel()
+	done := a.done
+	a.mu.Unlock()
+
+	// Wait for the last flush
+	<-done
+
+	a.onStateChange(types.StateStopped)
+	log.Println("[InfluxDB] Adapter stopped")
+	return nil
+}
+
+func (a *InfluxAdapter) onDeviceData(data types.DeviceStateUpdate) {
+	point, ok := NewPoint(a.cfg.Measurement, data)
+	if !ok {
+		log.Printf("[InfluxDB] unsupported value for %s of device %s", data.CapabilityType, data.DeviceID)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.running {
+		return
+	}
+
+	a.buffer = append(a.buffer, point)
+	if len(a.buffer) >= a.cfg.BatchSize {
+		select {
+		case a.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *InfluxAdapter) run(ctx context.Context, flushCh, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.flush(ctx)
+		case <-flushCh:
+			a.flush(ctx)
+		case <-ctx.Done():
+			a.flushOnStop()
+			return
+		}
+	}
+}
+
+func (a *InfluxAdapter) takeBuffer() []*Point {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	points := a.buffer
+	a.buffer = make([]*Point, 0, a.cfg.BatchSize)
+	return points
+}
+
+// Write spooled batches first (oldest data first), then the buffered points.
+// Anything that cannot be written because the database is unreachable ends up in the spool.
+func (a *InfluxAdapter) flush(ctx context.Context) {
+	points := a.takeBuffer()
+
+	reachable := a.drainSpool(ctx)
+
+	if len(points) == 0 {
+		return
+	}
+	batch := EncodeBatch(points)
+
+	if reachable {
+		err := a.writeWithRetry(ctx, batch)
+		if err == nil {
+			return
+		}
+		var writeErr *WriteError
+		if !errors.As(err, &writeErr) || !writeErr.Retryable() {
+			log.Printf("[InfluxDB] dropping batch of %d points: %v", len(points), err)
+			return
+		}
+		log.Printf("[InfluxDB] database unreachable, spooling %d points: %v", len(points), err)
+	}
+
+	if err := a.spool.Push(batch); err != nil {
+		log.Printf("[InfluxDB] failed to spool batch of %d points: %v", len(points), err)
+	}
+}
+
+// flushOnStop writes the buffer once, without replaying the spool nor retrying, so the stop is acked in time.
+// The points are spooled when the database does not take them.
+func (a *InfluxAdapter) flushOnStop() {
+	points := a.takeBuffer()
+	if len(points) == 0 {
+		return
+	}
+	batch := EncodeBatch(points)
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	err := a.writer.Write(ctx, batch)
+	if err == nil {
+		return
+	}
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || !writeErr.Retryable() {
+		log.Printf("[InfluxDB] dropping batch of %d points: %v", len(points), err)
+		return
+	}
+	log.Printf("[InfluxDB] database unreachable on stop, spooling %d points: %v", len(points), err)
+	if err := a.spool.Push(batch); err != nil {
+		log.Printf("[InfluxDB] failed to spool batch of %d points: %v", len(points), err)
+	}
+}
+
+// Returns false if the database is still unreachable
+func (a *InfluxAdapter) drainSpool(ctx context.Context) bool {
+	files, err := a.spool.Files()
+	if err != nil {
+		log.Printf("[InfluxDB] failed to list spool: %v", err)
+		return true
+	}
+
+	for _, file := range files {
+		batch, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("[InfluxDB] failed to read spooled batch %s: %v", file, err)
+			continue
+		}
+
+		if err := a.write(ctx, batch); err != nil {
+			var writeErr *WriteError
+			if errors.As(err, &writeErr) && writeErr.Retryable() {
+				return false
+			}
+			log.Printf("[InfluxDB] dropping spooled batch %s: %v", file, err)
+		}
+
+		if err := a.spool.Remove(file); err != nil {
+			log.Printf("[InfluxDB] failed to remove spooled batch %s: %v", file, err)
+		}
+	}
+	return true
+}
+
+func (a *InfluxAdapter) writeWithRetry(ctx context.Context, batch []byte) error {
+	delay := a.cfg.RetryDelay
+	var err error
+	for attempt := 0; attempt <= a.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				// The last error is retryable, the batch is spooled
+				return err
+			}
+			delay *= 2
+		}
+
+		err = a.write(ctx, batch)
+		var writeErr *WriteError
+		if err == nil || !errors.As(err, &writeErr) || !writeErr.Retryable() {
+			return err
+		}
+	}
+	return err
+}
+
+func (a *InfluxAdapter) write(ctx context.Context, batch []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.Timeout)
+	defer cancel()
+	return a.writer.Write(ctx, batch)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func newTestAdapter(t *testing.T, cfg *InfluxConfig) *InfluxAdapter {
+	spool, err := NewSpool(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("Failed to create spool %v", err)
+	}
+	return &InfluxAdapter{
+		cfg:           cfg,
+		writer:        NewHttpWriter(cfg),
+		spool:         spool,
+		onStateChange: func(types.State) {},
+	}
+}
+
+func testConfig(url string, version InfluxVersion) *InfluxConfig {
+	return &InfluxConfig{
+		Url:           url,
+		Version:       version,
+		Database:      "gohome",
+		Org:           "home",
+		Bucket:        "sensors",
+		Token:         "secret",
+		Measurement:   "gohome",
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+		MaxRetries:    0,
+		Timeout:       time.Second,
+	}
+}
+
+func testUpdate(value float64) types.DeviceStateUpdate {
+	return types.DeviceStateUpdate{
+		DeviceID:       "dev-1",
+		DeviceName:     "Sensor",
+		CapabilityType: types.CapabilityTemperature,
+		Timestamp:      time.Now(),
+		Value:          value,
+	}
+}
+
+func TestWriteV2(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "sensors" || r.URL.Query().Get("org") != "home" {
+			t.Errorf("Unexpected write url %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Unexpected authorization header %s", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	a := newTestAdapter(t, testConfig(server.URL, InfluxV2))
+	if err := a.Start(); err != nil {
+		t.Fatalf("Failed to start adapter %v", err)
+	}
+	a.onDeviceData(testUpdate(20))
+	a.onDeviceData(testUpdate(21))
+	a.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 2 {
+		t.Fatalf("Expected one batch of 2 points, got %q", bodies)
+	}
+}
+
+func TestWriteV1(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/write" || r.URL.Query().Get("db") != "gohome" || user != "admin" || pass != "pass" {
+			t.Errorf("Unexpected v1 write request %s", r.URL)
+		}
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := testConfig(server.URL, InfluxV1)
+	cfg.Username = "admin"
+	cfg.Password = "pass"
+	a := newTestAdapter(t, cfg)
+	a.Start()
+	a.onDeviceData(testUpdate(20))
+	a.Stop()
+
+	if calls.Load() != 1 {
+		t.Fatalf("Expected 1 write, got %d", calls.Load())
+	}
+}
+
+func TestSpoolWhenUnreachable(t *testing.T) {
+	var available atomic.Bool
+	var points atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		points.Add(int32(strings.Count(string(body), "\n")))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	a := newTestAdapter(t, testConfig(server.URL, InfluxV2))
+	a.running = true
+	a.buffer = []*Point{}
+
+	a.onDeviceData(testUpdate(20))
+	a.flush(context.Background())
+
+	files, _ := a.spool.Files()
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 spooled batch, got %d", len(files))
+	}
+
+	available.Store(true)
+	a.onDeviceData(testUpdate(21))
+	a.flush(context.Background())
+
+	files, _ = a.spool.Files()
+	if len(files) != 0 || points.Load() != 2 {
+		t.Fatalf("Expected spool to be drained, got %d files and %d points written", len(files), points.Load())
+	}
+}
+
+func TestRejectedBatchIsNotSpooled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad line protocol", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	a := newTestAdapter(t, testConfig(server.URL, InfluxV2))
+	a.running = true
+	a.onDeviceData(testUpdate(20))
+	a.flush(context.Background())
+
+	if files, _ := a.spool.Files(); len(files) != 0 {
+		t.Fatalf("Expected rejected batch to be dropped, got %d spooled", len(files))
+	}
+}
+
+// The core waits 5s for the ack of a stop, retries on an unreachable database would outlast it
+func TestStopWhenUnreachable(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := testConfig(server.URL, InfluxV2)
+	cfg.BatchSize = 1
+	cfg.MaxRetries = 3
+	cfg.RetryDelay = time.Second
+	cfg.Timeout = 10 * time.Second
+	a := newTestAdapter(t, cfg)
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first point is being written when the adapter stops, the second one is still buffered
+	a.onDeviceData(testUpdate(20))
+	time.Sleep(100 * time.Millisecond)
+	a.onDeviceData(testUpdate(21))
+
+	start := time.Now()
+	if err := a.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > stopTimeout+time.Second {
+		t.Fatalf("Stop took %s", elapsed)
+	}
+	if files, _ := a.spool.Files(); len(files) != 2 {
+		t.Fatalf("Expected both batches to be spooled, got %d", len(files))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type InfluxVersion string
+
+const (
+	InfluxV1 InfluxVersion = "v1"
+	InfluxV2 InfluxVersion = "v2"
+)
+
+type InfluxConfig struct {
+	Url     string        `env:"INFLUX_URL,required"`
+	Version InfluxVersion `env:"INFLUX_VERSION,default=v2"`
+
+	// v1 write api
+	Database        string `env:"INFLUX_DATABASE,default=gohome"`
+	RetentionPolicy string `env:"INFLUX_RETENTION_POLICY"`
+	Username        string `env:"INFLUX_USERNAME"`
+	Password        string `env:"INFLUX_PASSWORD"`
+
+	// v2 write api
+	Org    string `env:"INFLUX_ORG"`
+	Bucket string `env:"INFLUX_BUCKET,default=gohome"`
+	Token  string `env:"INFLUX_TOKEN"`
+
+	// Placeholders : {capability}, {device_id}, {device_name}, {unit}
+	Measurement string `env:"INFLUX_MEASUREMENT,default=gohome"`
+
+	BatchSize     int           `env:"INFLUX_BATCH_SIZE,default=500"`
+	FlushInterval time.Duration `env:"INFLUX_FLUSH_INTERVAL,default=10s"`
+	MaxRetries    int           `env:"INFLUX_MAX_RETRIES,default=3"`
+	RetryDelay    time.Duration `env:"INFLUX_RETRY_DELAY,default=1s"`
+	Timeout       time.Duration `env:"INFLUX_TIMEOUT,default=10s"`
+
+	SpoolDir      string `env:"INFLUX_SPOOL_DIR,default=./influx_spool"`
+	SpoolMaxFiles int    `env:"INFLUX_SPOOL_MAX_FILES,default=1000"`
+}
+
+// .env file is already loaded by config.LoadFromEnvPlugin
+func LoadInfluxConfig(ctx context.Context) *InfluxConfig {
+	cfg := &InfluxConfig{}
+	if err := envconfig.Process(ctx, cfg); err != nil {
+		log.Fatalf("%+v\n", err)
+	}
+	if cfg.Version != InfluxV1 && cfg.Version != InfluxV2 {
+		log.Fatalf("invalid INFLUX_VERSION %q, expected v1 or v2", cfg.Version)
+	}
+	return cfg
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	Time        time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	stringFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Build the point stored for a device state update, returns false if the value cannot be stored
+func NewPoint(measurementTemplate string, update types.DeviceStateUpdate) (*Point, bool) {
+	value, ok := fieldValue(update.Value)
+	if !ok {
+		return nil, false
+	}
+
+	tags := map[string]string{
+		"device_id":   update.DeviceID,
+		"device_name": update.DeviceName,
+		"capability":  string(update.CapabilityType),
+	}
+	if update.Unit != types.NoUnit {
+		tags["unit"] = string(update.Unit)
+	}
+
+	measurement := strings.NewReplacer(
+		"{capability}", string(update.CapabilityType),
+		"{device_id}", update.DeviceID,
+		"{device_name}", update.DeviceName,
+		"{unit}", string(update.Unit),
+	).Replace(measurementTemplate)
+
+	return &Point{
+		Measurement: measurement,
+		Tags:        tags,
+		Fields:      map[string]any{"value": value},
+		Time:        update.Timestamp,
+	}, true
+}
+
+// Values are decoded from json, so numbers are float64
+func fieldValue(v any) (any, bool) {
+	switch val := v.(type) {
+	case float64, float32, int, int64, bool:
+		return val, true
+	case string:
+		return val, val != ""
+	default:
+		return nil, false
+	}
+}
+
+// Encode the point in influxdb line protocol (without trailing newline)
+func (p *Point) String() string {
+	var sb strings.Builder
+	sb.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	tagKeys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		// Empty tag values are not allowed
+		if v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		sb.WriteByte(',')
+		sb.WriteString(tagEscaper.Replace(k))
+		sb.WriteByte('=')
+		sb.WriteString(tagEscaper.Replace(p.Tags[k]))
+	}
+
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i == 0 {
+			sb.WriteByte(' ')
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(tagEscaper.Replace(k))
+		sb.WriteByte('=')
+		sb.WriteString(formatField(p.Fields[k]))
+	}
+
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+	return sb.String()
+}
+
+func formatField(v any) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(val) + "i"
+	case int64:
+		return strconv.FormatInt(val, 10) + "i"
+	case bool:
+		return strconv.FormatBool(val)
+	case string:
+		return `"` + stringFieldEscaper.Replace(val) + `"`
+	default:
+		return `"` + stringFieldEscaper.Replace(fmt.Sprint(val)) + `"`
+	}
+}
+
+func EncodeBatch(points []*Point) []byte {
+	var sb strings.Builder
+	for _, p := range points {
+		sb.WriteString(p.String())
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String())
+}
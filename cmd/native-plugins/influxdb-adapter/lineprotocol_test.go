@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func TestPointString(t *testing.T) {
+	point, ok := NewPoint("gohome", types.DeviceStateUpdate{
+		DeviceID:       "dev-1",
+		DeviceName:     "Living room, north",
+		CapabilityType: types.CapabilityTemperature,
+		Timestamp:      time.Unix(0, 1700000000000000000),
+		Value:          21.5,
+		Unit:           types.UnitCelsius,
+	})
+	if !ok {
+		t.Fatalf("Failed to create point")
+	}
+
+	expected := `gohome,capability=temperature,device_id=dev-1,device_name=Living\ room\,\ north,unit=celsius value=21.5 1700000000000000000`
+	if point.String() != expected {
+		t.Fatalf("Unexpected line protocol\n got: %s\nwant: %s", point.String(), expected)
+	}
+}
+
+func TestPointMeasurementTemplate(t *testing.T) {
+	point, ok := NewPoint("{capability}", types.DeviceStateUpdate{
+		DeviceID:       "dev-1",
+		DeviceName:     "Button",
+		CapabilityType: types.CapabilityButtonEvent,
+		Timestamp:      time.Unix(1, 0),
+		Value:          `long "press"`,
+	})
+	if !ok {
+		t.Fatalf("Failed to create point")
+	}
+
+	expected := `button_event,capability=button_event,device_id=dev-1,device_name=Button value="long \"press\"" 1000000000`
+	if point.String() != expected {
+		t.Fatalf("Unexpected line protocol\n got: %s\nwant: %s", point.String(), expected)
+	}
+}
+
+func TestPointUnsupportedValue(t *testing.T) {
+	if _, ok := NewPoint("gohome", types.DeviceStateUpdate{Value: nil}); ok {
+		t.Fatalf("Expected nil value to be rejected")
+	}
+}
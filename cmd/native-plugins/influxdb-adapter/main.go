@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"log"
+
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+var p = &plugin.Plugin{
+	ID:    "influxdb-adapter",
+	Name:  "InfluxDB",
+	Type:  plugin.PluginAdapter,
+	State: types.StateStopped,
+}
+
+func main() {
+	ctx := context.Background()
+	cfg := config.LoadFromEnvPlugin(ctx)
+	influxCfg := LoadInfluxConfig(ctx)
+
+	eventBus, err := events.NewEventBus(events.TransportMQTT, cfg.BrokerConnection, p.ID, plugin.StateWill(p.ID))
+	if err != nil {
+		log.Fatalf("Error setting up event bus : %v", err)
+	}
+
+	client := plugin.NewPluginClient(p, eventBus)
+	adapter, err := NewInfluxAdapter(eventBus, client.EmitNewState, influxCfg)
+	if err != nil {
+		log.Fatalf("Error creating influxdb adapter : %v", err)
+	}
+	client.RunPlugin(adapter.Start, adapter.Stop)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const spoolExt = ".lp"
+
+// Spool keeps batches that could not be written on disk, one file per batch
+type Spool struct {
+	dir      string
+	maxFiles int
+}
+
+func NewSpool(dir string, maxFiles int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	return &Spool{dir: dir, maxFiles: maxFiles}, nil
+}
+
+func (s *Spool) Push(batch []byte) error {
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolExt))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, batch, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return s.trim()
+}
+
+// Spooled files ordered from oldest to newest
+func (s *Spool) Files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolExt) {
+			files = append(files, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *Spool) Remove(file string) error {
+	return os.Remove(file)
+}
+
+// Drop oldest batches when the spool is full
+func (s *Spool) trim() error {
+	if s.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		return err
+	}
+
+	for len(files) > s.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
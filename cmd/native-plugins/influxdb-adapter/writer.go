@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type WriteError struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *WriteError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("influxdb write failed: %v", e.Err)
+	}
+	return fmt.Sprintf("influxdb write failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Database unreachable, overloaded or failing : the batch can be written later.
+// Other 4xx mean the batch itself is rejected and would be rejected again.
+func (e *WriteError) Retryable() bool {
+	return e.Err != nil || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Writes line protocol batches through the v1 (/write) or v2 (/api/v2/write) http api
+type HttpWriter struct {
+	cfg    *InfluxConfig
+	client *http.Client
+}
+
+func NewHttpWriter(cfg *InfluxConfig) *HttpWriter {
+	return &HttpWriter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (w *HttpWriter) writeURL() (string, error) {
+	base, err := url.Parse(w.cfg.Url)
+	if err != nil {
+		return "", fmt.Errorf("invalid influxdb url: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("precision", "ns")
+
+	switch w.cfg.Version {
+	case InfluxV1:
+		base = base.JoinPath("write")
+		query.Set("db", w.cfg.Database)
+		if w.cfg.RetentionPolicy != "" {
+			query.Set("rp", w.cfg.RetentionPolicy)
+		}
+	default:
+		base = base.JoinPath("api", "v2", "write")
+		query.Set("org", w.cfg.Org)
+		query.Set("bucket", w.cfg.Bucket)
+	}
+
+	base.RawQuery = query.Encode()
+	return base.String(), nil
+}
+
+func (w *HttpWriter) Write(ctx context.Context, body []byte) error {
+	writeURL, err := w.writeURL()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	switch w.cfg.Version {
+	case InfluxV1:
+		if w.cfg.Username != "" {
+			req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+		}
+	default:
+		if w.cfg.Token != "" {
+			req.Header.Set("Authorization", "Token "+w.cfg.Token)
+		}
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &WriteError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &WriteError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type bridgedDevice struct {
+	info      DeviceInfo
+	announced map[types.CapabilityType]string // capability -> discovery topic
+	units     map[types.CapabilityType]types.Unit
+	lastSeen  time.Time
+	available bool
+}
+
+type MqttAdapter struct {
+	bridge        *Bridge
+	topics        Topics
+	onStateChange func(state types.State)
+	deviceTimeout time.Duration
+
+	mu        sync.Mutex
+	running   bool
+	devices   map[string]*bridgedDevice
+	stopWatch chan struct{}
+}
+
+func NewMqttAdapter(eventBus events.EventBus, onStateChange func(state types.State), cfg *BridgeConfig) (*MqttAdapter, error) {
+	topics := NewTopics(cfg.TopicPrefix, cfg.DiscoveryPrefix)
+	a := &MqttAdapter{
+		topics:        topics,
+		onStateChange: onStateChange,
+		deviceTimeout: cfg.DeviceTimeout,
+		devices:       make(map[string]*bridgedDevice),
+	}
+	a.bridge = NewBridge(cfg, topics, a.onHomeAssistantOnline)
+
+	if err := events.Subscribe(eventBus, events.UpdateDataForAdapter(p.ID), a.onDeviceData); err != nil {
+		return nil, err
+	}
+
+	if err := events.Subscribe(eventBus, events.RegisterDeviceForAdapter(p.ID), a.onDeviceRegistered); err != nil {
+		return nil, err
+	}
+
+	if err := events.Subscribe(eventBus, events.UnregisterDeviceForAdapter(p.ID), a.onDeviceUnregistered); err != nil {
+		return nil, err
+	}
+
+	if err := events.Subscribe(eventBus, events.UpdateDeviceForAdapter(p.ID), a.onDeviceChanged); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *MqttAdapter) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running {
+		return fmt.Errorf("mqtt adapter already running")
+	}
+
+	if err := a.bridge.Connect(); err != nil {
+		return err
+	}
+	a.running = true
+
+	for id, dev := range a.devices {
+		a.announceDevice(id, dev)
+	}
+
+	if a.deviceTimeout > 0 {
+		a.stopWatch = make(chan struct{})
+		go a.watchAvailability(a.stopWatch)
+	}
+
+	a.onStateChange(types.StateRunning)
+	log.Println("[MQTT Bridge] Adapter started")
+	return nil
+}
+
+func (a *MqttAdapter) Stop() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.running {
+		return nil
+	}
+
+	if a.stopWatch != nil {
+		close(a.stopWatch)
+		a.stopWatch = nil
+	}
+	a.bridge.Disconnect()
+	a.running = false
+
+	a.onStateChange(types.StateStopped)
+	log.Println("[MQTT Bridge] Adapter stopped")
+	return nil
+}
+
+func (a *MqttAdapter) onDeviceData(data types.DeviceStateUpdate) {
+	if _, supported := CapabilityRegistry[data.CapabilityType]; !supported {
+		log.Printf("capability %s not supported", data.CapabilityType)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dev := a.getOrCreateDevice(data.DeviceID, data.DeviceName)
+	dev.lastSeen = data.Timestamp
+	if data.Unit != types.NoUnit {
+		dev.units[data.CapabilityType] = data.Unit
+	}
+
+	if !a.running {
+		return
+	}
+
+	if _, ok := dev.announced[data.CapabilityType]; !ok {
+		a.announceCapability(data.DeviceID, dev, data.CapabilityType)
+	}
+
+	payload, err := StatePayload(data.CapabilityType, data.Value)
+	if err != nil {
+		log.Printf("[MQTT Bridge] invalid value for device %s: %v", data.DeviceID, err)
+		return
+	}
+
+	// Events are not retained, otherwise home assistant would replay the last press on restart
+	retained := CapabilityRegistry[data.CapabilityType].Component != ComponentEvent
+	if err := a.bridge.Publish(a.topics.State(data.DeviceID, data.CapabilityType), payload, retained); err != nil {
+		log.Printf("[MQTT Bridge] failed to publish state for device %s: %v", data.DeviceID, err)
+		return
+	}
+
+	if !dev.available {
+		a.setAvailability(data.DeviceID, dev, true)
+	}
+}
+
+func (a *MqttAdapter) onDeviceRegistered(device types.Device) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dev := a.getOrCreateDevice(device.ID, device.Name)
+	dev.info = deviceInfo(device)
+	for name, c := range device.Capabilities {
+		if _, supported := CapabilityRegistry[name]; !supported {
+			continue
+		}
+		if c != nil && c.Unit != types.NoUnit {
+			dev.units[name] = c.Unit
+		}
+		if _, ok := dev.announced[name]; !ok {
+			dev.announced[name] = ""
+		}
+	}
+
+	if a.running {
+		a.announceDevice(device.ID, dev)
+	}
+}
+
+// Discovery configs are retained, announcing them again updates the device in home assistant
+func (a *MqttAdapter) onDeviceChanged(device types.Device) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dev, ok := a.devices[device.ID]
+	if !ok {
+		return
+	}
+	dev.info = deviceInfo(device)
+
+	if a.running {
+		a.announceDevice(device.ID, dev)
+	}
+}
+
+func (a *MqttAdapter) onDeviceUnregistered(device types.Device) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dev, ok := a.devices[device.ID]
+	if !ok {
+		return
+	}
+	delete(a.devices, device.ID)
+
+	if !a.running {
+		return
+	}
+
+	// An empty retained payload removes the entity from home assistant
+	for capability, topic := range dev.announced {
+		if topic != "" {
+			a.publishOrLog(topic, []byte{}, true)
+		}
+		a.publishOrLog(a.topics.State(device.ID, capability), []byte{}, true)
+	}
+	a.publishOrLog(a.topics.DeviceAvailability(device.ID), []byte{}, true)
+	log.Printf("[MQTT Bridge] Device unregistered : %s", device.ID)
+}
+
+// Home Assistant lost its retained discovery state (or never had it), announce everything again
+func (a *MqttAdapter) onHomeAssistantOnline() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.running {
+		return
+	}
+
+	for id, dev := range a.devices {
+		a.announceDevice(id, dev)
+	}
+}
+
+func (a *MqttAdapter) watchAvailability(stop chan struct{}) {
+	ticker := time.NewTicker(a.deviceTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			a.mu.Lock()
+			for id, dev := range a.devices {
+				if dev.available && now.Sub(dev.lastSeen) > a.deviceTimeout {
+					a.setAvailability(id, dev, false)
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// --- Helpers, must be called with a.mu held ---
+
+func (a *MqttAdapter) getOrCreateDevice(id, name string) *bridgedDevice {
+	dev, ok := a.devices[id]
+	if !ok {
+		dev = &bridgedDevice{
+			info:      DeviceInfo{Name: name},
+			announced: make(map[types.CapabilityType]string),
+			units:     make(map[types.CapabilityType]types.Unit),
+		}
+		a.devices[id] = dev
+	}
+	return dev
+}
+
+func (a *MqttAdapter) announceDevice(id string, dev *bridgedDevice) {
+	for capability := range dev.announced {
+		a.announceCapability(id, dev, capability)
+	}
+	a.publishOrLog(a.topics.DeviceAvailability(id), []byte(availabilityPayload(dev.available)), true)
+}
+
+func (a *MqttAdapter) announceCapability(id string, dev *bridgedDevice, capability types.CapabilityType) {
+	topic, cfg, err := NewDiscoveryConfig(a.topics, id, dev.info, &types.Capability{
+		Name: capability,
+		Unit: dev.units[capability],
+	})
+	if err != nil {
+		log.Printf("[MQTT Bridge] %v", err)
+		return
+	}
+
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		log.Printf("[MQTT Bridge] failed to marshal discovery config: %v", err)
+		return
+	}
+
+	if err := a.bridge.Publish(topic, payload, true); err != nil {
+		log.Printf("[MQTT Bridge] failed to announce %s for device %s: %v", capability, id, err)
+		return
+	}
+	dev.announced[capability] = topic
+}
+
+func (a *MqttAdapter) setAvailability(id string, dev *bridgedDevice, available bool) {
+	if err := a.bridge.Publish(a.topics.DeviceAvailability(id), []byte(availabilityPayload(available)), true); err != nil {
+		log.Printf("[MQTT Bridge] failed to publish availability for device %s: %v", id, err)
+		return
+	}
+	dev.available = available
+}
+
+func (a *MqttAdapter) publishOrLog(topic string, payload []byte, retained bool) {
+	if err := a.bridge.Publish(topic, payload, retained); err != nil {
+		log.Printf("[MQTT Bridge] failed to publish on %s: %v", topic, err)
+	}
+}
+
+func deviceInfo(device types.Device) DeviceInfo {
+	return DeviceInfo{Name: device.Name, Manufacturer: device.Manufacturer, Model: device.Model, Area: device.Area}
+}
+
+func availabilityPayload(available bool) string {
+	if available {
+		return PayloadOnline
+	}
+	return PayloadOffline
+}
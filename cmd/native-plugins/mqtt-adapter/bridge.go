@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const publishTimeout = 5 * time.Second
+
+// Bridge is the connection to the external broker (not the gohome event bus)
+type Bridge struct {
+	cfg                   *BridgeConfig
+	topics                Topics
+	client                mqtt.Client
+	onHomeAssistantOnline func()
+}
+
+func NewBridge(cfg *BridgeConfig, topics Topics, onHomeAssistantOnline func()) *Bridge {
+	return &Bridge{
+		cfg:                   cfg,
+		topics:                topics,
+		onHomeAssistantOnline: onHomeAssistantOnline,
+	}
+}
+
+func (b *Bridge) Connect() error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(b.cfg.BrokerUrl)
+	opts.SetClientID(b.cfg.ClientID)
+	opts.SetUsername(b.cfg.Username)
+	opts.SetPassword(b.cfg.Password)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetAutoReconnect(true)
+	// Broker marks every entity unavailable if we disappear without saying goodbye
+	opts.SetWill(b.topics.BridgeAvailability(), PayloadOffline, 1, true)
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		log.Println("[MQTT Bridge] connected to the external broker")
+		c.Publish(b.topics.BridgeAvailability(), 1, true, PayloadOnline)
+		c.Subscribe(b.topics.HomeAssistantStatus(), 1, func(_ mqtt.Client, msg mqtt.Message) {
+			if string(msg.Payload()) == PayloadOnline && b.onHomeAssistantOnline != nil {
+				go b.onHomeAssistantOnline()
+			}
+		})
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Printf("[MQTT Bridge] connection to the external broker lost: %v", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect to %s: %w", b.cfg.BrokerUrl, token.Error())
+	}
+	b.client = client
+	return nil
+}
+
+func (b *Bridge) Disconnect() {
+	if b.client == nil {
+		return
+	}
+	b.Publish(b.topics.BridgeAvailability(), []byte(PayloadOffline), true)
+	b.client.Disconnect(250)
+	b.client = nil
+}
+
+func (b *Bridge) Publish(topic string, payload []byte, retained bool) error {
+	if b.client == nil {
+		return fmt.Errorf("bridge not connected")
+	}
+
+	token := b.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timeout publishing on %s", topic)
+	}
+	return token.Error()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// Configuration of the external broker devices are republished to
+type BridgeConfig struct {
+	BrokerUrl       string        `env:"MQTT_BRIDGE_URL,required"`
+	Username        string        `env:"MQTT_BRIDGE_USERNAME"`
+	Password        string        `env:"MQTT_BRIDGE_PASSWORD"`
+	ClientID        string        `env:"MQTT_BRIDGE_CLIENT_ID,default=gohome-bridge"`
+	TopicPrefix     string        `env:"MQTT_BRIDGE_TOPIC_PREFIX,default=gohome"`
+	DiscoveryPrefix string        `env:"MQTT_BRIDGE_DISCOVERY_PREFIX,default=homeassistant"`
+	DeviceTimeout   time.Duration `env:"MQTT_BRIDGE_DEVICE_TIMEOUT,default=30m"`
+}
+
+// .env file is already loaded by config.LoadFromEnvPlugin
+func LoadBridgeConfig(ctx context.Context) *BridgeConfig {
+	cfg := &BridgeConfig{}
+	if err := envconfig.Process(ctx, cfg); err != nil {
+		log.Fatalf("%+v\n", err)
+	}
+	return cfg
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+const (
+	ComponentSensor = "sensor"
+	ComponentEvent  = "event"
+)
+
+// Define how gohome capability become home assistant entity
+type EntityDef struct {
+	Component      string
+	Name           string
+	DeviceClass    string
+	StateClass     string
+	EntityCategory string
+	DefaultUnit    types.Unit
+	EventTypes     []string
+}
+
+var CapabilityRegistry = map[types.CapabilityType]EntityDef{
+	types.CapabilityTemperature: {
+		Component:   ComponentSensor,
+		Name:        "Temperature",
+		DeviceClass: "temperature",
+		StateClass:  "measurement",
+		DefaultUnit: types.UnitCelsius,
+	},
+	types.CapabilityHumidity: {
+		Component:   ComponentSensor,
+		Name:        "Humidity",
+		DeviceClass: "humidity",
+		StateClass:  "measurement",
+		DefaultUnit: types.UnitPercent,
+	},
+	types.CapabilityBattery: {
+		Component:      ComponentSensor,
+		Name:           "Battery",
+		DeviceClass:    "battery",
+		StateClass:     "measurement",
+		EntityCategory: "diagnostic",
+		DefaultUnit:    types.UnitPercent,
+	},
+	types.CapabilityButtonEvent: {
+		Component:   ComponentEvent,
+		Name:        "Button",
+		DeviceClass: "button",
+		EventTypes:  []string{"press", "double_press", "triple_press", "long_press", "long_double_press", "long_triple_press"},
+	},
+}
+
+func UnitToHomeAssistant(u types.Unit) string {
+	switch u {
+	case types.UnitCelsius:
+		return "°C"
+	case types.UnitPercent:
+		return "%"
+	case types.UnitVolt:
+		return "V"
+	default:
+		return ""
+	}
+}
+
+type Availability struct {
+	Topic string `json:"topic"`
+}
+
+type DiscoveryDevice struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer"`
+	Model         string   `json:"model"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+// Payload of homeassistant/<component>/<node_id>/<object_id>/config
+type DiscoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	EntityCategory    string          `json:"entity_category,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	EventTypes        []string        `json:"event_types,omitempty"`
+	Availability      []Availability  `json:"availability"`
+	AvailabilityMode  string          `json:"availability_mode"`
+	Device            DiscoveryDevice `json:"device"`
+}
+
+// Device as shown in home assistant, the manufacturer and model default to GoHome ones when empty
+type DeviceInfo struct {
+	Name         string
+	Manufacturer string
+	Model        string
+	Area         string // suggested to Home Assistant, only used when the device is first discovered
+}
+
+// Returns the discovery topic and config announcing the capability of a device
+func NewDiscoveryConfig(topics Topics, deviceID string, info DeviceInfo, c *types.Capability) (string, *DiscoveryConfig, error) {
+	def, supported := CapabilityRegistry[c.Name]
+	if !supported {
+		return "", nil, fmt.Errorf("capability %s not supported", c.Name)
+	}
+
+	unit := c.Unit
+	if unit == types.NoUnit {
+		unit = def.DefaultUnit
+	}
+
+	if info.Manufacturer == "" {
+		info.Manufacturer = "GoHome"
+	}
+	if info.Model == "" {
+		info.Model = "Virtual Device"
+	}
+
+	cfg := &DiscoveryConfig{
+		Name:              def.Name,
+		UniqueID:          fmt.Sprintf("gohome_%s_%s", deviceID, c.Name),
+		StateTopic:        topics.State(deviceID, c.Name),
+		DeviceClass:       def.DeviceClass,
+		StateClass:        def.StateClass,
+		EntityCategory:    def.EntityCategory,
+		UnitOfMeasurement: UnitToHomeAssistant(unit),
+		EventTypes:        def.EventTypes,
+		Availability: []Availability{
+			{Topic: topics.BridgeAvailability()},
+			{Topic: topics.DeviceAvailability(deviceID)},
+		},
+		AvailabilityMode: "all",
+		Device: DiscoveryDevice{
+			Identifiers:   []string{fmt.Sprintf("gohome_%s", deviceID)},
+			Name:          info.Name,
+			Manufacturer:  info.Manufacturer,
+			Model:         info.Model,
+			SuggestedArea: info.Area,
+		},
+	}
+
+	return topics.Discovery(def.Component, deviceID, c.Name), cfg, nil
+}
+
+// Encode a capability value the way home assistant expects it on the state topic
+func StatePayload(capability types.CapabilityType, value any) ([]byte, error) {
+	def, supported := CapabilityRegistry[capability]
+	if !supported {
+		return nil, fmt.Errorf("capability %s not supported", capability)
+	}
+
+	if def.Component == ComponentEvent {
+		eventType, ok := value.(string)
+		if !ok || eventType == "" {
+			eventType = "press"
+		}
+		return json.Marshal(map[string]string{"event_type": eventType})
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, fmt.Errorf("empty value for capability %s", capability)
+	default:
+		return json.Marshal(v)
+	}
+}
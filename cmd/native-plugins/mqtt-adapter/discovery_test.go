@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestTemperatureDiscoveryConfig(t *testing.T) {
+	topics := NewTopics("gohome", "homeassistant")
+
+	topic, cfg, err := NewDiscoveryConfig(topics, "dev-1", DeviceInfo{Name: "Thermometer", Area: "Living room"}, &types.Capability{
+		Name: types.CapabilityTemperature,
+		Unit: types.UnitCelsius,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build discovery config %v", err)
+	}
+
+	if topic != "homeassistant/sensor/dev-1/temperature/config" {
+		t.Fatalf("Unexpected discovery topic %s", topic)
+	}
+	if cfg.DeviceClass != "temperature" || cfg.StateClass != "measurement" || cfg.UnitOfMeasurement != "°C" {
+		t.Fatalf("Unexpected discovery config %+v", cfg)
+	}
+	if cfg.StateTopic != "gohome/dev-1/temperature" {
+		t.Fatalf("Unexpected state topic %s", cfg.StateTopic)
+	}
+	if len(cfg.Availability) != 2 || cfg.AvailabilityMode != "all" {
+		t.Fatalf("Unexpected availability %+v", cfg.Availability)
+	}
+	if cfg.Device.SuggestedArea != "Living room" {
+		t.Fatalf("Unexpected suggested area %s", cfg.Device.SuggestedArea)
+	}
+}
+
+func TestDiscoveryConfigDefaultUnit(t *testing.T) {
+	topics := NewTopics("gohome", "homeassistant")
+
+	_, cfg, err := NewDiscoveryConfig(topics, "dev-1", DeviceInfo{Name: "Sensor"}, &types.Capability{Name: types.CapabilityBattery})
+	if err != nil {
+		t.Fatalf("Failed to build discovery config %v", err)
+	}
+	if cfg.UnitOfMeasurement != "%" || cfg.EntityCategory != "diagnostic" {
+		t.Fatalf("Unexpected discovery config %+v", cfg)
+	}
+}
+
+func TestUnsupportedCapability(t *testing.T) {
+	topics := NewTopics("gohome", "homeassistant")
+
+	if _, _, err := NewDiscoveryConfig(topics, "dev-1", DeviceInfo{Name: "Sensor"}, &types.Capability{Name: "unknown"}); err == nil {
+		t.Fatalf("Expected error for unsupported capability")
+	}
+}
+
+func TestStatePayload(t *testing.T) {
+	payload, err := StatePayload(types.CapabilityTemperature, 21.5)
+	if err != nil || string(payload) != "21.5" {
+		t.Fatalf("Unexpected temperature payload %s (%v)", payload, err)
+	}
+
+	payload, err = StatePayload(types.CapabilityButtonEvent, "double_press")
+	if err != nil {
+		t.Fatalf("Failed to encode button event %v", err)
+	}
+	var event map[string]string
+	if err := json.Unmarshal(payload, &event); err != nil || event["event_type"] != "double_press" {
+		t.Fatalf("Unexpected button payload %s", payload)
+	}
+}
+
+// Runs against a real broker, e.g. MQTT_BRIDGE_TEST_URL=tcp://localhost:1883 with the mosquitto from compose.yml
+func TestBridgeAgainstBroker(t *testing.T) {
+	brokerUrl := os.Getenv("MQTT_BRIDGE_TEST_URL")
+	if brokerUrl == "" {
+		t.Skip("MQTT_BRIDGE_TEST_URL not set")
+	}
+
+	cfg := &BridgeConfig{
+		BrokerUrl:       brokerUrl,
+		ClientID:        "gohome-bridge-test",
+		TopicPrefix:     "gohome-test",
+		DiscoveryPrefix: "homeassistant-test",
+	}
+	topics := NewTopics(cfg.TopicPrefix, cfg.DiscoveryPrefix)
+	a := &MqttAdapter{
+		bridge:        NewBridge(cfg, topics, nil),
+		topics:        topics,
+		onStateChange: func(types.State) {},
+		devices:       make(map[string]*bridgedDevice),
+	}
+
+	received := make(chan mqtt.Message, 10)
+	opts := mqtt.NewClientOptions().AddBroker(brokerUrl).SetClientID("gohome-bridge-test-listener")
+	listener := mqtt.NewClient(opts)
+	if token := listener.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("Failed to connect listener %v", token.Error())
+	}
+	defer listener.Disconnect(250)
+	listener.Subscribe("homeassistant-test/#", 1, func(_ mqtt.Client, msg mqtt.Message) { received <- msg }).Wait()
+
+	if err := a.Start(); err != nil {
+		t.Fatalf("Failed to start adapter %v", err)
+	}
+	defer a.Stop()
+
+	a.onDeviceData(types.DeviceStateUpdate{
+		DeviceID:       "dev-test",
+		DeviceName:     "Test",
+		CapabilityType: types.CapabilityTemperature,
+		Timestamp:      time.Now(),
+		Value:          20.0,
+		Unit:           types.UnitCelsius,
+	})
+
+	select {
+	case msg := <-received:
+		if msg.Topic() != "homeassistant-test/sensor/dev-test/temperature/config" {
+			t.Fatalf("Unexpected topic %s", msg.Topic())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No discovery config received")
+	}
+
+	a.onDeviceUnregistered(types.Device{ID: "dev-test"})
+}
@@ -0,0 +1,17 @@
+module mqtt-adapter
+
+go 1.25.4
+
+require (
+	github.com/Bastien2203/go-home v1.5.5
+	github.com/eclipse/paho.mqtt.golang v1.5.1
+	github.com/sethvargo/go-envconfig v1.3.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+	golang.org/x/net v0.44.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+const (
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// Topics builds every topic published on the external broker.
+// State topics only depend on device ID and capability so they stay stable across renames.
+type Topics struct {
+	prefix          string
+	discoveryPrefix string
+}
+
+func NewTopics(prefix, discoveryPrefix string) Topics {
+	return Topics{prefix: prefix, discoveryPrefix: discoveryPrefix}
+}
+
+func (t Topics) BridgeAvailability() string {
+	return fmt.Sprintf("%s/bridge/availability", t.prefix)
+}
+
+func (t Topics) DeviceAvailability(deviceID string) string {
+	return fmt.Sprintf("%s/%s/availability", t.prefix, deviceID)
+}
+
+func (t Topics) State(deviceID string, capability types.CapabilityType) string {
+	return fmt.Sprintf("%s/%s/%s", t.prefix, deviceID, capability)
+}
+
+func (t Topics) Discovery(component string, deviceID string, capability types.CapabilityType) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", t.discoveryPrefix, component, deviceID, capability)
+}
+
+// Home Assistant publishes "online" here when it (re)starts
+func (t Topics) HomeAssistantStatus() string {
+	return fmt.Sprintf("%s/status", t.discoveryPrefix)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/sethvargo/go-envconfig"
+)
+
+type ScannerConfig struct {
+	BrokerUrl   string `env:"MQTT_SCANNER_URL"` // default : the gohome broker
+	Username    string `env:"MQTT_SCANNER_USERNAME"`
+	Password    string `env:"MQTT_SCANNER_PASSWORD"`
+	ClientID    string `env:"MQTT_SCANNER_CLIENT_ID,default=gohome-mqtt-scanner"`
+	SourcesFile string `env:"MQTT_SCANNER_SOURCES_FILE,default=./mqtt_sources.json"`
+	Sources     []*Source
+}
+
+type sourcesFile struct {
+	Sources []*Source `json:"sources"`
+}
+
+// .env file is already loaded by config.LoadFromEnvPlugin
+func LoadScannerConfig(ctx context.Context, pluginCfg *config.PluginConfig) *ScannerConfig {
+	cfg := &ScannerConfig{}
+	if err := envconfig.Process(ctx, cfg); err != nil {
+		log.Fatalf("%+v\n", err)
+	}
+	if cfg.BrokerUrl == "" {
+		cfg.BrokerUrl = pluginCfg.BrokerUrl
+	}
+
+	sources, err := LoadSources(cfg.SourcesFile)
+	if err != nil {
+		log.Fatalf("Error loading mqtt sources : %v", err)
+	}
+	cfg.Sources = sources
+	return cfg
+}
+
+func LoadSources(path string) ([]*Source, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file sourcesFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	for i, s := range file.Sources {
+		if err := s.Compile(); err != nil {
+			return nil, fmt.Errorf("source #%d (%s): %w", i, s.Name, err)
+		}
+	}
+	return file.Sources, nil
+}
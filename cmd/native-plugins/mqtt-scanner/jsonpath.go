@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Subset of JSONPath : $, $.a.b, $.a[0], $['key with spaces'], $.a["b"][1].c
+type JSONPath struct {
+	raw   string
+	steps []pathStep
+}
+
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func ParseJSONPath(raw string) (*JSONPath, error) {
+	if !strings.HasPrefix(raw, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", raw)
+	}
+
+	p := &JSONPath{raw: raw}
+	rest := raw[1:]
+
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("json path %q: empty key", raw)
+			}
+			p.steps = append(p.steps, pathStep{key: rest[:end]})
+			rest = rest[end:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("json path %q: missing ]", raw)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.steps = append(p.steps, pathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("json path %q: invalid index %q", raw, inner)
+			}
+			p.steps = append(p.steps, pathStep{index: index, isIndex: true})
+
+		default:
+			return nil, fmt.Errorf("json path %q: unexpected %q", raw, rest[0])
+		}
+	}
+
+	return p, nil
+}
+
+// Lookup the value in a document decoded by encoding/json
+func (p *JSONPath) Lookup(doc any) (any, bool) {
+	current := doc
+	for _, step := range p.steps {
+		if step.isIndex {
+			list, ok := current.([]any)
+			if !ok || step.index >= len(list) {
+				return nil, false
+			}
+			current = list[step.index]
+			continue
+		}
+
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[step.key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (p *JSONPath) String() string {
+	return p.raw
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+var p = &plugin.Plugin{
+	ID:    "mqtt-scanner",
+	Name:  "MQTT Scanner",
+	Type:  plugin.PluginScanner,
+	State: types.StateStopped,
+}
+
+func main() {
+	ctx := context.Background()
+	cfg := config.LoadFromEnvPlugin(ctx)
+	scannerCfg := LoadScannerConfig(ctx, cfg)
+
+	eventBus, err := events.NewEventBus(events.TransportMQTT, cfg.BrokerConnection, p.ID, plugin.StateWill(p.ID))
+	if err != nil {
+		log.Fatalf("Error setting up event bus : %v", err)
+	}
+
+	client := plugin.NewPluginClient(p, eventBus)
+	scanner := NewMqttScanner(eventBus, client.EmitNewState, scannerCfg)
+	client.RunPlugin(scanner.Start, scanner.Stop)
+}
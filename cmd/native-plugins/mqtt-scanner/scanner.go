@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MqttScanner struct {
+	eventBus      events.EventBus
+	onStateChange func(state types.State)
+	cfg           *ScannerConfig
+
+	mu      sync.Mutex
+	client  mqtt.Client
+	started bool
+}
+
+func NewMqttScanner(eventBus events.EventBus, onStateChange func(state types.State), cfg *ScannerConfig) *MqttScanner {
+	return &MqttScanner{
+		eventBus:      eventBus,
+		onStateChange: onStateChange,
+		cfg:           cfg,
+	}
+}
+
+func (s *MqttScanner) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("mqtt scanner already running")
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(s.cfg.BrokerUrl)
+	opts.SetClientID(s.cfg.ClientID)
+	opts.SetUsername(s.cfg.Username)
+	opts.SetPassword(s.cfg.Password)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetAutoReconnect(true)
+
+	// Subscriptions are lost with the clean session, subscribe again on every (re)connection
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		log.Printf("[MQTT Scanner] connected to %s", s.cfg.BrokerUrl)
+		for _, source := range s.cfg.Sources {
+			token := c.Subscribe(source.Topic, 0, s.handler(source))
+			if token.Wait() && token.Error() != nil {
+				log.Printf("[MQTT Scanner] failed to subscribe to %s: %v", source.Topic, token.Error())
+			}
+		}
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Printf("[MQTT Scanner] connection lost: %v", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.cfg.BrokerUrl, token.Error())
+	}
+
+	s.client = client
+	s.started = true
+	s.onStateChange(types.StateRunning)
+	log.Printf("[MQTT Scanner] Started with %d source(s)", len(s.cfg.Sources))
+	return nil
+}
+
+func (s *MqttScanner) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return nil
+	}
+
+	s.client.Disconnect(250)
+	s.client = nil
+	s.started = false
+	s.onStateChange(types.StateStopped)
+	log.Println("[MQTT Scanner] Stopped")
+	return nil
+}
+
+func (s *MqttScanner) handler(source *Source) mqtt.MessageHandler {
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		data, err := source.Parse(msg.Topic(), msg.Payload(), time.Now())
+		if err != nil {
+			log.Printf("[MQTT Scanner] %s: %v", source.Name, err)
+			return
+		}
+		if data == nil {
+			return
+		}
+
+		if err := s.eventBus.Publish(events.Event{
+			Type:    events.ParsedDataReceived,
+			Payload: data,
+		}); err != nil {
+			log.Printf("[MQTT Scanner] failed to publish data for %s: %v", data.Address, err)
+		}
+	}
+}
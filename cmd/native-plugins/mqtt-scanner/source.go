@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// Source maps the messages of one mqtt topic filter to device capabilities
+type Source struct {
+	Name     string     `json:"name"`
+	Topic    string     `json:"topic"`   // mqtt topic filter, + and # wildcards allowed
+	Address  string     `json:"address"` // json path ("$.id") or template ("{topic}", "{topic[1]}"), default "{topic}"
+	Mappings []*Mapping `json:"mappings"`
+
+	addressPath *JSONPath
+}
+
+type Mapping struct {
+	Capability types.CapabilityType `json:"capability"`
+	Path       string               `json:"path"`  // default "$" : the whole payload
+	Type       types.ValueType      `json:"type"`  // default : inferred from the json value
+	Unit       types.Unit           `json:"unit"`  // default : no unit
+	Scale      float64              `json:"scale"` // multiplier applied to numbers, default 1
+
+	path *JSONPath
+}
+
+var topicLevelPlaceholder = regexp.MustCompile(`\{topic\[(\d+)\]\}`)
+
+func (s *Source) Compile() error {
+	if s.Topic == "" {
+		return fmt.Errorf("missing topic")
+	}
+	if s.Name == "" {
+		s.Name = s.Topic
+	}
+	if s.Address == "" {
+		s.Address = "{topic}"
+	}
+	if strings.HasPrefix(s.Address, "$") {
+		path, err := ParseJSONPath(s.Address)
+		if err != nil {
+			return err
+		}
+		s.addressPath = path
+	}
+
+	if len(s.Mappings) == 0 {
+		return fmt.Errorf("no mappings")
+	}
+	for _, m := range s.Mappings {
+		if m.Capability == "" {
+			return fmt.Errorf("mapping without capability")
+		}
+		if m.Path == "" {
+			m.Path = "$"
+		}
+		path, err := ParseJSONPath(m.Path)
+		if err != nil {
+			return err
+		}
+		m.path = path
+		if m.Scale == 0 {
+			m.Scale = 1
+		}
+		switch m.Type {
+		case "", types.TypeFloat, types.TypeInt, types.TypeBool, types.TypeString:
+		default:
+			return fmt.Errorf("unsupported type %s for capability %s", m.Type, m.Capability)
+		}
+	}
+	return nil
+}
+
+// Parse a message received on topic, returns nil if nothing could be mapped
+func (s *Source) Parse(topic string, payload []byte, now time.Time) (*types.ParsedData, error) {
+	var doc any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		// Plain payloads like ESPHome "21.5" (already valid json) or "ON"
+		doc = strings.TrimSpace(string(payload))
+	}
+
+	address, err := s.address(topic, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &types.ParsedData{
+		Address:     address,
+		AddressType: types.BasicAddress,
+		Data:        make([]*types.Capability, 0, len(s.Mappings)),
+		Timestamp:   now,
+	}
+
+	for _, m := range s.Mappings {
+		raw, found := m.path.Lookup(doc)
+		if !found || raw == nil {
+			// Payloads often only contain a subset of the fields (zigbee2mqtt, tasmota)
+			continue
+		}
+
+		c, err := m.capability(raw)
+		if err != nil {
+			log.Printf("[MQTT Scanner] %s: %v", s.Name, err)
+			continue
+		}
+		data.Data = append(data.Data, c)
+	}
+
+	if len(data.Data) == 0 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+func (s *Source) address(topic string, doc any) (string, error) {
+	if s.addressPath != nil {
+		v, found := s.addressPath.Lookup(doc)
+		if !found || v == nil {
+			return "", fmt.Errorf("address %s not found in payload", s.addressPath)
+		}
+		return formatScalar(v), nil
+	}
+
+	levels := strings.Split(topic, "/")
+	address := topicLevelPlaceholder.ReplaceAllStringFunc(s.Address, func(match string) string {
+		i, _ := strconv.Atoi(topicLevelPlaceholder.FindStringSubmatch(match)[1])
+		if i >= len(levels) {
+			return ""
+		}
+		return levels[i]
+	})
+	address = strings.ReplaceAll(address, "{topic}", topic)
+	if address == "" {
+		return "", fmt.Errorf("empty address for topic %s", topic)
+	}
+	return address, nil
+}
+
+func (m *Mapping) capability(raw any) (*types.Capability, error) {
+	t := m.Type
+	if t == "" {
+		switch raw.(type) {
+		case float64:
+			t = types.TypeFloat
+		case bool:
+			t = types.TypeBool
+		case string:
+			t = types.TypeString
+		default:
+			return nil, fmt.Errorf("unsupported value %v for capability %s", raw, m.Capability)
+		}
+	}
+
+	value, err := convert(raw, t, m.Scale)
+	if err != nil {
+		return nil, fmt.Errorf("capability %s: %w", m.Capability, err)
+	}
+
+	return &types.Capability{
+		Name:  m.Capability,
+		Value: value,
+		Type:  t,
+		Unit:  m.Unit,
+	}, nil
+}
+
+func convert(raw any, t types.ValueType, scale float64) (any, error) {
+	switch t {
+	case types.TypeFloat, types.TypeInt:
+		var f float64
+		switch v := raw.(type) {
+		case float64:
+			f = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", v)
+			}
+			f = parsed
+		case bool:
+			if v {
+				f = 1
+			}
+		default:
+			return nil, fmt.Errorf("%v is not a number", raw)
+		}
+		f *= scale
+		if t == types.TypeInt {
+			return int(math.Round(f)), nil
+		}
+		return f, nil
+
+	case types.TypeBool:
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "on", "true", "1", "open", "yes", "detected":
+				return true, nil
+			case "off", "false", "0", "closed", "no", "clear":
+				return false, nil
+			}
+			return nil, fmt.Errorf("%q is not a boolean", v)
+		default:
+			return nil, fmt.Errorf("%v is not a boolean", raw)
+		}
+
+	case types.TypeString:
+		return formatScalar(raw), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func formatScalar(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
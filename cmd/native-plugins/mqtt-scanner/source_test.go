@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func compile(t *testing.T, s *Source) *Source {
+	if err := s.Compile(); err != nil {
+		t.Fatalf("Failed to compile source %v", err)
+	}
+	return s
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]any{
+		"AM2301":   map[string]any{"Temperature": 21.5},
+		"list":     []any{map[string]any{"v": true}},
+		"with key": "x",
+	}
+
+	cases := map[string]any{
+		"$.AM2301.Temperature":       21.5,
+		"$.list[0].v":                true,
+		"$['with key']":              "x",
+		`$["AM2301"]["Temperature"]`: 21.5,
+	}
+	for raw, expected := range cases {
+		path, err := ParseJSONPath(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", raw, err)
+		}
+		v, found := path.Lookup(doc)
+		if !found || v != expected {
+			t.Fatalf("%s: expected %v, got %v (found %v)", raw, expected, v, found)
+		}
+	}
+
+	for _, raw := range []string{"temperature", "$.", "$[abc]", "$[0"} {
+		if _, err := ParseJSONPath(raw); err == nil {
+			t.Fatalf("Expected error for %s", raw)
+		}
+	}
+}
+
+func TestTasmotaSource(t *testing.T) {
+	s := compile(t, &Source{
+		Topic:   "tele/+/SENSOR",
+		Address: "{topic[1]}",
+		Mappings: []*Mapping{
+			{Capability: types.CapabilityTemperature, Path: "$.AM2301.Temperature", Unit: types.UnitCelsius},
+			{Capability: types.CapabilityHumidity, Path: "$.AM2301.Humidity", Type: types.TypeInt, Unit: types.UnitPercent},
+		},
+	})
+
+	data, err := s.Parse("tele/bedroom/SENSOR", []byte(`{"AM2301":{"Temperature":19.4,"Humidity":55.6}}`), time.Now())
+	if err != nil || data == nil {
+		t.Fatalf("Failed to parse payload %v", err)
+	}
+	if data.Address != "bedroom" || data.AddressType != types.BasicAddress || len(data.Data) != 2 {
+		t.Fatalf("Unexpected parsed data %+v", data)
+	}
+	if data.Data[0].Value != 19.4 || data.Data[0].Type != types.TypeFloat {
+		t.Fatalf("Unexpected temperature %+v", data.Data[0])
+	}
+	if data.Data[1].Value != 56 || data.Data[1].Type != types.TypeInt {
+		t.Fatalf("Unexpected humidity %+v", data.Data[1])
+	}
+}
+
+func TestZigbee2MqttPartialPayload(t *testing.T) {
+	s := compile(t, &Source{
+		Topic: "zigbee2mqtt/+",
+		Mappings: []*Mapping{
+			{Capability: types.CapabilityTemperature, Path: "$.temperature"},
+			{Capability: types.CapabilityBattery, Path: "$.battery"},
+		},
+	})
+
+	data, err := s.Parse("zigbee2mqtt/kitchen", []byte(`{"battery":87,"linkquality":120}`), time.Now())
+	if err != nil || data == nil {
+		t.Fatalf("Failed to parse payload %v", err)
+	}
+	if data.Address != "zigbee2mqtt/kitchen" || len(data.Data) != 1 || data.Data[0].Name != types.CapabilityBattery {
+		t.Fatalf("Unexpected parsed data %+v", data)
+	}
+
+	data, err = s.Parse("zigbee2mqtt/kitchen", []byte(`{"linkquality":120}`), time.Now())
+	if err != nil || data != nil {
+		t.Fatalf("Expected nothing to be mapped, got %+v (%v)", data, err)
+	}
+}
+
+func TestPlainPayload(t *testing.T) {
+	s := compile(t, &Source{
+		Topic:   "esphome/+/binary_sensor/door/state",
+		Address: "esp-{topic[1]}",
+		Mappings: []*Mapping{
+			{Capability: "door", Type: types.TypeBool},
+		},
+	})
+
+	data, err := s.Parse("esphome/hall/binary_sensor/door/state", []byte("ON"), time.Now())
+	if err != nil || data == nil {
+		t.Fatalf("Failed to parse payload %v", err)
+	}
+	if data.Address != "esp-hall" || data.Data[0].Value != true {
+		t.Fatalf("Unexpected parsed data %+v", data.Data[0])
+	}
+}
+
+func TestAddressFromPayload(t *testing.T) {
+	s := compile(t, &Source{
+		Topic:   "sensors",
+		Address: "$.id",
+		Mappings: []*Mapping{
+			{Capability: types.CapabilityTemperature, Path: "$.t", Scale: 0.1},
+		},
+	})
+
+	data, err := s.Parse("sensors", []byte(`{"id":"esp32-01","t":215}`), time.Now())
+	if err != nil || data == nil {
+		t.Fatalf("Failed to parse payload %v", err)
+	}
+	if data.Address != "esp32-01" || data.Data[0].Value != 21.5 {
+		t.Fatalf("Unexpected parsed data %+v %+v", data, data.Data[0])
+	}
+
+	if _, err := s.Parse("sensors", []byte(`{"t":215}`), time.Now()); err == nil {
+		t.Fatalf("Expected error when address is missing")
+	}
+}
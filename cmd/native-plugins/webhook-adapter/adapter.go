@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+const (
+	statusInterval    = 15 * time.Second
+	statusDeadLetters = 20
+)
+
+type WebhookAdapter struct {
+	targets       []*Target
+	deadLetters   *DeadLetterLog
+	onStateChange func(state types.State)
+	onStatus      func(status map[string]any)
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewWebhookAdapter(eventBus events.EventBus, onStateChange func(state types.State), onStatus func(status map[string]any), cfg *WebhookConfig) (*WebhookAdapter, error) {
+	a := &WebhookAdapter{
+		deadLetters:   NewDeadLetterLog(cfg.DeadLetterFile),
+		onStateChange: onStateChange,
+		onStatus:      onStatus,
+	}
+
+	for _, targetCfg := range cfg.Targets {
+		target, err := NewTarget(targetCfg, cfg.Timeout, cfg.QueueSize)
+		if err != nil {
+			return nil, err
+		}
+		a.targets = append(a.targets, target)
+	}
+
+	if err := events.Subscribe(eventBus, events.UpdateDataForAdapter(p.ID), a.onDeviceData); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *WebhookAdapter) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running {
+		return fmt.Errorf("webhook adapter already running")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	for _, target := range a.targets {
+		a.wg.Add(1)
+		go a.worker(ctx, target)
+	}
+	a.wg.Add(1)
+	go a.reportStatus(ctx)
+
+	a.running = true
+	a.onStateChange(types.StateRunning)
+	a.onStatus(a.Status())
+	log.Printf("[Webhook] Adapter started with %d target(s)", len(a.targets))
+	return nil
+}
+
+func (a *WebhookAdapter) Stop() error {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return nil
+	}
+	a.running = false
+	a.cancel()
+	a.mu.Unlock()
+
+	a.wg.Wait()
+
+	a.onStateChange(types.StateStopped)
+	a.onStatus(a.Status())
+	log.Println("[Webhook] Adapter stopped")
+	return nil
+}
+
+func (a *WebhookAdapter) onDeviceData(data types.DeviceStateUpdate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.running {
+		return
+	}
+
+	for _, target := range a.targets {
+		if !target.Accepts(data) {
+			continue
+		}
+		select {
+		case target.queue <- data:
+		default:
+			target.failed.Add(1)
+			a.deadLetters.Add(newDeadLetter(target, data, 0, "queue full", nil))
+		}
+	}
+}
+
+func (a *WebhookAdapter) worker(ctx context.Context, target *Target) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update := <-target.queue:
+			a.deliver(ctx, target, update)
+		}
+	}
+}
+
+func (a *WebhookAdapter) deliver(ctx context.Context, target *Target, update types.DeviceStateUpdate) {
+	body, err := target.Render(update)
+	if err != nil {
+		target.failed.Add(1)
+		a.deadLetters.Add(newDeadLetter(target, update, 0, err.Error(), nil))
+		return
+	}
+
+	attempts, err := target.Deliver(ctx, body)
+	if err != nil {
+		target.failed.Add(1)
+		target.lastErr.Store(err.Error())
+		a.deadLetters.Add(newDeadLetter(target, update, attempts, err.Error(), body))
+		return
+	}
+
+	target.sent.Add(1)
+	target.lastSent.Store(time.Now())
+}
+
+func (a *WebhookAdapter) reportStatus(ctx context.Context) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.onStatus(a.Status())
+		}
+	}
+}
+
+func (a *WebhookAdapter) Status() map[string]any {
+	targets := make([]map[string]any, 0, len(a.targets))
+	for _, target := range a.targets {
+		targets = append(targets, target.Status())
+	}
+	return map[string]any{
+		"targets":      targets,
+		"dead_letters": a.deadLetters.Recent(statusDeadLetters),
+	}
+}
+
+func newDeadLetter(target *Target, update types.DeviceStateUpdate, attempts int, reason string, body []byte) DeadLetter {
+	return DeadLetter{
+		Time:       time.Now(),
+		Target:     target.cfg.Name,
+		DeviceID:   update.DeviceID,
+		Capability: string(update.CapabilityType),
+		Attempts:   attempts,
+		Error:      reason,
+		Body:       string(body),
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type WebhookConfig struct {
+	TargetsFile    string        `env:"WEBHOOK_TARGETS_FILE,default=./webhooks.json"`
+	DeadLetterFile string        `env:"WEBHOOK_DEAD_LETTER_FILE,default=./webhook_dead_letters.jsonl"`
+	QueueSize      int           `env:"WEBHOOK_QUEUE_SIZE,default=1000"`
+	Timeout        time.Duration `env:"WEBHOOK_TIMEOUT,default=10s"`
+	Targets        []*TargetConfig
+}
+
+type TargetConfig struct {
+	Name        string            `json:"name"`
+	Url         string            `json:"url"`
+	Method      string            `json:"method"`
+	Secret      string            `json:"secret"`
+	Template    string            `json:"template"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	Devices     []string          `json:"devices"`     // empty : every linked device
+	RateLimit   float64           `json:"rate_limit"`  // requests per second, 0 : unlimited
+	Burst       int               `json:"burst"`       // default 1
+	MaxRetries  *int              `json:"max_retries"` // default 3
+	Backoff     Duration          `json:"backoff"`     // first retry delay, doubled each attempt, default 1s
+}
+
+type targetsFile struct {
+	Targets []*TargetConfig `json:"targets"`
+}
+
+// Duration accepts go durations ("500ms", "2s") in json
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// .env file is already loaded by config.LoadFromEnvPlugin
+func LoadWebhookConfig(ctx context.Context) *WebhookConfig {
+	cfg := &WebhookConfig{}
+	if err := envconfig.Process(ctx, cfg); err != nil {
+		log.Fatalf("%+v\n", err)
+	}
+
+	targets, err := LoadTargets(cfg.TargetsFile)
+	if err != nil {
+		log.Fatalf("Error loading webhook targets : %v", err)
+	}
+	cfg.Targets = targets
+	return cfg
+}
+
+func LoadTargets(path string) ([]*TargetConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file targetsFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	names := make(map[string]bool, len(file.Targets))
+	for i, t := range file.Targets {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("target #%d: %w", i, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("target #%d: duplicated name %s", i, t.Name)
+		}
+		names[t.Name] = true
+	}
+	return file.Targets, nil
+}
+
+func (t *TargetConfig) validate() error {
+	u, err := url.Parse(t.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid url %q", t.Url)
+	}
+	if t.Name == "" {
+		t.Name = u.Host
+	}
+	if t.Method == "" {
+		t.Method = "POST"
+	}
+	if t.ContentType == "" {
+		t.ContentType = "application/json"
+	}
+	if t.Burst <= 0 {
+		t.Burst = 1
+	}
+	if t.MaxRetries == nil {
+		retries := 3
+		t.MaxRetries = &retries
+	}
+	if t.Backoff <= 0 {
+		t.Backoff = Duration(time.Second)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const deadLetterMemory = 50
+
+type DeadLetter struct {
+	Time       time.Time `json:"time"`
+	Target     string    `json:"target"`
+	DeviceID   string    `json:"device_id"`
+	Capability string    `json:"capability"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	Body       string    `json:"body,omitempty"`
+}
+
+// Failed deliveries, appended to a jsonl file and the last ones kept in memory for the plugin status
+type DeadLetterLog struct {
+	mu      sync.Mutex
+	path    string
+	entries []DeadLetter
+}
+
+func NewDeadLetterLog(path string) *DeadLetterLog {
+	return &DeadLetterLog{path: path}
+}
+
+func (l *DeadLetterLog) Add(entry DeadLetter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log.Printf("[Webhook] delivery to %s failed after %d attempt(s): %s", entry.Target, entry.Attempts, entry.Error)
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > deadLetterMemory {
+		l.entries = l.entries[len(l.entries)-deadLetterMemory:]
+	}
+
+	if l.path == "" {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("[Webhook] failed to open dead letter file: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
+
+// Newest first
+func (l *DeadLetterLog) Recent(n int) []DeadLetter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n > len(l.entries) {
+		n = len(l.entries)
+	}
+	recent := make([]DeadLetter, 0, n)
+	for i := len(l.entries) - 1; i >= len(l.entries)-n; i-- {
+		recent = append(recent, l.entries[i])
+	}
+	return recent
+}
@@ -0,0 +1,18 @@
+module webhook-adapter
+
+go 1.25.4
+
+require (
+	github.com/Bastien2203/go-home v1.5.5
+	github.com/sethvargo/go-envconfig v1.3.0
+	golang.org/x/time v0.12.0
+)
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+	golang.org/x/net v0.44.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
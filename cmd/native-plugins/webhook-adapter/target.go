@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+	"golang.org/x/time/rate"
+)
+
+const (
+	SignatureHeader = "X-GoHome-Signature"
+	TimestampHeader = "X-GoHome-Timestamp"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+type Target struct {
+	cfg      *TargetConfig
+	tmpl     *template.Template
+	limiter  *rate.Limiter
+	client   *http.Client
+	queue    chan types.DeviceStateUpdate
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+	retried  atomic.Uint64
+	lastErr  atomic.Value // string
+	lastSent atomic.Value // time.Time
+}
+
+func NewTarget(cfg *TargetConfig, timeout time.Duration, queueSize int) (*Target, error) {
+	t := &Target{
+		cfg:     cfg,
+		limiter: rate.NewLimiter(rate.Inf, cfg.Burst),
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan types.DeviceStateUpdate, queueSize),
+	}
+
+	if cfg.RateLimit > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.Burst)
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New(cfg.Name).Funcs(templateFuncs).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for target %s: %w", cfg.Name, err)
+		}
+		t.tmpl = tmpl
+	}
+
+	return t, nil
+}
+
+func (t *Target) Accepts(update types.DeviceStateUpdate) bool {
+	return len(t.cfg.Devices) == 0 || slices.Contains(t.cfg.Devices, update.DeviceID)
+}
+
+// Body is the DeviceStateUpdate json, or the rendered template
+func (t *Target) Render(update types.DeviceStateUpdate) ([]byte, error) {
+	if t.tmpl == nil {
+		return json.Marshal(update)
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, update); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Signature of "<timestamp>.<body>", so a captured request cannot be replayed with another timestamp
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type deliveryError struct {
+	statusCode int
+	err        error
+}
+
+func (e *deliveryError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("unexpected status %d", e.statusCode)
+}
+
+// Client errors (except 408 and 429) will not succeed on retry
+func (e *deliveryError) retryable() bool {
+	return e.err != nil || e.statusCode >= 500 || e.statusCode == http.StatusTooManyRequests || e.statusCode == http.StatusRequestTimeout
+}
+
+func (t *Target) send(ctx context.Context, body []byte) *deliveryError {
+	req, err := http.NewRequestWithContext(ctx, t.cfg.Method, t.cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{err: err}
+	}
+
+	req.Header.Set("Content-Type", t.cfg.ContentType)
+	req.Header.Set("User-Agent", "gohome-webhook")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(t.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return &deliveryError{err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode/100 != 2 {
+		return &deliveryError{statusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Deliver with exponential backoff, returns the last error and the number of attempts
+func (t *Target) Deliver(ctx context.Context, body []byte) (int, error) {
+	backoff := time.Duration(t.cfg.Backoff)
+	attempts := 0
+
+	for {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return attempts, err
+		}
+
+		attempts++
+		derr := t.send(ctx, body)
+		if derr == nil {
+			return attempts, nil
+		}
+		if !derr.retryable() || attempts > *t.cfg.MaxRetries {
+			return attempts, derr
+		}
+
+		t.retried.Add(1)
+		select {
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (t *Target) Status() map[string]any {
+	status := map[string]any{
+		"name":    t.cfg.Name,
+		"url":     redactURL(t.cfg.Url),
+		"sent":    t.sent.Load(),
+		"failed":  t.failed.Load(),
+		"retried": t.retried.Load(),
+		"queued":  len(t.queue),
+	}
+	if v, ok := t.lastErr.Load().(string); ok {
+		status["last_error"] = v
+	}
+	if v, ok := t.lastSent.Load().(time.Time); ok {
+		status["last_sent"] = v
+	}
+	return status
+}
+
+// Query strings and credentials often carry tokens, keep them out of the status
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
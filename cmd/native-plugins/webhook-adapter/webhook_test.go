@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func newTestTarget(t *testing.T, cfg *TargetConfig) *Target {
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Invalid target config %v", err)
+	}
+	target, err := NewTarget(cfg, time.Second, 10)
+	if err != nil {
+		t.Fatalf("Failed to create target %v", err)
+	}
+	return target
+}
+
+func newTestAdapter(t *testing.T, targets ...*Target) *WebhookAdapter {
+	return &WebhookAdapter{
+		targets:       targets,
+		deadLetters:   NewDeadLetterLog(filepath.Join(t.TempDir(), "dead_letters.jsonl")),
+		onStateChange: func(types.State) {},
+		onStatus:      func(map[string]any) {},
+	}
+}
+
+var testUpdate = types.DeviceStateUpdate{
+	DeviceID:       "dev-1",
+	DeviceName:     "Living room",
+	CapabilityType: types.CapabilityTemperature,
+	Timestamp:      time.Unix(1700000000, 0),
+	Value:          21.5,
+}
+
+func TestSignedDelivery(t *testing.T) {
+	received := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := Sign("secret", r.Header.Get(TimestampHeader), body)
+		received <- r.Header.Get(SignatureHeader) == expected
+	}))
+	defer server.Close()
+
+	a := newTestAdapter(t, newTestTarget(t, &TargetConfig{Url: server.URL, Secret: "secret"}))
+	if err := a.Start(); err != nil {
+		t.Fatalf("Failed to start adapter %v", err)
+	}
+	defer a.Stop()
+
+	a.onDeviceData(testUpdate)
+
+	select {
+	case ok := <-received:
+		if !ok {
+			t.Fatalf("Invalid signature")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Webhook not received")
+	}
+}
+
+func TestTemplateBody(t *testing.T) {
+	target := newTestTarget(t, &TargetConfig{
+		Url:      "http://localhost",
+		Template: `{"text": "{{.DeviceName}} {{.CapabilityType}} = {{.Value}}", "raw": {{json .}}}`,
+	})
+
+	body, err := target.Render(testUpdate)
+	if err != nil {
+		t.Fatalf("Failed to render template %v", err)
+	}
+	expected := `{"text": "Living room temperature = 21.5", "raw": {"device_id":"dev-1","name":"Living room","capability_type":"temperature","timestamp":"` +
+		testUpdate.Timestamp.Format(time.RFC3339) + `","value":21.5}}`
+	if string(body) != expected {
+		t.Fatalf("Unexpected body\n got: %s\nwant: %s", body, expected)
+	}
+}
+
+func TestRetryThenSuccess(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	target := newTestTarget(t, &TargetConfig{Url: server.URL, Backoff: Duration(time.Millisecond)})
+	attempts, err := target.Deliver(t.Context(), []byte("{}"))
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected success after 3 attempts, got %d attempts (%v)", attempts, err)
+	}
+}
+
+func TestDeadLetterAfterRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	retries := 1
+	target := newTestTarget(t, &TargetConfig{Name: "down", Url: server.URL, MaxRetries: &retries, Backoff: Duration(time.Millisecond)})
+	a := newTestAdapter(t, target)
+
+	a.deliver(t.Context(), target, testUpdate)
+
+	deadLetters := a.deadLetters.Recent(10)
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 2 || deadLetters[0].Target != "down" {
+		t.Fatalf("Unexpected dead letters %+v", deadLetters)
+	}
+	if content, err := os.ReadFile(a.deadLetters.path); err != nil || len(content) == 0 {
+		t.Fatalf("Dead letter not written to file (%v)", err)
+	}
+	if target.Status()["failed"] != uint64(1) {
+		t.Fatalf("Unexpected target status %+v", target.Status())
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	target := newTestTarget(t, &TargetConfig{Url: server.URL, Backoff: Duration(time.Millisecond)})
+	if _, err := target.Deliver(t.Context(), []byte("{}")); err == nil || calls.Load() != 1 {
+		t.Fatalf("Expected a single failed attempt, got %d", calls.Load())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	target := newTestTarget(t, &TargetConfig{Url: server.URL, RateLimit: 10, Burst: 1})
+	start := time.Now()
+	for range 3 {
+		if _, err := target.Deliver(t.Context(), []byte("{}")); err != nil {
+			t.Fatalf("Delivery failed %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("Rate limit not applied, 3 requests took %s", elapsed)
+	}
+}
@@ -6,28 +6,61 @@ export const LoginPage = (props: {
     onLoginSuccess: () => void
 }) => {
     const [canRegister, setCanRegister] = useState<boolean>()
+    const [invitationToken] = useState(() => new URLSearchParams(window.location.search).get("invitation") ?? undefined)
     const [message, setMessage] = useState<string>()
+    const [totpRequired, setTotpRequired] = useState(false)
     const [formData, setFormData] = useState<{
         email?: string;
-        password?: string
+        password?: string;
+        code?: string
     }>({})
 
     useEffect(() => {
+        if (invitationToken) {
+            api.getInvitation(invitationToken)
+            .then(i => {
+                setCanRegister(true)
+                setFormData(prev => ({ ...prev, email: i.email }))
+            })
+            .catch(_ => setMessage("invalid or expired invitation"))
+            return
+        }
         api.canRegister()
         .then(r => setCanRegister(r.can_register))
         .catch(_ => setMessage("network error"))
-    }, [props.onLoginSuccess])
+    }, [props.onLoginSuccess, invitationToken])
 
     const handleSubmit = async (e: FormEvent<HTMLFormElement>) => {
         e.preventDefault()
+        if (totpRequired) {
+            // 6 digits code from the authenticator app, anything else is a recovery code
+            const code = formData.code?.trim() ?? ""
+            const request = /^\d{6}$/.test(code) ? api.loginTotp(code) : api.loginRecoveryCode(code)
+            request
+                .then(props.onLoginSuccess)
+                .catch(_ => setMessage("error invalid code"))
+            return
+        }
         if (!formData.email || !formData.password) {
             setMessage("Please fill all fields")
             return
         }
 
-        const subscriptionMethod = canRegister ? api.register : api.login
-        subscriptionMethod(formData.email, formData.password)
-            .then(props.onLoginSuccess)
+        if (canRegister) {
+            api.register(formData.email, formData.password, invitationToken)
+                .then(props.onLoginSuccess)
+                .catch(_ => setMessage("error invalid login"))
+            return
+        }
+        api.login(formData.email, formData.password)
+            .then(r => {
+                if (r.status === "totp_required") {
+                    setMessage(undefined)
+                    setTotpRequired(true)
+                    return
+                }
+                props.onLoginSuccess()
+            })
             .catch(_ => setMessage("error invalid login"))
     }
 
@@ -60,6 +93,8 @@ export const LoginPage = (props: {
                     id="email" 
                     placeholder="name@company.com" 
                     required 
+                    value={formData.email ?? ""}
+                    readOnly={!!invitationToken}
                     onChange={handleChange} 
                     className="w-full rounded-lg border border-gray-300 px-4 py-2.5 text-gray-900 placeholder:text-gray-400 focus:border-blue-600 focus:outline-none focus:ring-1 focus:ring-blue-600 sm:text-sm"
                 />
@@ -79,6 +114,22 @@ export const LoginPage = (props: {
                 />
             </div>
 
+            {totpRequired && <div>
+                <label htmlFor="code" className="mb-2 block text-sm font-medium text-gray-700">
+                    Authentication code
+                </label>
+                <input 
+                    type="text" 
+                    id="code" 
+                    placeholder="123456 or recovery code" 
+                    autoComplete="one-time-code"
+                    autoFocus
+                    required 
+                    onChange={handleChange} 
+                    className="w-full rounded-lg border border-gray-300 px-4 py-2.5 text-gray-900 placeholder:text-gray-400 focus:border-blue-600 focus:outline-none focus:ring-1 focus:ring-blue-600 sm:text-sm"
+                />
+            </div>}
+
             <button 
                 type="submit"
                 className="w-full rounded-lg bg-blue-600 px-5 py-2.5 text-center text-sm font-medium text-white transition-colors hover:bg-blue-700 focus:outline-none focus:ring-4 focus:ring-blue-300"
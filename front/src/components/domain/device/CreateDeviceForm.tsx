@@ -78,6 +78,9 @@ export const CreateDeviceForm: React.FC<Props> = (props: Props) => {
               <option key="ble" value="ble">
                 Bluetooth
               </option>
+              <option key="basic" value="basic">
+                Basic (MQTT, ...)
+              </option>
           </select>
         </div>
 
@@ -27,5 +27,6 @@ export function useApi<T>(apiFunction: () => Promise<T>) {
     loading,
     error,
     refresh: execute,
+    setData,
   };
 }
\ No newline at end of file
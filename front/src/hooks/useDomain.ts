@@ -1,6 +1,8 @@
 import { api } from "../services/api";
-import type { DeviceCreateRequest } from "../types/device";
+import type { Device, DeviceCreateRequest, DeviceUpdateRequest } from "../types/device";
+import type { DeviceStateMessage } from "../types/topics";
 import { useApi } from "./useApi";
+import { useTopic } from "./useTopic";
 
 export function useAdapters() {
   const h = useApi(api.getAdapters);
@@ -36,6 +38,19 @@ export function useScanners() {
 export function useDevices() {
   const h = useApi(api.getDevices);
 
+  // Live readings, the snapshot replaces the list so no update is missed between the fetch and the subscription
+  useTopic<DeviceStateMessage, Device[]>("topic_device_state", update => {
+    h.setData(devices => devices && devices.map(d => d.id !== update.device_id ? d : {
+      ...d,
+      last_updated: update.timestamp,
+      available: true,
+      capabilities: {
+        ...d.capabilities,
+        [update.capability_type]: { ...d.capabilities[update.capability_type], name: update.capability_type, value: update.value, unit: update.unit },
+      },
+    }))
+  }, h.setData);
+
   const create = async (req: DeviceCreateRequest) => {
     await api.createDevice(req);
     h.refresh();
@@ -51,6 +66,11 @@ export function useDevices() {
     h.refresh();
   };
 
+  const update = async (deviceId: string, req: DeviceUpdateRequest) => {
+    await api.updateDevice(deviceId, req);
+    h.refresh();
+  };
+
   const deleteDevice = async (deviceId: string) => {
     await api.deleteDevice(deviceId);
     h.refresh();
@@ -62,6 +82,7 @@ export function useDevices() {
     devicesError: h.error,
     refreshDevices: h.refresh,
     createDevice: create,
+    updateDevice: update,
     linkAdapter: link,
     unlinkAdapter: unlink,
     deleteDevice: deleteDevice,
@@ -5,7 +5,8 @@ import { API_HOST, API_PORT, WS_PROTOCOL } from '../services/api';
 
 const WS_HOST =  `${WS_PROTOCOL}//${API_HOST}${API_PORT}` ;
 
-export const useTopic = <T> (topic: Topic, onMessage: (msg: T) => void) => {
+// onSnapshot receives the current state of the topic, sent by the server right after subscribing
+export const useTopic = <T, S = unknown> (topic: Topic, onMessage: (msg: T) => void, onSnapshot?: (snapshot: S) => void) => {
   const [isConnected, setIsConnected] = useState(false);
   const socketRef = useRef<WebSocket | null>(null);
 
@@ -30,7 +31,12 @@ export const useTopic = <T> (topic: Topic, onMessage: (msg: T) => void) => {
       try {
         const data = JSON.parse(event.data);
 
-        if (data.topic === topic) {
+        if (data.topic !== topic) {
+          return;
+        }
+        if (data.action === "snapshot") {
+          onSnapshot?.(data.message);
+        } else {
           onMessage(data.message);
         }
       } catch (err) {
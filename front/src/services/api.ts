@@ -1,7 +1,10 @@
 import type { Adapter } from "../types/adapter";
-import type { Device, DeviceCreateRequest } from "../types/device";
+import type { Area, AreaAggregate, AreaCreateRequest, AreaUpdateRequest } from "../types/area";
+import type { PluginCredential, PluginType } from "../types/broker";
+import type { Device, DeviceCreateRequest, DeviceUpdateRequest } from "../types/device";
 import type { Scanner } from "../types/scanner";
-import type { User } from "../types/user";
+import type { ImportMode, ImportResult, TransferFormat } from "../types/transfer";
+import type { ApiToken, ApiTokenScope, Invitation, Session, User, UserRole } from "../types/user";
 
 const env = import.meta.env.VITE_APP_ENV;
 
@@ -18,10 +21,14 @@ export class ApiService {
 
     // Bindings
     this.getAdapters = this.getAdapters.bind(this);
+    this.getAdapterDevices = this.getAdapterDevices.bind(this);
     this.getScanners = this.getScanners.bind(this);
     this.getDevices = this.getDevices.bind(this);
     this.createDevice = this.createDevice.bind(this);
     this.deleteDevice = this.deleteDevice.bind(this);
+    this.getAreas = this.getAreas.bind(this);
+    this.getAreaAggregates = this.getAreaAggregates.bind(this);
+    this.getAreaDevices = this.getAreaDevices.bind(this);
     this.linkDeviceToAdapter = this.linkDeviceToAdapter.bind(this);
     this.unlinkDeviceFromAdapter = this.unlinkDeviceFromAdapter.bind(this);
     this.startScanner = this.startScanner.bind(this)
@@ -29,9 +36,12 @@ export class ApiService {
     this.startAdapter = this.startAdapter.bind(this)
     this.stopAdapter = this.stopAdapter.bind(this)
     this.login = this.login.bind(this)
+    this.loginTotp = this.loginTotp.bind(this)
+    this.loginRecoveryCode = this.loginRecoveryCode.bind(this)
     this.register = this.register.bind(this)
     this.canRegister = this.canRegister.bind(this)
     this.me = this.me.bind(this)
+    this.getInvitation = this.getInvitation.bind(this)
   }
 
   private async getJson<T>(path: string): Promise<T> {
@@ -51,6 +61,17 @@ export class ApiService {
     return res.json();
   }
 
+  private async patch<T>(path: string, body: any): Promise<T> {
+    const res = await fetch(`${this.baseUrl}${path}`, {
+      method: "PATCH",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+      credentials: 'include', 
+    });
+    if (!res.ok) throw new Error(`Failed to patch ${path}: ${res.status}`);
+    return res.json();
+  }
+
   private async delete(path: string): Promise<void> {
     const res = await fetch(`${this.baseUrl}${path}`, { method: "DELETE", credentials: 'include' });
     if (!res.ok) throw new Error(`Failed to delete ${path}: ${res.status}`);
@@ -61,6 +82,10 @@ export class ApiService {
     return this.getJson<Adapter[]>("/adapters");
   }
 
+  async getAdapterDevices(id: string): Promise<Device[]> {
+    return this.getJson<Device[]>(`/adapters/${id}/devices`);
+  }
+
   async getScanners(): Promise<Scanner[]> {
     return this.getJson<Scanner[]>("/scanners");
   }
@@ -69,15 +94,43 @@ export class ApiService {
     return this.getJson<Device[]>("/devices");
   }
 
+  async getAreas(): Promise<Area[]> {
+    return this.getJson<Area[]>("/areas");
+  }
+
+  async getAreaAggregates(): Promise<AreaAggregate[]> {
+    return this.getJson<AreaAggregate[]>("/areas/aggregates");
+  }
+
+  async getAreaDevices(id: string): Promise<Device[]> {
+    return this.getJson<Device[]>(`/areas/${id}/devices`);
+  }
+
   // --- Actions ---
   async createDevice(req: DeviceCreateRequest): Promise<Device> {
     return this.post<Device>("/devices", req);
   }
 
+  async updateDevice(id: string, req: DeviceUpdateRequest): Promise<Device> {
+    return this.patch<Device>(`/devices/${id}`, req);
+  }
+
   async deleteDevice(id: string): Promise<void> {
     return this.delete(`/devices/${id}`);
   }
 
+  async createArea(req: AreaCreateRequest): Promise<Area> {
+    return this.post<Area>("/areas", req);
+  }
+
+  async updateArea(id: string, req: AreaUpdateRequest): Promise<Area> {
+    return this.patch<Area>(`/areas/${id}`, req);
+  }
+
+  async deleteArea(id: string): Promise<void> {
+    return this.delete(`/areas/${id}`);
+  }
+
   async linkDeviceToAdapter(deviceId: string, adapterId: string): Promise<void> {
     return this.post(`/devices/${deviceId}/adapters/${adapterId}`, {});
   }
@@ -103,18 +156,81 @@ export class ApiService {
   }
 
 
+  // --- Admin actions ---
+
+  async downloadBackup(): Promise<Blob> {
+    const res = await fetch(`${this.baseUrl}/admin/backup`, { method: "POST", credentials: 'include' });
+    if (!res.ok) throw new Error(`Failed to back up: ${res.status}`);
+    return res.blob();
+  }
+
+  async restoreBackup(file: File): Promise<void> {
+    const form = new FormData();
+    form.append("file", file);
+    const res = await fetch(`${this.baseUrl}/admin/restore`, { method: "POST", body: form, credentials: 'include' });
+    if (!res.ok) throw new Error(`Failed to restore: ${res.status} ${await res.text()}`);
+  }
+
+  async exportConfig(format: TransferFormat = "json", secrets = false): Promise<Blob> {
+    const res = await fetch(`${this.baseUrl}/admin/export?format=${format}&secrets=${secrets}`, { credentials: 'include' });
+    if (!res.ok) throw new Error(`Failed to export: ${res.status}`);
+    return res.blob();
+  }
+
+  // With dryRun nothing is changed, the result lists what the import would do
+  async importConfig(file: File, mode: ImportMode = "merge", dryRun = false): Promise<ImportResult> {
+    const format: TransferFormat = /\.ya?ml$/i.test(file.name) ? "yaml" : "json";
+    const res = await fetch(`${this.baseUrl}/admin/import?format=${format}&mode=${mode}&dry_run=${dryRun}`, { method: "POST", body: file, credentials: 'include' });
+    if (!res.ok) throw new Error(`Failed to import: ${res.status} ${await res.text()}`);
+    return res.json();
+  }
+
+  async getPluginCredentials(): Promise<PluginCredential[]> {
+    return this.getJson(`/admin/plugin-credentials`);
+  }
+
+  // Replaces the password of the plugin if it already has one, the password is only returned here
+  async issuePluginCredential(pluginId: string, pluginType: PluginType): Promise<PluginCredential & { username: string; password: string }> {
+    return this.post(`/admin/plugin-credentials`, { plugin_id: pluginId, plugin_type: pluginType });
+  }
+
+  async revokePluginCredential(pluginId: string): Promise<void> {
+    return this.delete(`/admin/plugin-credentials/${encodeURIComponent(pluginId)}`);
+  }
+
+
   // --- User actions ---
 
-  async login(email: string, password: string): Promise<void> {
+  async login(email: string, password: string): Promise<{ status: "logged" | "totp_required" }> {
     return this.post(`/users/login`, { email, password });
   }
 
+  async loginTotp(code: string): Promise<void> {
+    return this.post(`/users/login/totp`, { code });
+  }
+
+  async loginRecoveryCode(recoveryCode: string): Promise<void> {
+    return this.post(`/users/login/totp`, { recovery_code: recoveryCode });
+  }
+
+  async setupTotp(): Promise<{ secret: string; otpauth_uri: string }> {
+    return this.post(`/users/me/totp/setup`, {});
+  }
+
+  async enableTotp(code: string): Promise<{ recovery_codes: string[] }> {
+    return this.post(`/users/me/totp/enable`, { code });
+  }
+
+  async disableTotp(password: string): Promise<void> {
+    return this.post(`/users/me/totp/disable`, { password });
+  }
+
   async logout(): Promise<void> {
     return this.post(`/users/logout`, {});
   }
 
-  async register(email: string, password: string): Promise<void> {
-    return this.post(`/users/register`, { email, password });
+  async register(email: string, password: string, invitationToken?: string): Promise<void> {
+    return this.post(`/users/register`, { email, password, invitation_token: invitationToken });
   }
 
   async canRegister(): Promise<{can_register: boolean}> {
@@ -124,6 +240,72 @@ export class ApiService {
   async me(): Promise<User> {
     return this.getJson(`/users/me`);
   }
+
+  async changePassword(currentPassword: string, newPassword: string): Promise<void> {
+    return this.post(`/users/me/password`, { current_password: currentPassword, new_password: newPassword });
+  }
+
+  async resetPassword(token: string, password: string): Promise<void> {
+    return this.post(`/users/password_reset`, { token, password });
+  }
+
+  async logoutAll(): Promise<void> {
+    return this.post(`/users/logout_all`, {});
+  }
+
+  async getSessions(): Promise<Session[]> {
+    return this.getJson(`/users/me/sessions`);
+  }
+
+  async deleteSession(id: string): Promise<void> {
+    return this.delete(`/users/me/sessions/${id}`);
+  }
+
+  async getApiTokens(): Promise<ApiToken[]> {
+    return this.getJson(`/users/me/tokens`);
+  }
+
+  async createApiToken(name: string, scope: ApiTokenScope, expiresInDays?: number): Promise<ApiToken & { token: string }> {
+    return this.post(`/users/me/tokens`, { name, scope, expires_in_days: expiresInDays });
+  }
+
+  async deleteApiToken(id: string): Promise<void> {
+    return this.delete(`/users/me/tokens/${id}`);
+  }
+
+  // --- User management (admin) ---
+
+  async getUsers(): Promise<User[]> {
+    return this.getJson(`/users`);
+  }
+
+  async createUser(email: string, password: string, role: UserRole): Promise<User> {
+    return this.post(`/users`, { email, password, role });
+  }
+
+  async deleteUser(id: string): Promise<void> {
+    return this.delete(`/users/${id}`);
+  }
+
+  async createPasswordReset(userId: string): Promise<{ token: string; expires_at: string }> {
+    return this.post(`/users/${userId}/password_reset`, {});
+  }
+
+  async getInvitations(): Promise<Invitation[]> {
+    return this.getJson(`/users/invitations`);
+  }
+
+  async createInvitation(email: string, role: UserRole, expiresInHours?: number): Promise<Invitation & { token: string }> {
+    return this.post(`/users/invitations`, { email, role, expires_in_hours: expiresInHours });
+  }
+
+  async deleteInvitation(id: string): Promise<void> {
+    return this.delete(`/users/invitations/${id}`);
+  }
+
+  async getInvitation(token: string): Promise<{ email: string; role: UserRole; expires_at: string }> {
+    return this.getJson(`/users/invitations/${encodeURIComponent(token)}`);
+  }
 }
 
 export const api = new ApiService();
\ No newline at end of file
@@ -4,4 +4,5 @@ export interface Adapter {
   id: string;
   name: string;
   state: State;
+  status?: Record<string, unknown>;
 }
\ No newline at end of file
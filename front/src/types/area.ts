@@ -0,0 +1,35 @@
+import type { CapabilityType } from "./capability";
+import type { Unit } from "./units";
+
+
+export interface Area {
+  id: string;
+  name: string;
+  parent_id: string; // empty for top level areas
+  icon: string;
+  created_at: string;
+}
+
+export interface AreaCreateRequest {
+  name: string;
+  parent_id?: string;
+  icon?: string;
+}
+
+// Fields left out are not changed
+export type AreaUpdateRequest = Partial<Pick<Area, "name" | "parent_id" | "icon">>
+
+export interface CapabilityAverage {
+  value: number;
+  unit?: Unit;
+  count: number;
+}
+
+// Devices of the sub areas are included
+export interface AreaAggregate {
+  area_id: string;
+  name: string;
+  devices: number;
+  available: number;
+  averages: Partial<Record<CapabilityType, CapabilityAverage>>;
+}
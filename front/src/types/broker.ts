@@ -0,0 +1,8 @@
+export type PluginType = "plugin_adapter" | "plugin_scanner";
+
+// Lets a plugin connect to the embedded broker, restricted to its own topics
+export interface PluginCredential {
+  plugin_id: string;
+  plugin_type: PluginType;
+  created_at: string;
+}
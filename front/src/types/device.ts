@@ -10,6 +10,14 @@ export interface Device {
   created_at: string;
   capabilities: Record<CapabilityType, Capability>;
   last_updated: string;
+  available: boolean;
+  area_id: string;
+  area: string; // name of the area
+  icon: string;
+  manufacturer: string;
+  model: string;
+  notes: string;
+  tags: string[];
 }
 
 
@@ -18,4 +26,8 @@ export interface DeviceCreateRequest {
   address: string;
   address_type: string;
   adapter_ids: string[];
-}
\ No newline at end of file
+  area_id?: string;
+}
+
+// Fields left out are not changed
+export type DeviceUpdateRequest = Partial<Pick<Device, "name" | "address" | "address_type" | "area_id" | "icon" | "manufacturer" | "model" | "notes" | "tags">>
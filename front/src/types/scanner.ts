@@ -5,4 +5,5 @@ export interface Scanner {
   id: string;
   name: string;
   state: State;
+  status?: Record<string, unknown>;
 }
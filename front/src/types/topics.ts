@@ -1,8 +1,48 @@
+import type { Device } from "./device";
+import type { Capability } from "./capability";
+import type { State } from "./states";
 
-export type Topic = "topic_bluetooth_device"
+export type Topic =
+    | "topic_bluetooth_device"
+    | "topic_device_state"
+    | "topic_device_registered"
+    | "topic_device_removed"
+    | "topic_device_changed"
+    | "topic_device_availability"
+    | "topic_plugin_state"
+    | `device:${string}`
 
 export type BluetoothDeviceMessage = {
     name: string;
     address: string;
     protocols: string[];
-}
\ No newline at end of file
+}
+
+export type DeviceStateMessage = {
+    device_id: string;
+    name: string;
+    capability_type: Capability["name"];
+    timestamp: string;
+    value: any;
+    unit?: Capability["unit"];
+}
+
+export type DeviceAvailabilityMessage = {
+    device_id: string;
+    name: string;
+    available: boolean;
+    last_updated: string;
+}
+
+export type PluginEventMessage = {
+    type: "connected" | "state_changed" | "disconnected";
+    plugin: {
+        id: string;
+        name: string;
+        type: "plugin_adapter" | "plugin_scanner";
+        state: State;
+        status?: Record<string, unknown>;
+    };
+}
+
+export type DeviceMessage = Device
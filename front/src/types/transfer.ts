@@ -0,0 +1,21 @@
+export type TransferFormat = "json" | "yaml";
+
+// merge creates and updates, replace also deletes the devices and areas missing from the document
+export type ImportMode = "merge" | "replace";
+
+export interface ImportChange {
+  kind: "area" | "device" | "user" | "plugin";
+  id: string;
+  name: string;
+  action: "create" | "update" | "delete";
+  fields?: string[];
+  error?: string; // set when the change failed to apply
+}
+
+export interface ImportResult {
+  mode: ImportMode;
+  dry_run: boolean;
+  changes: ImportChange[];
+  warnings: string[];
+  failed: number;
+}
@@ -1,6 +1,41 @@
+export type UserRole = "admin" | "member" | "viewer";
 
 export type User = {
     id: string;
     email: string;
+    role: UserRole;
     created_at: string;
-}
\ No newline at end of file
+    totp_enabled: boolean;
+}
+
+export type Invitation = {
+    id: string;
+    email: string;
+    role: UserRole;
+    created_by: string;
+    expires_at: string;
+    created_at: string;
+}
+
+export type ApiTokenScope = "read" | "write";
+
+export type ApiToken = {
+    id: string;
+    user_id: string;
+    name: string;
+    scope: ApiTokenScope;
+    expires_at?: string;
+    last_used_at?: string;
+    created_at: string;
+}
+
+export type Session = {
+    id: string;
+    user_id: string;
+    ip: string;
+    user_agent: string;
+    created_at: string;
+    last_seen_at: string;
+    expires_at: string;
+    current: boolean;
+}
@@ -0,0 +1,151 @@
+package broker
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// lifecycleTopics carry the plugin itself, a plugin may only publish them about itself
+var lifecycleTopics = []events.EventType{
+	events.PluginConnected,
+	events.PluginDisconnected,
+	events.PluginStateChanged,
+	events.PluginAck,
+	events.PluginNegativeAck,
+}
+
+// PluginTopics lists what a plugin may publish and subscribe to under gohome/. Other topics are left open,
+// the MQTT scanner and adapter talk to devices through the same broker.
+func PluginTopics(id string, pluginType plugin.PluginType) (publish, subscribe []events.EventType) {
+	publish = append(slices.Clone(lifecycleTopics), events.PluginState(id))
+	subscribe = []events.EventType{events.PluginStart(id), events.PluginStop(id)}
+
+	switch pluginType {
+	case plugin.PluginScanner:
+		publish = append(publish, events.ParsedDataReceived, events.BluetoothDeviceFound)
+	case plugin.PluginAdapter:
+		subscribe = append(subscribe,
+			events.RegisterDeviceForAdapter(id),
+			events.UnregisterDeviceForAdapter(id),
+			events.UpdateDataForAdapter(id),
+			events.UpdateDeviceForAdapter(id),
+		)
+	}
+	return publish, subscribe
+}
+
+// pluginAllowed checks a topic, or a subscription filter, against the topics of the plugin
+func pluginAllowed(credential *core.PluginCredential, topic string, write bool) bool {
+	first, _, _ := strings.Cut(topic, "/")
+	if first != "gohome" && first != "+" && first != "#" {
+		return true
+	}
+	publish, subscribe := PluginTopics(credential.PluginID, credential.PluginType)
+	if write {
+		return slices.Contains(publish, events.EventType(topic))
+	}
+	return slices.Contains(subscribe, events.EventType(topic))
+}
+
+// accessHook authenticates the core account and the plugin credentials, and restricts the plugins to their topics
+type accessHook struct {
+	mqtt.HookBase
+	username    string
+	password    string
+	credentials core.PluginCredentialRepository
+
+	clients sync.Map // *mqtt.Client to its *core.PluginCredential, nil for the core account
+}
+
+func (h *accessHook) ID() string {
+	return "gohome-access"
+}
+
+func (h *accessHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mqtt.OnConnectAuthenticate,
+		mqtt.OnACLCheck,
+		mqtt.OnPublish,
+		mqtt.OnDisconnect,
+	}, []byte{b})
+}
+
+func (h *accessHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	username, password := string(pk.Connect.Username), pk.Connect.Password
+	if username == h.username && subtle.ConstantTimeCompare(password, []byte(h.password)) == 1 {
+		h.clients.Store(cl, (*core.PluginCredential)(nil))
+		return true
+	}
+	if h.credentials == nil {
+		return false
+	}
+
+	credential, err := h.credentials.FindByPluginID(username)
+	if err != nil {
+		log.Printf("[Broker] Failed to find the credential of %s: %v", username, err)
+		return false
+	}
+	if credential == nil || subtle.ConstantTimeCompare([]byte(security.HashToken(string(password))), []byte(credential.PasswordHash)) != 1 {
+		return false
+	}
+	// The broker publishes the will without going through the other hooks
+	if topic := pk.Connect.WillTopic; pk.Connect.WillFlag && (!pluginAllowed(credential, topic, true) || forged(credential, topic, willPayload(pk))) {
+		log.Printf("[Broker] Refused %s, its will on %s is not about this plugin", credential.PluginID, topic)
+		return false
+	}
+	h.clients.Store(cl, credential)
+	return true
+}
+
+func (h *accessHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+	value, ok := h.clients.Load(cl)
+	if !ok {
+		return false
+	}
+	credential := value.(*core.PluginCredential)
+	return credential == nil || pluginAllowed(credential, topic, write)
+}
+
+// OnPublish drops the lifecycle events a plugin sends about another plugin. They are still acked, the plugin
+// would otherwise send them again on each reconnection.
+func (h *accessHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	value, _ := h.clients.Load(cl)
+	credential, _ := value.(*core.PluginCredential)
+	if credential != nil && forged(credential, pk.TopicName, pk.Payload) {
+		log.Printf("[Broker] Rejected %s from %s, it is not about this plugin", pk.TopicName, credential.PluginID)
+		return pk, packets.CodeSuccessIgnore
+	}
+	return pk, nil
+}
+
+// forged reports a lifecycle event or a state published by a plugin about another plugin
+func forged(credential *core.PluginCredential, topic string, payload []byte) bool {
+	if events.EventType(topic) == events.PluginState(credential.PluginID) {
+		if len(payload) == 0 {
+			// The plugin clears its retained state
+			return false
+		}
+	} else if !slices.Contains(lifecycleTopics, events.EventType(topic)) {
+		return false
+	}
+
+	var p plugin.Plugin
+	err := json.Unmarshal(payload, &p)
+	return err != nil || p.ID != credential.PluginID || p.Type != credential.PluginType
+}
+
+func (h *accessHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	h.clients.Delete(cl)
+}
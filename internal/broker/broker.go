@@ -0,0 +1,117 @@
+package broker
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/bolt"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+type Options struct {
+	Address        string // listener of the MQTT 3.1.1 and 5 clients, ":1883"
+	Username       string // account of the core, allowed every topic. Empty allows anonymous clients
+	Password       string
+	PersistenceDir string // sessions and retained messages are kept in memory when empty
+	CertFile       string // TLS certificate and key of the listener, plain TCP when empty
+	KeyFile        string
+
+	// Plugins connect with the credentials issued by the core, restricted to their own topics
+	Credentials core.PluginCredentialRepository
+}
+
+// Broker is an MQTT broker running inside the core, so no Mosquitto is needed. The core and the plugins
+// connect to it like to any other broker.
+type Broker struct {
+	server   *mqtt.Server
+	listener *listeners.TCP
+	options  Options
+}
+
+// Start listens on the address, the returned broker is serving clients
+func Start(options Options) (*Broker, error) {
+	if (options.Username == "") != (options.Password == "") {
+		return nil, errors.New("the embedded broker needs both a username and a password, or neither")
+	}
+
+	server := mqtt.New(&mqtt.Options{
+		// Connections and subscriptions are logged at info, only problems are worth the core log
+		Logger: slog.New(slog.NewTextHandler(log.Writer(), &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+
+	if err := server.AddHook(new(emptyWillHook), nil); err != nil {
+		return nil, err
+	}
+	if options.Username == "" {
+		log.Println("[Broker] Anonymous clients are allowed, plugins are not restricted to their topics")
+		if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+			return nil, err
+		}
+	} else {
+		hook := &accessHook{username: options.Username, password: options.Password, credentials: options.Credentials}
+		if err := server.AddHook(hook, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.PersistenceDir != "" {
+		if err := os.MkdirAll(options.PersistenceDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create the broker persistence directory: %w", err)
+		}
+		path := filepath.Join(options.PersistenceDir, "broker.db")
+		if err := server.AddHook(new(bolt.Hook), &bolt.Options{Path: path}); err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+	}
+
+	listenerConfig := listeners.Config{ID: "tcp", Address: options.Address}
+	if options.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			server.Close()
+			return nil, fmt.Errorf("failed to load the broker certificate: %w", err)
+		}
+		listenerConfig.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	listener := listeners.NewTCP(listenerConfig)
+	if err := server.AddListener(listener); err != nil {
+		server.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", options.Address, err)
+	}
+	if err := server.Serve(); err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	log.Printf("[Broker] Embedded MQTT broker listening on %s", listener.Address())
+	return &Broker{server: server, listener: listener, options: options}, nil
+}
+
+// URL of the broker from the same host, for the event bus of the core
+func (b *Broker) URL() string {
+	host, port, err := net.SplitHostPort(b.listener.Address())
+	if err != nil {
+		return "tcp://" + b.listener.Address()
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "tcp"
+	if b.options.CertFile != "" {
+		scheme = "ssl"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
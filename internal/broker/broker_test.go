@@ -0,0 +1,250 @@
+package broker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type credentials map[string]*core.PluginCredential
+
+func (c credentials) Save(credential *core.PluginCredential) error {
+	c[credential.PluginID] = credential
+	return nil
+}
+
+func (c credentials) Delete(pluginID string) (bool, error) {
+	_, ok := c[pluginID]
+	delete(c, pluginID)
+	return ok, nil
+}
+
+func (c credentials) FindAll() ([]*core.PluginCredential, error) {
+	var all []*core.PluginCredential
+	for _, credential := range c {
+		all = append(all, credential)
+	}
+	return all, nil
+}
+
+func (c credentials) FindByPluginID(pluginID string) (*core.PluginCredential, error) {
+	return c[pluginID], nil
+}
+
+func startTestBroker(t *testing.T, options Options) *Broker {
+	t.Helper()
+	options.Address = "127.0.0.1:0"
+	b, err := Start(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func connect(t *testing.T, b *Broker, clientID, username, password string) *events.MQTTEventBus {
+	t.Helper()
+	eb, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: b.URL(), BrokerUsername: username, BrokerPassword: password}, clientID)
+	if err != nil {
+		t.Fatalf("%s failed to connect %v", clientID, err)
+	}
+	t.Cleanup(eb.Close)
+	return eb
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("Event not delivered through the broker")
+	}
+	var zero T
+	return zero
+}
+
+func TestEventBusThroughEmbeddedBroker(t *testing.T) {
+	dir := t.TempDir()
+	b := startTestBroker(t, Options{Username: "gohome", Password: "secret", PersistenceDir: dir})
+
+	if _, err := os.Stat(filepath.Join(dir, "broker.db")); err != nil {
+		t.Fatalf("Persistence file not created %v", err)
+	}
+	if _, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: b.URL(), BrokerUsername: "gohome", BrokerPassword: "wrong"}, "intruder"); err == nil {
+		t.Fatal("Connected with a wrong password")
+	}
+
+	coreBus := connect(t, b, "core", "gohome", "secret")
+	other := connect(t, b, "other", "gohome", "secret")
+
+	received := make(chan string, 1)
+	if err := events.Subscribe(coreBus, events.PluginConnected, func(p plugin.Plugin) { received <- p.ID }); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Publish(events.Event{Type: events.PluginConnected, Payload: plugin.Plugin{ID: "homekit"}}); err != nil {
+		t.Fatal(err)
+	}
+	if id := receive(t, received); id != "homekit" {
+		t.Fatalf("Received %s", id)
+	}
+}
+
+func TestPluginsAreRestrictedToTheirTopics(t *testing.T) {
+	creds := credentials{
+		"homekit": {PluginID: "homekit", PluginType: plugin.PluginAdapter, PasswordHash: security.HashToken("homekit-password")},
+	}
+	b := startTestBroker(t, Options{Username: "gohome", Password: "secret", Credentials: creds})
+
+	if _, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: b.URL(), BrokerUsername: "homekit", BrokerPassword: "secret"}, "homekit"); err == nil {
+		t.Fatal("A plugin connected with the password of the core")
+	}
+	// Its will may only clear its own state
+	conn := config.BrokerConnection{BrokerUrl: b.URL(), BrokerUsername: "homekit", BrokerPassword: "homekit-password"}
+	forgedWill := events.WithWill(events.Event{Type: events.PluginState("homekit"), Payload: plugin.Plugin{ID: "bluetooth", Type: plugin.PluginScanner}})
+	if _, err := events.NewMQTTEventBus(conn, "homekit", forgedWill); err == nil {
+		t.Fatal("A plugin connected with a will about another plugin")
+	}
+	if _, err := events.NewMQTTEventBus(conn, "homekit", plugin.StateWill("bluetooth")); err == nil {
+		t.Fatal("A plugin connected with a will on the state of another plugin")
+	}
+	withWill, err := events.NewMQTTEventBus(conn, "homekit", plugin.StateWill("homekit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withWill.Close()
+
+	coreBus := connect(t, b, "core", "gohome", "secret")
+	adapter := connect(t, b, "homekit", "homekit", "homekit-password")
+
+	connected := make(chan string, 10)
+	events.Subscribe(coreBus, events.PluginConnected, func(p plugin.Plugin) { connected <- p.ID })
+	parsed := make(chan types.ParsedData, 10)
+	events.Subscribe(coreBus, events.ParsedDataReceived, func(d types.ParsedData) { parsed <- d })
+
+	// An adapter does not send data and cannot pretend to be another plugin
+	adapter.Publish(events.Event{Type: events.ParsedDataReceived, Payload: types.ParsedData{Address: "fake"}})
+	adapter.Publish(events.Event{Type: events.PluginConnected, Payload: plugin.Plugin{ID: "bluetooth", Type: plugin.PluginScanner}})
+	adapter.Publish(events.Event{Type: events.PluginConnected, Payload: plugin.Plugin{ID: "homekit", Type: plugin.PluginAdapter}})
+	if id := receive(t, connected); id != "homekit" {
+		t.Fatalf("Received the connection of %s", id)
+	}
+	if len(parsed) != 0 {
+		t.Fatal("An adapter published parsed data")
+	}
+
+	// It only receives the commands sent to it
+	starts := make(chan struct{}, 10)
+	events.Subscribe(adapter, events.PluginStart("bluetooth"), func(any) { starts <- struct{}{} })
+	events.Subscribe(adapter, events.PluginStart("homekit"), func(any) { starts <- struct{}{} })
+	coreBus.Publish(events.Event{Type: events.PluginStart("bluetooth")})
+	coreBus.Publish(events.Event{Type: events.PluginStart("homekit")})
+	receive(t, starts)
+	time.Sleep(100 * time.Millisecond)
+	if len(starts) != 0 {
+		t.Fatal("The adapter received the command of another plugin")
+	}
+}
+
+func TestPluginAllowed(t *testing.T) {
+	scanner := &core.PluginCredential{PluginID: "ble", PluginType: plugin.PluginScanner}
+	tests := []struct {
+		topic string
+		write bool
+		allow bool
+	}{
+		{string(events.ParsedDataReceived), true, true},
+		{string(events.PluginStop("ble")), false, true},
+		{string(events.PluginStop("other")), false, false},
+		{string(events.PluginStop("ble")), true, false},
+		{string(events.RegisterDeviceForAdapter("ble")), false, false},
+		{string(events.PluginState("ble")), true, true},
+		{string(events.PluginState("other")), true, false},
+		{"gohome/#", false, false},
+		{"#", false, false},
+		{"zigbee2mqtt/+", false, true},
+		{"home/kitchen/temperature", true, true},
+	}
+	for _, test := range tests {
+		if pluginAllowed(scanner, test.topic, test.write) != test.allow {
+			t.Fatalf("pluginAllowed(%s, write %v) should be %v", test.topic, test.write, test.allow)
+		}
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	b := startTestBroker(t, Options{Username: "gohome", Password: "secret", CertFile: certFile, KeyFile: keyFile})
+	if !strings.HasPrefix(b.URL(), "ssl://") {
+		t.Fatalf("Expected an ssl url, got %s", b.URL())
+	}
+
+	conn := config.BrokerConnection{BrokerUrl: b.URL(), BrokerUsername: "gohome", BrokerPassword: "secret"}
+	if _, err := events.NewMQTTEventBus(conn, "untrusted"); err == nil {
+		t.Fatal("Connected without trusting the broker certificate")
+	}
+	conn.BrokerCAFile = certFile
+	eb, err := events.NewMQTTEventBus(conn, "core")
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS %v", err)
+	}
+	eb.Close()
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1, it is its own authority
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gohome test broker"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	return certFile, keyFile
+}
+
+func TestStartRefusesPartialCredentials(t *testing.T) {
+	if _, err := Start(Options{Address: "127.0.0.1:0", Username: "gohome"}); err == nil {
+		t.Fatal("Started with a username and no password")
+	}
+}
@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"bytes"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// emptyWill stands for an empty will payload between the read of the connect packet and the will being sent.
+// MQTT allows an empty will, the way a plugin clears its retained state when it crashes, mochi refuses it.
+var emptyWill = []byte{0}
+
+// emptyWillHook carries the empty wills through the connect validation of mochi
+type emptyWillHook struct {
+	mqtt.HookBase
+}
+
+func (h *emptyWillHook) ID() string {
+	return "gohome-empty-will"
+}
+
+func (h *emptyWillHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mqtt.OnPacketRead,
+		mqtt.OnWill,
+	}, []byte{b})
+}
+
+func (h *emptyWillHook) OnPacketRead(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	if pk.FixedHeader.Type == packets.Connect && pk.Connect.WillFlag && len(pk.Connect.WillPayload) == 0 {
+		pk.Connect.WillPayload = emptyWill
+	}
+	return pk, nil
+}
+
+func (h *emptyWillHook) OnWill(cl *mqtt.Client, will mqtt.Will) (mqtt.Will, error) {
+	if bytes.Equal(will.Payload, emptyWill) {
+		will.Payload = nil
+	}
+	return will, nil
+}
+
+// willPayload is the will of the connect packet, as it will be sent
+func willPayload(pk packets.Packet) []byte {
+	if bytes.Equal(pk.Connect.WillPayload, emptyWill) {
+		return nil
+	}
+	return pk.Connect.WillPayload
+}
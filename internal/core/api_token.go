@@ -0,0 +1,45 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+type TokenScope string
+
+const (
+	ScopeRead  TokenScope = "read"  // like a viewer, whatever the role of the owner
+	ScopeWrite TokenScope = "write" // same permissions as the owner
+)
+
+func ParseTokenScope(s string) (TokenScope, error) {
+	switch scope := TokenScope(s); scope {
+	case ScopeRead, ScopeWrite:
+		return scope, nil
+	}
+	return "", fmt.Errorf("invalid scope %q", s)
+}
+
+// ApiToken is a personal access token for scripts, only the hash of the token is stored
+type ApiToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scope      TokenScope `json:"scope"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *ApiToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// Role granted to a request authenticated with this token
+func (t *ApiToken) EffectiveRole(owner *User) Role {
+	if t.Scope == ScopeRead && owner.Role.Allows(RoleViewer) {
+		return RoleViewer
+	}
+	return owner.Role
+}
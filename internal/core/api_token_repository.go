@@ -0,0 +1,12 @@
+package core
+
+import "time"
+
+type ApiTokenRepository interface {
+	Save(token *ApiToken) error
+	UpdateLastUsed(id string, lastUsed time.Time) error
+	Delete(id string, userID string) (bool, error)
+	DeleteByUser(userID string) error
+	FindByUser(userID string) ([]*ApiToken, error)
+	FindByTokenHash(tokenHash string) (*ApiToken, error)
+}
@@ -0,0 +1,10 @@
+package core
+
+import "github.com/Bastien2203/go-home/shared/types"
+
+type AreaRepository interface {
+	Save(area *types.Area) error
+	FindByID(id string) (*types.Area, error)
+	FindAll() ([]*types.Area, error)
+	Delete(id string) error
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/Bastien2203/go-home/shared/types"
+	"github.com/Bastien2203/go-home/utils"
+)
+
+// Areas are few and read for every device, the kernel keeps them in memory
+func (k *Kernel) loadAreas() error {
+	areas, err := k.areaRepository.FindAll()
+	if err != nil {
+		return fmt.Errorf("failed to load areas: %w", err)
+	}
+
+	k.areasMu.Lock()
+	defer k.areasMu.Unlock()
+	k.areas = make(map[string]*types.Area, len(areas))
+	for _, area := range areas {
+		k.areas[area.ID] = area
+	}
+	return nil
+}
+
+func (k *Kernel) areaName(areaID string) string {
+	if areaID == "" {
+		return ""
+	}
+	k.areasMu.RLock()
+	defer k.areasMu.RUnlock()
+	if area, ok := k.areas[areaID]; ok {
+		return area.Name
+	}
+	return ""
+}
+
+func (k *Kernel) ListAreas() []*types.Area {
+	k.areasMu.RLock()
+	defer k.areasMu.RUnlock()
+
+	areas := make([]*types.Area, 0, len(k.areas))
+	for _, area := range k.areas {
+		c := *area
+		areas = append(areas, &c)
+	}
+	slices.SortFunc(areas, func(a, b *types.Area) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return areas
+}
+
+func (k *Kernel) GetArea(id string) (*types.Area, error) {
+	k.areasMu.RLock()
+	defer k.areasMu.RUnlock()
+
+	area, ok := k.areas[id]
+	if !ok {
+		return nil, fmt.Errorf("area not found: %s", id)
+	}
+	c := *area
+	return &c, nil
+}
+
+func (k *Kernel) CreateArea(area *types.Area) error {
+	k.areasMu.Lock()
+	defer k.areasMu.Unlock()
+
+	if err := k.validateArea(area); err != nil {
+		return err
+	}
+	if err := k.areaRepository.Save(area); err != nil {
+		return err
+	}
+	c := *area
+	k.areas[area.ID] = &c
+
+	log.Printf("[Kernel] Area created: %s (ID: %s)", area.Name, area.ID)
+	return nil
+}
+
+// UpdateArea applies edit to the area, devices in the area are sent to their adapters when it is renamed
+func (k *Kernel) UpdateArea(id string, edit func(area *types.Area) error) (*types.Area, error) {
+	k.areasMu.Lock()
+	current, ok := k.areas[id]
+	if !ok {
+		k.areasMu.Unlock()
+		return nil, fmt.Errorf("area not found: %s", id)
+	}
+
+	area := *current
+	if err := edit(&area); err != nil {
+		k.areasMu.Unlock()
+		return nil, err
+	}
+	area.ID = id
+	if err := k.validateArea(&area); err != nil {
+		k.areasMu.Unlock()
+		return nil, err
+	}
+	if err := k.areaRepository.Save(&area); err != nil {
+		k.areasMu.Unlock()
+		return nil, err
+	}
+	renamed := current.Name != area.Name
+	updated := area
+	k.areas[id] = &updated
+	k.areasMu.Unlock()
+
+	log.Printf("[Kernel] Area updated: %s (ID: %s)", area.Name, area.ID)
+	if renamed {
+		k.notifyAreaDevices(id)
+	}
+	return &area, nil
+}
+
+// DeleteArea moves the children of the area to its parent, its devices no longer have an area
+func (k *Kernel) DeleteArea(id string) error {
+	devices, err := k.devicesInAreas(map[string]bool{id: true})
+	if err != nil {
+		return err
+	}
+
+	k.areasMu.Lock()
+	area, ok := k.areas[id]
+	if !ok {
+		k.areasMu.Unlock()
+		return fmt.Errorf("area not found: %s", id)
+	}
+	if err := k.areaRepository.Delete(id); err != nil {
+		k.areasMu.Unlock()
+		return err
+	}
+	for _, child := range k.areas {
+		if child.ParentID == id {
+			child.ParentID = area.ParentID
+		}
+	}
+	delete(k.areas, id)
+	k.areasMu.Unlock()
+
+	log.Printf("[Kernel] Area deleted: %s (ID: %s)", area.Name, area.ID)
+	for _, device := range devices {
+		if device, err := k.GetDevice(device.ID); err == nil && device != nil {
+			k.notifyDeviceChanged(device)
+		}
+	}
+	return nil
+}
+
+// validateArea must be called with areasMu held
+func (k *Kernel) validateArea(area *types.Area) error {
+	area.Name = strings.TrimSpace(area.Name)
+	if area.Name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	for _, other := range k.areas {
+		if other.ID != area.ID && strings.EqualFold(other.Name, area.Name) {
+			return fmt.Errorf("area %s already exists", other.Name)
+		}
+	}
+
+	// The parent cannot be the area itself or one of its descendants
+	for parentID := area.ParentID; parentID != ""; {
+		if parentID == area.ID {
+			return fmt.Errorf("an area cannot be inside itself")
+		}
+		parent, ok := k.areas[parentID]
+		if !ok {
+			return fmt.Errorf("parent area not found: %s", parentID)
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+func (k *Kernel) notifyAreaDevices(id string) {
+	devices, err := k.devicesInAreas(map[string]bool{id: true})
+	if err != nil {
+		log.Printf("[Kernel] Warning: failed to list devices of area %s: %v", id, err)
+		return
+	}
+	for _, device := range devices {
+		k.notifyDeviceChanged(device)
+	}
+}
+
+// AreaDevices returns the devices in the area or in one of its descendants
+func (k *Kernel) AreaDevices(id string) ([]*types.Device, error) {
+	if _, err := k.GetArea(id); err != nil {
+		return nil, err
+	}
+	return k.devicesInAreas(k.descendants(id))
+}
+
+func (k *Kernel) devicesInAreas(areaIDs map[string]bool) ([]*types.Device, error) {
+	devices, err := k.ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(devices, func(d *types.Device) bool {
+		return !areaIDs[d.AreaID]
+	}), nil
+}
+
+// descendants returns the area and all the areas inside it
+func (k *Kernel) descendants(id string) map[string]bool {
+	k.areasMu.RLock()
+	defer k.areasMu.RUnlock()
+
+	ids := map[string]bool{id: true}
+	for added := true; added; {
+		added = false
+		for _, area := range k.areas {
+			if ids[area.ParentID] && !ids[area.ID] {
+				ids[area.ID] = true
+				added = true
+			}
+		}
+	}
+	return ids
+}
+
+type CapabilityAverage struct {
+	Value float64    `json:"value"`
+	Unit  types.Unit `json:"unit,omitempty"`
+	Count int        `json:"count"` // number of devices averaged
+}
+
+type AreaAggregate struct {
+	AreaID    string                                      `json:"area_id"`
+	Name      string                                      `json:"name"`
+	Devices   int                                         `json:"devices"`
+	Available int                                         `json:"available"`
+	Averages  map[types.CapabilityType]*CapabilityAverage `json:"averages"`
+}
+
+// AreaAggregates averages the numeric readings of the available devices of each area, devices count
+// in their area and in all the areas containing it
+func (k *Kernel) AreaAggregates() ([]*AreaAggregate, error) {
+	devices, err := k.ListDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	areas := k.ListAreas()
+	aggregates := make(map[string]*AreaAggregate, len(areas))
+	parents := make(map[string]string, len(areas))
+	for _, area := range areas {
+		aggregates[area.ID] = &AreaAggregate{
+			AreaID:   area.ID,
+			Name:     area.Name,
+			Averages: make(map[types.CapabilityType]*CapabilityAverage),
+		}
+		parents[area.ID] = area.ParentID
+	}
+
+	for _, device := range devices {
+		for areaID := device.AreaID; areaID != ""; areaID = parents[areaID] {
+			aggregate, ok := aggregates[areaID]
+			if !ok {
+				break
+			}
+			aggregate.Devices++
+			if !device.Available {
+				continue
+			}
+			aggregate.Available++
+			for name, c := range device.Capabilities {
+				value, ok := utils.ToFloat(c.Value)
+				if !ok {
+					continue
+				}
+				average, ok := aggregate.Averages[name]
+				if !ok {
+					average = &CapabilityAverage{Unit: c.Unit}
+					aggregate.Averages[name] = average
+				}
+				if average.Unit != c.Unit {
+					// Readings in another unit cannot be averaged together
+					continue
+				}
+				// Running mean
+				average.Count++
+				average.Value += (value - average.Value) / float64(average.Count)
+			}
+		}
+	}
+
+	return utils.Map(areas, func(area *types.Area) *AreaAggregate {
+		return aggregates[area.ID]
+	}), nil
+}
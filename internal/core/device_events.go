@@ -0,0 +1,35 @@
+package core
+
+import (
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type DeviceEventType string
+
+const (
+	DeviceRegistered   DeviceEventType = "registered"
+	DeviceUpdated      DeviceEventType = "updated" // new state received
+	DeviceChanged      DeviceEventType = "changed" // name, address or metadata edited
+	DeviceAvailability DeviceEventType = "availability"
+	DeviceRemoved      DeviceEventType = "removed"
+)
+
+// DeviceEvent carries the device as it is after the change, with its live state
+type DeviceEvent struct {
+	Type   DeviceEventType `json:"type"`
+	Device *types.Device   `json:"device"`
+}
+
+type PluginEventType string
+
+const (
+	PluginConnected    PluginEventType = "connected"
+	PluginStateChanged PluginEventType = "state_changed"
+	PluginDisconnected PluginEventType = "disconnected"
+)
+
+type PluginEvent struct {
+	Type   PluginEventType `json:"type"`
+	Plugin *plugin.Plugin  `json:"plugin"`
+}
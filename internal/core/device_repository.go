@@ -1,11 +1,19 @@
 package core
 
-import "github.com/Bastien2203/go-home/shared/types"
+import (
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
 
 type DeviceRepository interface {
 	Save(device *types.Device) error
+	Update(device *types.Device) error
+	// SaveState keeps the latest readings of a device across restarts
+	SaveState(deviceID string, capabilities []*types.Capability, lastUpdated time.Time) error
 	FindByID(id string) (*types.Device, error)
 	FindAll() ([]*types.Device, error)
+	FindByAdapter(adapterID string) ([]*types.Device, error)
 	LinkAdapter(deviceID, adapterID string) error
 	UnlinkAdapter(deviceID, adapterID string) error
 	FindByAddress(address string, addressType types.AddressType) (*types.Device, error)
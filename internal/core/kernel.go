@@ -14,26 +14,42 @@ import (
 )
 
 type Kernel struct {
-	eventBus      *events.EventBus
-	repository    DeviceRepository
-	mu            map[string]*sync.Mutex
-	muLock        sync.Mutex
-	pluginManager *PluginManager
-	processes     map[string]*exec.Cmd
+	eventBus       events.EventBus
+	repository     DeviceRepository
+	areaRepository AreaRepository
+	mu             map[string]*sync.Mutex
+	muLock         sync.Mutex
+	pluginManager  *PluginManager
+	processes      map[string]*exec.Cmd
+
+	liveMu sync.RWMutex
+	live   map[string]*liveState
+
+	areasMu sync.RWMutex
+	areas   map[string]*types.Area
+
+	stateListeners  listeners[types.DeviceStateUpdate]
+	deviceListeners listeners[DeviceEvent]
 }
 
-func NewKernel(eventBus *events.EventBus, repository DeviceRepository) (*Kernel, error) {
+func NewKernel(eventBus events.EventBus, repository DeviceRepository, areaRepository AreaRepository) (*Kernel, error) {
 	pluginManager, err := NewPluginManager(eventBus)
 	if err != nil {
 		return nil, err
 	}
 
 	kernel := &Kernel{
-		eventBus:      eventBus,
-		repository:    repository,
-		mu:            make(map[string]*sync.Mutex),
-		processes:     make(map[string]*exec.Cmd),
-		pluginManager: pluginManager,
+		eventBus:       eventBus,
+		repository:     repository,
+		areaRepository: areaRepository,
+		mu:             make(map[string]*sync.Mutex),
+		processes:      make(map[string]*exec.Cmd),
+		pluginManager:  pluginManager,
+		live:           make(map[string]*liveState),
+	}
+
+	if err := kernel.loadAreas(); err != nil {
+		return nil, err
 	}
 
 	if err := events.Subscribe(eventBus, events.ParsedDataReceived, kernel.handleStateUpdate); err != nil {
@@ -49,33 +65,64 @@ func (k *Kernel) handleStateUpdate(parsedData types.ParsedData) {
 		return
 	}
 
-	device.LastUpdated = parsedData.Timestamp
+	becameAvailable := k.updateLiveState(device.ID, parsedData.Data, parsedData.Timestamp)
+	device = k.decorate(device)
 
-	mu := k.getMutex(device.ID)
-	mu.Lock()
+	updates := make([]types.DeviceStateUpdate, 0, len(parsedData.Data))
 	for _, c := range parsedData.Data {
-		device.Capabilities[c.Name] = c
+		updates = append(updates, types.DeviceStateUpdate{
+			DeviceID:       device.ID,
+			DeviceName:     device.Name,
+			CapabilityType: c.Name,
+			Timestamp:      parsedData.Timestamp,
+			Value:          c.Value,
+			Unit:           c.Unit,
+		})
 	}
-	// TODO : Save updated device (but its too much intensive to do it for each data update)
-	// k.repository.Save(device)
-	mu.Unlock()
 
 	for _, adapterID := range device.AdapterIDs {
 		go func(adapterID string) {
-			for _, c := range parsedData.Data {
+			for _, update := range updates {
 				k.eventBus.Publish(events.Event{
-					Type: events.UpdateDataForAdapter(adapterID),
-					Payload: types.DeviceStateUpdate{
-						DeviceID:       device.ID,
-						DeviceName:     device.Name,
-						CapabilityType: c.Name,
-						Timestamp:      parsedData.Timestamp,
-						Value:          c.Value,
-					},
+					Type:    events.UpdateDataForAdapter(adapterID),
+					Payload: update,
 				})
 			}
 		}(adapterID)
 	}
+
+	for _, update := range updates {
+		k.stateListeners.notify(update)
+	}
+	if becameAvailable {
+		k.deviceListeners.notify(DeviceEvent{Type: DeviceAvailability, Device: device})
+	}
+	k.deviceListeners.notify(DeviceEvent{Type: DeviceUpdated, Device: device})
+}
+
+// Listener is called synchronously for every state update of a registered device, it must not block
+func (k *Kernel) OnDeviceStateUpdate(listener func(update types.DeviceStateUpdate)) {
+	k.stateListeners.add(listener)
+}
+
+// Listener is called synchronously when a device is registered, removed, updated or changes availability, it must not block
+func (k *Kernel) OnDeviceEvent(listener func(event DeviceEvent)) {
+	k.deviceListeners.add(listener)
+}
+
+// Listener is called synchronously when a plugin connects, disconnects or changes state, it must not block
+func (k *Kernel) OnPluginEvent(listener func(event PluginEvent)) {
+	k.pluginManager.listeners.add(listener)
+}
+
+// decorate sets the fields computed by the core on a device loaded from the repository
+func (k *Kernel) decorate(device *types.Device) *types.Device {
+	if device == nil {
+		return nil
+	}
+	k.applyLiveState(device)
+	device.Area = k.areaName(device.AreaID)
+	return device
 }
 
 func (k *Kernel) getMutex(deviceID string) *sync.Mutex {
@@ -170,12 +217,16 @@ func (k *Kernel) StopAdapters() {
 // --- Devices Management ---
 
 func (k *Kernel) RegisterDevice(device *types.Device) error {
+	if device.AreaID != "" && k.areaName(device.AreaID) == "" {
+		return fmt.Errorf("area not found: %s", device.AreaID)
+	}
 	if err := k.repository.Save(device); err != nil {
 		return err
 	}
 	k.getMutex(device.ID)
 
 	log.Printf("[Kernel] Device registered: %s (ID: %s)", device.Name, device.ID)
+	k.deviceListeners.notify(DeviceEvent{Type: DeviceRegistered, Device: k.decorate(device)})
 
 	for _, adapterID := range device.AdapterIDs {
 		if err := k.LinkDeviceToAdapter(device.ID, adapterID); err != nil {
@@ -201,18 +252,123 @@ func (k *Kernel) UnregisterDevice(deviceId string) error {
 		return err
 	}
 	k.deleteMutex(device.ID)
+	k.deleteLiveState(device.ID)
 
 	log.Printf("[Kernel] Device unregistered: %s (ID: %s)", device.Name, device.ID)
+	k.deviceListeners.notify(DeviceEvent{Type: DeviceRemoved, Device: device})
 
 	return nil
 }
 
+// UpdateDevice applies edit to the device and saves its name, address and metadata. Adapters linked to
+// the device are sent the new version.
+func (k *Kernel) UpdateDevice(deviceID string, edit func(device *types.Device) error) (*types.Device, error) {
+	mu := k.getMutex(deviceID)
+	mu.Lock()
+	device, err := k.repository.FindByID(deviceID)
+	if err != nil || device == nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("device not found: %s", deviceID)
+	}
+	previousAddress, previousAddressType := device.Address, device.AddressType
+
+	if err := edit(device); err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	if device.AreaID != "" && k.areaName(device.AreaID) == "" {
+		mu.Unlock()
+		return nil, fmt.Errorf("area not found: %s", device.AreaID)
+	}
+	if device.Address != previousAddress || device.AddressType != previousAddressType {
+		other, err := k.repository.FindByAddress(device.Address, device.AddressType)
+		if err == nil && other != nil && other.ID != device.ID {
+			err = fmt.Errorf("device %s already uses address %s", other.Name, device.Address)
+		}
+		if err != nil {
+			mu.Unlock()
+			return nil, err
+		}
+	}
+
+	err = k.repository.Update(device)
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	device = k.decorate(device)
+
+	log.Printf("[Kernel] Device updated: %s (ID: %s)", device.Name, device.ID)
+	k.notifyDeviceChanged(device)
+	return device, nil
+}
+
+// notifyDeviceChanged sends the new version of the device to its adapters and to the listeners
+func (k *Kernel) notifyDeviceChanged(device *types.Device) {
+	for _, adapterID := range device.AdapterIDs {
+		k.eventBus.Publish(events.Event{
+			Type:    events.UpdateDeviceForAdapter(adapterID),
+			Payload: device,
+		})
+	}
+	k.deviceListeners.notify(DeviceEvent{Type: DeviceChanged, Device: device})
+}
+
 func (ds *Kernel) GetDevice(deviceID string) (*types.Device, error) {
-	return ds.repository.FindByID(deviceID)
+	device, err := ds.repository.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return ds.decorate(device), nil
 }
 
 func (ds *Kernel) ListDevices() ([]*types.Device, error) {
-	return ds.repository.FindAll()
+	devices, err := ds.repository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		ds.decorate(device)
+	}
+	return devices, nil
+}
+
+// Reload drops what the kernel keeps from the repositories, after the database was replaced
+func (k *Kernel) Reload() error {
+	if err := k.loadAreas(); err != nil {
+		return err
+	}
+	devices, err := k.repository.FindAll()
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		exists[device.ID] = true
+	}
+	k.liveMu.Lock()
+	for deviceID := range k.live {
+		if !exists[deviceID] {
+			delete(k.live, deviceID)
+		}
+	}
+	k.liveMu.Unlock()
+
+	log.Printf("[Kernel] Reloaded %d devices", len(devices))
+	return nil
+}
+
+// ListAdapterDevices returns the devices linked to the adapter, it does not need to be running
+func (k *Kernel) ListAdapterDevices(adapterID string) ([]*types.Device, error) {
+	devices, err := k.repository.FindByAdapter(adapterID)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		k.decorate(device)
+	}
+	return devices, nil
 }
 
 // --- Linking Logic ---
@@ -234,7 +390,7 @@ func (k *Kernel) LinkDeviceToAdapter(deviceID, adapterID string) error {
 
 	k.eventBus.Publish(events.Event{
 		Type:    events.RegisterDeviceForAdapter(adapter.ID),
-		Payload: device,
+		Payload: k.decorate(device),
 	})
 	return nil
 }
@@ -256,11 +412,20 @@ func (k *Kernel) UnlinkDeviceFromAdapter(deviceID, adapterID string) error {
 
 	k.eventBus.Publish(events.Event{
 		Type:    events.UnregisterDeviceForAdapter(adapter.ID),
-		Payload: device,
+		Payload: k.decorate(device),
 	})
 	return nil
 }
 
+func (k *Kernel) GetPlugin(id string) (*plugin.Plugin, error) {
+	for _, t := range plugin.PluginTypes {
+		if p, err := k.pluginManager.GetPluginById(t, id); err == nil {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("plugin with id : %s not found", id)
+}
+
 func (k *Kernel) ListPlugins() []*plugin.Plugin {
 	plugins := k.pluginManager.GetPlugins()
 
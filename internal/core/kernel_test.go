@@ -0,0 +1,309 @@
+package core_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/broker"
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/repository"
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// The kernel runs on the in-memory event bus, a plugin is simulated by publishing what it would
+func TestKernelForwardsStateToAdapters(t *testing.T) {
+	eventBus := events.NewMemoryEventBus()
+	defer eventBus.Close()
+	kernel := newKernel(t, eventBus, newStore(t))
+
+	connected := make(chan struct{}, 1)
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		if event.Type == core.PluginConnected {
+			connected <- struct{}{}
+		}
+	})
+	registered := make(chan types.Device, 1)
+	updates := make(chan types.DeviceStateUpdate, 1)
+	events.Subscribe(eventBus, events.RegisterDeviceForAdapter("adapter"), func(d types.Device) { registered <- d })
+	events.Subscribe(eventBus, events.UpdateDataForAdapter("adapter"), func(u types.DeviceStateUpdate) { updates <- u })
+
+	eventBus.Publish(events.Event{Type: events.PluginConnected, Payload: plugin.Plugin{ID: "adapter", Name: "Adapter", Type: plugin.PluginAdapter, State: types.StateRunning}})
+	wait(t, connected, "plugin connection")
+
+	device := types.NewDevice("AA:BB", "Sensor", []string{"adapter"}, types.BLEAddress)
+	if err := kernel.RegisterDevice(device); err != nil {
+		t.Fatal(err)
+	}
+	if d := wait(t, registered, "device registration"); d.ID != device.ID {
+		t.Fatalf("Adapter received another device %+v", d)
+	}
+
+	eventBus.Publish(events.Event{Type: events.ParsedDataReceived, Payload: types.ParsedData{
+		Address:     "AA:BB",
+		AddressType: types.BLEAddress,
+		Data:        []*types.Capability{{Name: "temperature", Value: 21.5, Unit: "°C"}},
+		Timestamp:   time.Now(),
+	}})
+	if u := wait(t, updates, "state update"); u.DeviceID != device.ID || u.Value != 21.5 {
+		t.Fatalf("Unexpected update %+v", u)
+	}
+}
+
+// Adapters receive the area name of a device from its registration, for their room hint
+func TestKernelSendsAreaToAdapters(t *testing.T) {
+	eventBus := events.NewMemoryEventBus()
+	defer eventBus.Close()
+	kernel := newKernel(t, eventBus, newStore(t))
+
+	connected := make(chan struct{}, 1)
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		if event.Type == core.PluginConnected {
+			connected <- struct{}{}
+		}
+	})
+	registered := make(chan types.Device, 1)
+	unregistered := make(chan types.Device, 1)
+	events.Subscribe(eventBus, events.RegisterDeviceForAdapter("adapter"), func(d types.Device) { registered <- d })
+	events.Subscribe(eventBus, events.UnregisterDeviceForAdapter("adapter"), func(d types.Device) { unregistered <- d })
+	eventBus.Publish(events.Event{Type: events.PluginConnected, Payload: plugin.Plugin{ID: "adapter", Name: "Adapter", Type: plugin.PluginAdapter, State: types.StateRunning}})
+	wait(t, connected, "plugin connection")
+
+	kitchen := types.NewArea("Kitchen", "", "")
+	if err := kernel.CreateArea(kitchen); err != nil {
+		t.Fatal(err)
+	}
+	device := types.NewDevice("AA:BB", "Sensor", []string{"adapter"}, types.BLEAddress)
+	device.AreaID = kitchen.ID
+	if err := kernel.RegisterDevice(device); err != nil {
+		t.Fatal(err)
+	}
+	if d := wait(t, registered, "device registration"); d.Area != "Kitchen" {
+		t.Fatalf("Registered without its area %+v", d)
+	}
+
+	if err := kernel.UnlinkDeviceFromAdapter(device.ID, "adapter"); err != nil {
+		t.Fatal(err)
+	}
+	if d := wait(t, unregistered, "device unregistration"); d.Area != "Kitchen" {
+		t.Fatalf("Unregistered without its area %+v", d)
+	}
+}
+
+// The latest readings are saved and found again by a restarted kernel
+func TestKernelSavesLiveState(t *testing.T) {
+	eventBus := events.NewMemoryEventBus()
+	defer eventBus.Close()
+	store := newStore(t)
+	kernel := newKernel(t, eventBus, store)
+
+	device := types.NewDevice("AA:BB", "Sensor", nil, types.BLEAddress)
+	if err := kernel.RegisterDevice(device); err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan types.DeviceStateUpdate, 1)
+	kernel.OnDeviceStateUpdate(func(u types.DeviceStateUpdate) { updates <- u })
+	eventBus.Publish(events.Event{Type: events.ParsedDataReceived, Payload: types.ParsedData{
+		Address:     "AA:BB",
+		AddressType: types.BLEAddress,
+		Data:        []*types.Capability{{Name: "temperature", Value: 21.5, Unit: "°C"}},
+		Timestamp:   time.Now(),
+	}})
+	wait(t, updates, "state update")
+	if err := kernel.FlushLiveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newKernel(t, eventBus, store)
+	found, err := restarted.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temperature := found.Capabilities["temperature"]; temperature == nil || temperature.Value != 21.5 || found.Available {
+		t.Fatalf("Reading not saved %+v", found)
+	}
+}
+
+// A restarted core learns the running plugins from their retained state
+func TestKernelLearnsPluginsFromRetainedState(t *testing.T) {
+	eventBus := events.NewMemoryEventBus()
+	defer eventBus.Close()
+
+	scanner := plugin.Plugin{ID: "ble", Name: "Bluetooth", Type: plugin.PluginScanner, State: types.StateRunning}
+	eventBus.Publish(events.Event{Type: events.PluginState(scanner.ID), Payload: scanner})
+	kernel := newKernel(t, eventBus, newStore(t))
+
+	changes := make(chan *plugin.Plugin, 10)
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		if event.Type == core.PluginStateChanged {
+			changes <- event.Plugin
+		}
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(kernel.ListScanners()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The scanner was not learnt from its retained state")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	scanner.State = types.StateStopped
+	eventBus.Publish(events.Event{Type: events.PluginState(scanner.ID), Payload: scanner})
+	if p := wait(t, changes, "state change"); p.State != types.StateStopped {
+		t.Fatalf("Unexpected state %s", p.State)
+	}
+}
+
+// Acks are delivered at least once, a duplicate or an unknown one does not answer the next command
+func TestKernelIgnoresDuplicateAcks(t *testing.T) {
+	eventBus := events.NewMemoryEventBus()
+	defer eventBus.Close()
+	kernel := newKernel(t, eventBus, newStore(t))
+
+	scanner := plugin.Plugin{ID: "ble", Name: "Bluetooth", Type: plugin.PluginScanner, State: types.StateRunning}
+	connected := make(chan struct{}, 1)
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		if event.Type == core.PluginConnected {
+			connected <- struct{}{}
+		}
+	})
+	eventBus.Publish(events.Event{Type: events.PluginConnected, Payload: scanner})
+	wait(t, connected, "plugin connection")
+
+	// The bus delivers in order, the marker is handled after the acks
+	handled := make(chan struct{}, 1)
+	events.Subscribe(eventBus, "test/handled", func(_ any) { handled <- struct{}{} })
+	for _, p := range []plugin.Plugin{scanner, scanner, scanner, {ID: "unknown"}} {
+		eventBus.Publish(events.Event{Type: events.PluginAck, Payload: p})
+	}
+	eventBus.Publish(events.Event{Type: "test/handled", Payload: struct{}{}})
+	wait(t, handled, "acks")
+
+	// The plugin refuses to start
+	events.Subscribe(eventBus, events.PluginStart(scanner.ID), func(_ []any) {
+		eventBus.Publish(events.Event{Type: events.PluginNegativeAck, Payload: scanner})
+	})
+	if err := kernel.StartScanner(scanner.ID); err == nil {
+		t.Fatal("A stale ack answered the start")
+	}
+}
+
+// A plugin that crashed is removed, the broker clears its state with its will
+func TestKernelRemovesCrashedPlugins(t *testing.T) {
+	b, err := broker.Start(broker.Options{Address: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	coreBus, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: b.URL()}, "gohome-core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coreBus.Close()
+	kernel := newKernel(t, coreBus, newStore(t))
+
+	pluginEvents := make(chan core.PluginEvent, 10)
+	kernel.OnPluginEvent(func(event core.PluginEvent) { pluginEvents <- event })
+
+	// The plugin reaches the broker through a connection the test can cut
+	address, crash := proxy(t, strings.TrimPrefix(b.URL(), "tcp://"))
+	pluginBus, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: "tcp://" + address}, "ble", plugin.StateWill("ble"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pluginBus.Close()
+	client := plugin.NewPluginClient(&plugin.Plugin{ID: "ble", Name: "Bluetooth", Type: plugin.PluginScanner}, pluginBus)
+	client.EmitNewState(types.StateRunning)
+	if event := wait(t, pluginEvents, "plugin connection"); event.Type != core.PluginConnected {
+		t.Fatalf("Unexpected event %s", event.Type)
+	}
+
+	crash()
+	if event := wait(t, pluginEvents, "plugin removal"); event.Type != core.PluginDisconnected || event.Plugin.ID != "ble" {
+		t.Fatalf("Unexpected event %s of %+v", event.Type, event.Plugin)
+	}
+	if plugins := kernel.ListPlugins(); len(plugins) != 0 {
+		t.Fatalf("The crashed plugin is still listed %+v", plugins[0])
+	}
+}
+
+// proxy forwards the connections to the target until crash is called, which drops them without a disconnect
+func proxy(t *testing.T, target string) (address string, crash func()) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	crash = func() {
+		l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	t.Cleanup(crash)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			mu.Lock()
+			conns = append(conns, conn, upstream)
+			mu.Unlock()
+			go io.Copy(upstream, conn)
+			go io.Copy(conn, upstream)
+		}
+	}()
+	return l.Addr().String(), crash
+}
+
+func newStore(t *testing.T) *repository.Store {
+	t.Helper()
+	store, err := repository.OpenStore(repository.StorageOptions{
+		Driver:     repository.DialectSQLite,
+		SQLitePath: filepath.Join(t.TempDir(), "gohome.db"),
+		SQLite:     repository.DefaultSQLiteOptions(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newKernel(t *testing.T, eventBus events.EventBus, store *repository.Store) *core.Kernel {
+	t.Helper()
+	kernel, err := core.NewKernel(eventBus, store.Devices, store.Areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kernel
+}
+
+func wait[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the %s", what)
+	}
+	var zero T
+	return zero
+}
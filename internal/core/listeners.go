@@ -0,0 +1,23 @@
+package core
+
+import "sync"
+
+// listeners holds the hooks registered on the kernel, they are called synchronously and must not block
+type listeners[T any] struct {
+	mu  sync.RWMutex
+	fns []func(T)
+}
+
+func (l *listeners[T]) add(fn func(T)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fns = append(l.fns, fn)
+}
+
+func (l *listeners[T]) notify(v T) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, fn := range l.fns {
+		fn(v)
+	}
+}
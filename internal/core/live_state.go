@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// Device states are not saved on each update, the kernel keeps the latest ones in memory and saves the
+// changed ones every PersistLiveState interval
+type liveState struct {
+	capabilities map[types.CapabilityType]*types.Capability
+	unsaved      map[types.CapabilityType]*types.Capability
+	lastUpdated  time.Time
+	available    bool
+}
+
+// updateLiveState records new data and reports whether the device was unavailable before
+func (k *Kernel) updateLiveState(deviceID string, data []*types.Capability, timestamp time.Time) (becameAvailable bool) {
+	k.liveMu.Lock()
+	defer k.liveMu.Unlock()
+
+	state, ok := k.live[deviceID]
+	if !ok {
+		state = &liveState{
+			capabilities: make(map[types.CapabilityType]*types.Capability),
+			unsaved:      make(map[types.CapabilityType]*types.Capability),
+		}
+		k.live[deviceID] = state
+	}
+	for _, c := range data {
+		state.capabilities[c.Name] = c
+		state.unsaved[c.Name] = c
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	state.lastUpdated = timestamp
+	becameAvailable = !state.available
+	state.available = true
+	return becameAvailable
+}
+
+// applyLiveState overlays the in memory state on a device loaded from the repository
+func (k *Kernel) applyLiveState(device *types.Device) {
+	k.liveMu.RLock()
+	defer k.liveMu.RUnlock()
+
+	state, ok := k.live[device.ID]
+	if !ok {
+		device.Available = false
+		return
+	}
+	if device.Capabilities == nil {
+		device.Capabilities = make(map[types.CapabilityType]*types.Capability, len(state.capabilities))
+	}
+	maps.Copy(device.Capabilities, state.capabilities)
+	device.LastUpdated = state.lastUpdated
+	device.Available = state.available
+}
+
+func (k *Kernel) deleteLiveState(deviceID string) {
+	k.liveMu.Lock()
+	defer k.liveMu.Unlock()
+	delete(k.live, deviceID)
+}
+
+// PersistLiveState saves the readings received since the last save every interval, until ctx is done.
+// A zero interval disables it, FlushLiveState still saves them on shutdown.
+func (k *Kernel) PersistLiveState(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.FlushLiveState(); err != nil {
+					log.Printf("[Kernel] Failed to save device states: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// FlushLiveState saves the readings received since the last save, a failed save is not retried
+func (k *Kernel) FlushLiveState() error {
+	type unsavedState struct {
+		deviceID     string
+		capabilities []*types.Capability
+		lastUpdated  time.Time
+	}
+
+	k.liveMu.Lock()
+	var states []unsavedState
+	for deviceID, state := range k.live {
+		if len(state.unsaved) == 0 {
+			continue
+		}
+		states = append(states, unsavedState{deviceID, slices.Collect(maps.Values(state.unsaved)), state.lastUpdated})
+		clear(state.unsaved)
+	}
+	k.liveMu.Unlock()
+
+	var errs []error
+	for _, state := range states {
+		if err := k.repository.SaveState(state.deviceID, state.capabilities, state.lastUpdated); err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", state.deviceID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatchAvailability marks devices as unavailable when they sent no data for timeout, until ctx is done.
+// A zero timeout disables the check.
+func (k *Kernel) WatchAvailability(ctx context.Context, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	interval := min(timeout/4, time.Minute)
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, deviceID := range k.expireLiveStates(now.Add(-timeout)) {
+					device, err := k.GetDevice(deviceID)
+					if err != nil || device == nil {
+						continue
+					}
+					k.deviceListeners.notify(DeviceEvent{Type: DeviceAvailability, Device: device})
+				}
+			}
+		}
+	}()
+}
+
+func (k *Kernel) expireLiveStates(before time.Time) []string {
+	k.liveMu.Lock()
+	defer k.liveMu.Unlock()
+
+	var expired []string
+	for deviceID, state := range k.live {
+		if state.available && state.lastUpdated.Before(before) {
+			state.available = false
+			expired = append(expired, deviceID)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,16 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/plugin"
+)
+
+// PluginCredential lets a plugin connect to the embedded broker, which only allows it the topics of its id
+// and type. The plugin id is the MQTT username, only the hash of the password is stored.
+type PluginCredential struct {
+	PluginID     string            `json:"plugin_id"`
+	PluginType   plugin.PluginType `json:"plugin_type"`
+	PasswordHash string            `json:"-"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
@@ -0,0 +1,8 @@
+package core
+
+type PluginCredentialRepository interface {
+	Save(credential *PluginCredential) error
+	Delete(pluginID string) (bool, error)
+	FindAll() ([]*PluginCredential, error)
+	FindByPluginID(pluginID string) (*PluginCredential, error)
+}
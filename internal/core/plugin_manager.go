@@ -1,9 +1,11 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,16 +15,17 @@ import (
 )
 
 type PluginManager struct {
-	eventBus    *events.EventBus
+	eventBus    events.EventBus
 	plugins     map[plugin.PluginType]map[string]*plugin.Plugin
 	mu          sync.Mutex
 	ack         map[string]chan struct{}
 	negativeAck map[string]chan struct{}
+	listeners   listeners[PluginEvent]
 }
 
 const TimeoutDuration = 5 * time.Second
 
-func NewPluginManager(eventBus *events.EventBus) (*PluginManager, error) {
+func NewPluginManager(eventBus events.EventBus) (*PluginManager, error) {
 	manager := &PluginManager{
 		eventBus:    eventBus,
 		plugins:     make(map[plugin.PluginType]map[string]*plugin.Plugin),
@@ -51,6 +54,10 @@ func (m *PluginManager) subscribeToEvents() error {
 		return err
 	}
 
+	if err := m.eventBus.SubscribeRaw(events.PluginState("+"), m.onPluginState); err != nil {
+		return err
+	}
+
 	if err := events.Subscribe(m.eventBus, events.PluginAck, m.onPluginAck); err != nil {
 		return err
 	}
@@ -65,34 +72,65 @@ func (m *PluginManager) subscribeToEvents() error {
 }
 
 func (m *PluginManager) onPluginAck(p plugin.Plugin) {
+	m.signal(m.ack, p.ID)
+}
+
+func (m *PluginManager) onPluginNegativeAck(p plugin.Plugin) {
+	m.signal(m.negativeAck, p.ID)
+}
+
+// signal never blocks the event bus: acks are delivered at least once so a duplicate finds the previous one
+// still waiting, and the acks of unknown plugins are dropped
+func (m *PluginManager) signal(channels map[string]chan struct{}, id string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.ack[p.ID] <- struct{}{}
+	ch, ok := channels[id]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
 }
 
-func (m *PluginManager) onPluginNegativeAck(p plugin.Plugin) {
+// acks returns the ack channels of the plugin, emptied of what was left by a previous command
+func (m *PluginManager) acks(id string) (ack, nack chan struct{}) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.negativeAck[p.ID] <- struct{}{}
+	ack, nack = m.ack[id], m.negativeAck[id]
+	for _, ch := range []chan struct{}{ack, nack} {
+		select {
+		case <-ch:
+		default:
+		}
+	}
+	return ack, nack
 }
 
 func (m *PluginManager) onPluginConnected(p plugin.Plugin) {
+	if m.addPlugin(p) {
+		m.listeners.notify(PluginEvent{Type: PluginConnected, Plugin: &p})
+	}
+}
+
+func (m *PluginManager) addPlugin(p plugin.Plugin) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, ok := m.plugins[p.Type][p.ID]; ok {
 		log.Printf("[PluginManager] plugin with ID:%s already exists", p.ID)
-		return
+		return false
 	}
 
 	if _, ok := m.ack[p.ID]; ok {
 		log.Printf("[PluginManager] plugin with ID:%s already exists in ack map", p.ID)
-		return
+		return false
 	}
 
 	if _, ok := m.negativeAck[p.ID]; ok {
 		log.Printf("[PluginManager] plugin with ID:%s already exists in negativeAck map", p.ID)
-		return
+		return false
 	}
 	if _, ok := m.plugins[p.Type]; !ok {
 		m.plugins[p.Type] = make(map[string]*plugin.Plugin)
@@ -101,42 +139,98 @@ func (m *PluginManager) onPluginConnected(p plugin.Plugin) {
 	m.negativeAck[p.ID] = make(chan struct{}, 1)
 	m.ack[p.ID] = make(chan struct{}, 1)
 	m.plugins[p.Type][p.ID] = &p
+	return true
 }
 
 func (m *PluginManager) onPluginDisconnected(p plugin.Plugin) {
+	if m.removePlugin(p) {
+		m.listeners.notify(PluginEvent{Type: PluginDisconnected, Plugin: &p})
+	}
+}
+
+func (m *PluginManager) removePlugin(p plugin.Plugin) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, ok := m.plugins[p.Type][p.ID]; !ok {
 		log.Printf("[PluginManager] plugin with ID:%s doesnt exists", p.ID)
-		return
+		return false
 	}
 
 	if _, ok := m.ack[p.ID]; !ok {
 		log.Printf("[PluginManager] plugin with ID:%s doesnt exists in ack map", p.ID)
-		return
+		return false
 	}
 
 	if _, ok := m.negativeAck[p.ID]; !ok {
 		log.Printf("[PluginManager] plugin with ID:%s doesnt exists in negativeAck map", p.ID)
-		return
+		return false
 	}
 
 	delete(m.negativeAck, p.ID)
 	delete(m.ack, p.ID)
 	delete(m.plugins[p.Type], p.ID)
+	return true
 }
 
 func (m *PluginManager) onPluginStateChanged(p plugin.Plugin) {
+	if m.updatePlugin(p) {
+		m.listeners.notify(PluginEvent{Type: PluginStateChanged, Plugin: &p})
+	}
+}
+
+// onPluginState also learns the plugins that connected before the core, from their retained state. The state
+// is cleared by the plugin when it stops, or by the broker with the will of a plugin that crashed.
+func (m *PluginManager) onPluginState(topic events.EventType, payload []byte) {
+	if len(payload) == 0 {
+		m.onPluginStateCleared(strings.TrimPrefix(string(topic), string(events.PluginState(""))))
+		return
+	}
+	var p plugin.Plugin
+	if err := json.Unmarshal(payload, &p); err != nil {
+		log.Printf("Unmarshal error : %s: %v", topic, err)
+		return
+	}
+
+	m.mu.Lock()
+	_, known := m.plugins[p.Type][p.ID]
+	m.mu.Unlock()
+
+	if !known {
+		m.onPluginConnected(p)
+		return
+	}
+	m.onPluginStateChanged(p)
+}
+
+func (m *PluginManager) onPluginStateCleared(id string) {
+	m.mu.Lock()
+	var found *plugin.Plugin
+	for _, plugins := range m.plugins {
+		if p, ok := plugins[id]; ok {
+			found = p
+		}
+	}
+	m.mu.Unlock()
+
+	// Nothing to do after a clean PluginDisconnected
+	if found != nil {
+		log.Printf("[PluginManager] plugin with ID:%s went away without disconnecting", id)
+		m.onPluginDisconnected(*found)
+	}
+}
+
+func (m *PluginManager) updatePlugin(p plugin.Plugin) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, ok := m.plugins[p.Type][p.ID]; !ok {
 		log.Printf("[PluginManager] plugin with ID:%s do not exists", p.ID)
-		return
+		return false
 	}
 
 	m.plugins[p.Type][p.ID] = &p
+	return true
 }
 
 func (m *PluginManager) GetPluginsByType(t plugin.PluginType) []*plugin.Plugin {
@@ -180,15 +274,16 @@ func (m *PluginManager) GetPlugins() []*plugin.Plugin {
 }
 
 func (m *PluginManager) StopPlugin(p *plugin.Plugin) error {
+	ack, nack := m.acks(p.ID)
 	m.eventBus.Publish(events.Event{
 		Type:    events.PluginStop(p.ID),
 		Payload: []any{},
 	})
 
 	select {
-	case <-m.ack[p.ID]:
+	case <-ack:
 		return nil
-	case <-m.negativeAck[p.ID]:
+	case <-nack:
 		return fmt.Errorf("error stopping %s %s", p.Type, p.Name)
 	case <-time.After(TimeoutDuration):
 		return fmt.Errorf("timeout stopping %s %s", p.Type, p.Name)
@@ -196,10 +291,7 @@ func (m *PluginManager) StopPlugin(p *plugin.Plugin) error {
 }
 
 func (m *PluginManager) StartPlugin(p *plugin.Plugin) error {
-	m.mu.Lock()
-	ack := m.ack[p.ID]
-	nack := m.negativeAck[p.ID]
-	m.mu.Unlock()
+	ack, nack := m.acks(p.ID)
 	m.eventBus.Publish(events.Event{
 		Type:    events.PluginStart(p.ID),
 		Payload: []any{},
@@ -0,0 +1,41 @@
+package core
+
+import "time"
+
+// Session is a logged in browser, the cookie only carries the session token
+type Session struct {
+	ID         string    `json:"id"` // hash of the token, the token itself is never stored
+	UserID     string    `json:"user_id"`
+	Data       []byte    `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type AuditType string
+
+const (
+	AuditLoginSucceeded  AuditType = "login_succeeded"
+	AuditLoginFailed     AuditType = "login_failed"
+	AuditLoginLocked     AuditType = "login_locked"
+	AuditLogout          AuditType = "logout"
+	AuditLogoutAll       AuditType = "logout_all"
+	AuditSessionRevoked  AuditType = "session_revoked"
+	AuditPasswordChanged AuditType = "password_changed"
+	AuditPasswordReset   AuditType = "password_reset"
+	AuditTotpEnabled     AuditType = "totp_enabled"
+	AuditTotpDisabled    AuditType = "totp_disabled"
+)
+
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Type      AuditType `json:"type"`
+	UserID    string    `json:"user_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
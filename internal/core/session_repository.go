@@ -0,0 +1,19 @@
+package core
+
+import "time"
+
+type SessionRepository interface {
+	Save(session *Session) error
+	Touch(id string, lastSeen time.Time) error
+	Delete(id string) error
+	DeleteForUser(id string, userID string) (bool, error)
+	DeleteByUser(userID string, keepID string) error
+	DeleteExpired(now time.Time, idleSince time.Time) error
+	FindByID(id string) (*Session, error)
+	FindByUser(userID string) ([]*Session, error)
+}
+
+type AuditRepository interface {
+	Save(entry *AuditEntry) error
+	FindRecent(limit int) ([]*AuditEntry, error)
+}
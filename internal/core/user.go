@@ -1,10 +1,72 @@
 package core
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"  // manage users, invitations and everything a member can do
+	RoleMember Role = "member" // manage devices, plugins and links
+	RoleViewer Role = "viewer" // read only
+)
+
+var roleLevels = map[Role]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("invalid role %q", s)
+	}
+	return role, nil
+}
+
+// Allows reports whether a user with this role can access a route requiring the given role
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required] && roleLevels[r] > 0
+}
 
 type User struct {
 	ID           string    `json:"id"`
 	Email        string    `json:"email"`
+	Role         Role      `json:"role"`
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	TotpEnabled  bool   `json:"totp_enabled"`
+	TotpSecret   string `json:"-"` // set during enrollment, before TotpEnabled
+	TotpLastStep int64  `json:"-"` // last accepted code, a code is only valid once
+}
+
+// Invitation lets an admin onboard a new user, only the hash of the token is stored
+type Invitation struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	TokenHash string    `json:"-"`
+	CreatedBy string    `json:"created_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RecoveryCode replaces a TOTP code once, when the authenticator is lost
+type RecoveryCode struct {
+	ID       string
+	UserID   string
+	Hint     string
+	CodeHash string
+}
+
+// PasswordReset is a single use token generated by an admin for a user who lost their password
+type PasswordReset struct {
+	TokenHash string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
 }
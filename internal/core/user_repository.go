@@ -0,0 +1,35 @@
+package core
+
+import "time"
+
+type UserRepository interface {
+	Save(user *User) error
+	Delete(id string) error
+	FindAll() ([]*User, error)
+	FindByEmail(email string) (*User, error)
+	FindByID(id string) (*User, error)
+	UpdateTotpLastStep(id string, step int64) (bool, error)
+	Count() (*int, error)
+	CountByRole(role Role) (int, error)
+}
+
+type InvitationRepository interface {
+	Save(invitation *Invitation) error
+	Delete(id string) error
+	DeleteExpired(now time.Time) error
+	FindAll() ([]*Invitation, error)
+	FindByTokenHash(tokenHash string) (*Invitation, error)
+}
+
+type PasswordResetRepository interface {
+	Save(reset *PasswordReset) error
+	DeleteByUser(userID string) error
+	FindByTokenHash(tokenHash string) (*PasswordReset, error)
+}
+
+type RecoveryCodeRepository interface {
+	Replace(userID string, codes []*RecoveryCode) error
+	FindByHint(userID string, hint string) ([]*RecoveryCode, error)
+	Delete(id string) (bool, error)
+	DeleteByUser(userID string) error
+}
@@ -0,0 +1,54 @@
+package declarative
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Bastien2203/go-home/internal/transfer"
+	"gopkg.in/yaml.v3"
+)
+
+// File is gohome.yaml, the devices, areas and plugins of the instance written by hand. It has the format of
+// an export, so an export is a good start, without users: they are invited from the UI.
+type File struct {
+	// Prune deletes the devices and areas missing from the file, a section left out of the file is never pruned
+	Prune             bool `yaml:"prune"`
+	transfer.Document `yaml:",inline"`
+}
+
+// Load reads and validates the file, the error wraps os.ErrNotExist when it is missing
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes the file, unknown fields are refused and every problem is reported at once
+func Parse(data []byte) (*File, error) {
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file is empty")
+		}
+		return nil, fmt.Errorf("invalid yaml: %w", err)
+	}
+
+	var errs []error
+	if err := file.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(file.Users) > 0 {
+		errs = append(errs, errors.New("users cannot be declared, invite them from the UI or import them"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
@@ -0,0 +1,56 @@
+package declarative
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func TestParseFile(t *testing.T) {
+	file, err := Parse([]byte(`
+version: 1
+prune: true
+areas:
+  - id: kitchen
+    name: Kitchen
+devices:
+  - address: "AA:BB:CC:DD:EE:FF"
+    address_type: ble
+    name: Fridge sensor
+    area_id: kitchen
+    adapter_ids: [homekit]
+plugins:
+  - id: homekit
+    type: plugin_adapter
+    state: running
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse %v", err)
+	}
+	if !file.Prune || len(file.Areas) != 1 || file.Devices[0].AddressType != types.BLEAddress || file.Devices[0].AdapterIDs[0] != "homekit" || file.Plugins[0].State != types.StateRunning {
+		t.Fatalf("Unexpected file %+v", file)
+	}
+	if file.Users != nil {
+		t.Fatalf("Sections left out must stay nil so they are not pruned")
+	}
+}
+
+func TestParseRefusesInvalidFiles(t *testing.T) {
+	tests := map[string]string{
+		"empty":         "",
+		"no version":    "devices: []",
+		"unknown field": "version: 1\nprunne: true",
+		"users":         "version: 1\nusers:\n  - email: a@example.com\n    role: admin",
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Fatalf("%s: parsed an invalid file", name)
+		}
+	}
+
+	_, err := Parse([]byte("version: 1\ndevices:\n  - address: a\n    address_type: zigbee\n"))
+	if err == nil || !strings.Contains(err.Error(), "devices[0]: invalid address type") || !strings.Contains(err.Error(), "devices[0]: name is required") {
+		t.Fatalf("Expected every error %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package declarative
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/transfer"
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay groups the events of a save, editors write a file in several steps
+const reloadDelay = 500 * time.Millisecond
+
+// Reconciler applies gohome.yaml through the kernel, like an import, at startup, when it changes and when a
+// plugin connects: links to an adapter and plugin states can only be applied once the plugin is connected.
+type Reconciler struct {
+	path     string
+	transfer *transfer.Transfer
+
+	mu       sync.Mutex
+	warnings map[string]bool // logged once, not on every reload
+	connects chan struct{}
+}
+
+func NewReconciler(path string, kernel *core.Kernel, t *transfer.Transfer) *Reconciler {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	r := &Reconciler{path: path, transfer: t, warnings: make(map[string]bool), connects: make(chan struct{}, 1)}
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		if event.Type != core.PluginConnected {
+			return
+		}
+		select {
+		case r.connects <- struct{}{}:
+		default:
+		}
+	})
+	return r
+}
+
+func (r *Reconciler) Path() string {
+	return r.path
+}
+
+// Apply loads the file and brings the instance to it, nothing is applied when the file is invalid
+func (r *Reconciler) Apply() (*transfer.ImportResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := Load(r.path)
+	if err != nil {
+		return nil, err
+	}
+	mode := transfer.ModeMerge
+	if file.Prune {
+		mode = transfer.ModeReplace
+	}
+	result, err := r.transfer.Import(&file.Document, mode, false, "")
+	if err != nil {
+		return nil, err
+	}
+	r.logResult(result)
+	return result, nil
+}
+
+func (r *Reconciler) logResult(result *transfer.ImportResult) {
+	if len(result.Changes) > 0 {
+		log.Printf("[Config] %s applied, %d changes, %d failed", filepath.Base(r.path), len(result.Changes), result.Failed)
+	}
+	for _, change := range result.Changes {
+		if change.Error != "" {
+			log.Printf("[Config] Failed to %s %s %s: %s", change.Action, change.Kind, change.Name, change.Error)
+		} else if len(change.Fields) > 0 {
+			log.Printf("[Config] %s %s %s (%s)", change.Action, change.Kind, change.Name, strings.Join(change.Fields, ", "))
+		} else {
+			log.Printf("[Config] %s %s %s", change.Action, change.Kind, change.Name)
+		}
+	}
+	for _, warning := range result.Warnings {
+		if !r.warnings[warning] {
+			r.warnings[warning] = true
+			log.Printf("[Config] Warning: %s", warning)
+		}
+	}
+}
+
+// Start applies the file again when a plugin connects and, with watch, when the file changes, until ctx is done
+func (r *Reconciler) Start(ctx context.Context, watch bool) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watch {
+		// The directory is watched, the file may not exist yet and editors replace it rather than write it
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			if err = watcher.Add(filepath.Dir(r.path)); err != nil {
+				watcher.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("[Config] Failed to watch %s, changes need a restart: %v", r.path, err)
+		} else {
+			events, errs = watcher.Events, watcher.Errors
+			go func() {
+				<-ctx.Done()
+				watcher.Close()
+			}()
+		}
+	}
+
+	go func() {
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+				} else if event.Name == r.path {
+					reload = time.After(reloadDelay)
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+				} else {
+					log.Printf("[Config] Watch error: %v", err)
+				}
+			case <-r.connects:
+				reload = time.After(reloadDelay)
+			case <-reload:
+				reload = nil
+				r.reload()
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) reload() {
+	_, err := r.Apply()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Removing the file does not remove what it declared
+	case err != nil:
+		log.Printf("[Config] %s not applied, the previous version stays in place:\n%s", r.path, FormatError(err))
+	}
+}
+
+// FormatError puts each problem of a validation error on its own indented line
+func FormatError(err error) string {
+	lines := strings.Split(err.Error(), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n")
+}
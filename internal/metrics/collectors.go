@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/types"
+	"github.com/Bastien2203/go-home/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// --- Event bus ---
+
+var (
+	eventsPublishedDesc = prometheus.NewDesc(namespace+"_events_published_total", "Events published on the event bus by topic.", []string{"topic"}, nil)
+	eventsReceivedDesc  = prometheus.NewDesc(namespace+"_events_received_total", "Events received from the event bus by topic.", []string{"topic"}, nil)
+)
+
+type eventBusCollector struct {
+	eventBus events.EventBus
+}
+
+func newEventBusCollector(eventBus events.EventBus) *eventBusCollector {
+	return &eventBusCollector{eventBus: eventBus}
+}
+
+func (c *eventBusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- eventsPublishedDesc
+	ch <- eventsReceivedDesc
+}
+
+func (c *eventBusCollector) Collect(ch chan<- prometheus.Metric) {
+	for topic, stats := range c.eventBus.Stats() {
+		ch <- prometheus.MustNewConstMetric(eventsPublishedDesc, prometheus.CounterValue, float64(stats.Published), string(topic))
+		ch <- prometheus.MustNewConstMetric(eventsReceivedDesc, prometheus.CounterValue, float64(stats.Received), string(topic))
+	}
+}
+
+// --- Plugins ---
+
+var pluginStateDesc = prometheus.NewDesc(namespace+"_plugin_state", "Current state of each connected plugin (1 for the current state).", []string{"plugin_id", "plugin_name", "type", "state"}, nil)
+
+var pluginStates = []types.State{types.StateRunning, types.StateRestarting, types.StateStopped}
+
+type pluginCollector struct {
+	kernel *core.Kernel
+}
+
+func newPluginCollector(kernel *core.Kernel) *pluginCollector {
+	return &pluginCollector{kernel: kernel}
+}
+
+func (c *pluginCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pluginStateDesc
+}
+
+func (c *pluginCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.kernel.ListPlugins() {
+		for _, state := range pluginStates {
+			value := 0.0
+			if p.State == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(pluginStateDesc, prometheus.GaugeValue, value, p.ID, p.Name, string(p.Type), string(state))
+		}
+	}
+}
+
+// --- Devices ---
+
+var (
+	deviceCapabilityDesc = prometheus.NewDesc(namespace+"_device_capability_value", "Last value received for a device capability.", []string{"device_id", "device_name", "capability", "unit"}, nil)
+	deviceLastSeenDesc   = prometheus.NewDesc(namespace+"_device_last_seen_timestamp_seconds", "Unix timestamp of the last data received from a device.", []string{"device_id", "device_name"}, nil)
+)
+
+type capabilitySample struct {
+	value float64
+	unit  types.Unit
+}
+
+type deviceSamples struct {
+	lastSeen     time.Time
+	capabilities map[types.CapabilityType]capabilitySample
+}
+
+type deviceCollector struct {
+	kernel  *core.Kernel
+	mu      sync.Mutex
+	samples map[string]*deviceSamples
+}
+
+func newDeviceCollector(kernel *core.Kernel) *deviceCollector {
+	return &deviceCollector{
+		kernel:  kernel,
+		samples: make(map[string]*deviceSamples),
+	}
+}
+
+func (c *deviceCollector) onStateUpdate(update types.DeviceStateUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	samples, ok := c.samples[update.DeviceID]
+	if !ok {
+		samples = &deviceSamples{capabilities: make(map[types.CapabilityType]capabilitySample)}
+		c.samples[update.DeviceID] = samples
+	}
+	if update.Timestamp.After(samples.lastSeen) {
+		samples.lastSeen = update.Timestamp
+	}
+
+	// Non numeric values (button events, text) only update the last seen timestamp
+	value, ok := utils.ToFloat(update.Value)
+	if !ok {
+		b, isBool := update.Value.(bool)
+		if !isBool {
+			return
+		}
+		value = 0
+		if b {
+			value = 1
+		}
+	}
+	samples.capabilities[update.CapabilityType] = capabilitySample{value: value, unit: update.Unit}
+}
+
+func (c *deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deviceCapabilityDesc
+	ch <- deviceLastSeenDesc
+}
+
+// Devices are read from the repository so renamed devices get their new name and deleted ones disappear
+func (c *deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	devices, err := c.kernel.ListDevices()
+	if err != nil {
+		log.Printf("[Metrics] failed to list devices: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	known := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		known[device.ID] = true
+
+		samples, ok := c.samples[device.ID]
+		if !ok {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(deviceLastSeenDesc, prometheus.GaugeValue, float64(samples.lastSeen.Unix()), device.ID, device.Name)
+		for capability, sample := range samples.capabilities {
+			ch <- prometheus.MustNewConstMetric(deviceCapabilityDesc, prometheus.GaugeValue, sample.value, device.ID, device.Name, string(capability), string(sample.unit))
+		}
+	}
+
+	for id := range c.samples {
+		if !known[id] {
+			delete(c.samples, id)
+		}
+	}
+}
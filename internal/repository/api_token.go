@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type ApiTokenRepository struct {
+	db *DB
+}
+
+func NewApiTokenRepository(db *DB) *ApiTokenRepository {
+	return &ApiTokenRepository{db: db}
+}
+
+func (r *ApiTokenRepository) Save(token *core.ApiToken) error {
+	query := `
+	INSERT INTO api_tokens
+	(id, user_id, name, scope, token_hash, expires_at, last_used_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		user_id = excluded.user_id,
+		name = excluded.name,
+		scope = excluded.scope,
+		token_hash = excluded.token_hash,
+		expires_at = excluded.expires_at,
+		last_used_at = excluded.last_used_at,
+		created_at = excluded.created_at
+	`
+
+	_, err := r.db.Exec(query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.Scope,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.LastUsedAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save api token: %w", err)
+	}
+	return nil
+}
+
+func (r *ApiTokenRepository) UpdateLastUsed(id string, lastUsed time.Time) error {
+	query := `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, lastUsed, id)
+	return err
+}
+
+// Scoped to the owner so a user cannot revoke the tokens of someone else
+func (r *ApiTokenRepository) Delete(id string, userID string) (bool, error) {
+	query := `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+	res, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *ApiTokenRepository) DeleteByUser(userID string) error {
+	query := `DELETE FROM api_tokens WHERE user_id = ?`
+	_, err := r.db.Exec(query, userID)
+	return err
+}
+
+func (r *ApiTokenRepository) FindByUser(userID string) ([]*core.ApiToken, error) {
+	query := `SELECT id, user_id, name, scope, token_hash, expires_at, last_used_at, created_at FROM api_tokens WHERE user_id = ? ORDER BY created_at`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*core.ApiToken{}
+	for rows.Next() {
+		t, err := r.scanApiToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *ApiTokenRepository) FindByTokenHash(tokenHash string) (*core.ApiToken, error) {
+	query := `SELECT id, user_id, name, scope, token_hash, expires_at, last_used_at, created_at FROM api_tokens WHERE token_hash = ?`
+
+	row := r.db.QueryRow(query, tokenHash)
+	return r.scanApiToken(row)
+}
+
+func (r *ApiTokenRepository) scanApiToken(row Scanner) (*core.ApiToken, error) {
+	var t core.ApiToken
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&t.Scope,
+		&t.TokenHash,
+		&expiresAt,
+		&lastUsedAt,
+		&t.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return &t, nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+const areaColumns = `id, name, parent_id, icon, created_at`
+
+type AreaRepository struct {
+	db *DB
+}
+
+func NewAreaRepository(db *DB) *AreaRepository {
+	return &AreaRepository{db: db}
+}
+
+func (r *AreaRepository) Save(area *types.Area) error {
+	query := `
+	INSERT INTO areas (` + areaColumns + `)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		name = excluded.name,
+		parent_id = excluded.parent_id,
+		icon = excluded.icon
+	`
+	_, err := r.db.Exec(query, area.ID, area.Name, area.ParentID, area.Icon, area.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save area: %w", err)
+	}
+	return nil
+}
+
+func (r *AreaRepository) FindByID(id string) (*types.Area, error) {
+	row := r.db.QueryRow(`SELECT `+areaColumns+` FROM areas WHERE id = ?`, id)
+	return r.scanArea(row)
+}
+
+func (r *AreaRepository) FindAll() ([]*types.Area, error) {
+	rows, err := r.db.Query(`SELECT ` + areaColumns + ` FROM areas ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var areas []*types.Area
+	for rows.Next() {
+		area, err := r.scanArea(rows)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, area)
+	}
+	return areas, rows.Err()
+}
+
+// Delete moves the children of the area to its parent and removes its devices from it
+func (r *AreaRepository) Delete(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID string
+	err = tx.QueryRow(`SELECT parent_id FROM areas WHERE id = ?`, id).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE areas SET parent_id = ? WHERE parent_id = ?`, parentID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE devices SET area_id = '' WHERE area_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM areas WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *AreaRepository) scanArea(row Scanner) (*types.Area, error) {
+	var a types.Area
+	err := row.Scan(&a.ID, &a.Name, &a.ParentID, &a.Icon, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
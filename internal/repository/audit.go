@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Save(entry *core.AuditEntry) error {
+	query := `
+	INSERT INTO audit_log
+	(type, user_id, email, ip, user_agent, details, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`
+
+	err := r.db.QueryRow(query,
+		entry.Type,
+		entry.UserID,
+		entry.Email,
+		entry.IP,
+		entry.UserAgent,
+		entry.Details,
+		entry.CreatedAt,
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+	return nil
+}
+
+// Most recent first
+func (r *AuditRepository) FindRecent(limit int) ([]*core.AuditEntry, error) {
+	query := `SELECT id, type, user_id, email, ip, user_agent, details, created_at FROM audit_log ORDER BY id DESC LIMIT ?`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*core.AuditEntry{}
+	for rows.Next() {
+		var e core.AuditEntry
+		if err := rows.Scan(&e.ID, &e.Type, &e.UserID, &e.Email, &e.IP, &e.UserAgent, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
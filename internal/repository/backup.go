@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	backupPattern    = "gohome-*.db" // scheduled backups, the only ones removed by the retention
+	backupTimeLayout = "20060102-150405.000"
+)
+
+// Backups writes consistent copies of a live database with the SQLite online backup API, writes go on
+// while a copy is made. PostgreSQL databases are backed up with pg_dump instead.
+type Backups struct {
+	db        *DB
+	dir       string
+	interval  time.Duration
+	retention int
+}
+
+// NewBackups keeps the last retention scheduled backups in dir, an interval <= 0 disables them
+func NewBackups(db *DB, dir string, interval time.Duration, retention int) *Backups {
+	return &Backups{db: db, dir: dir, interval: interval, retention: max(retention, 1)}
+}
+
+// Run makes a backup every interval until ctx is done
+func (b *Backups) Run(ctx context.Context) {
+	if b.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if path, err := b.Create(ctx); err != nil {
+				log.Printf("[Database] Scheduled backup failed: %v", err)
+			} else {
+				log.Printf("[Database] Backup written to %s", path)
+			}
+		}
+	}
+}
+
+// Create writes a backup to the backup directory and removes the ones past the retention
+func (b *Backups) Create(ctx context.Context) (string, error) {
+	path, err := b.write(ctx, "gohome-"+time.Now().Format(backupTimeLayout)+".db")
+	if err != nil {
+		return "", err
+	}
+	return path, b.prune()
+}
+
+// Snapshot writes a copy of the database to path
+func (b *Backups) Snapshot(ctx context.Context, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	if err := copyDatabase(ctx, dest, b.db.db); err != nil {
+		return err
+	}
+	// The copy of a WAL database is in WAL mode too, a backup file must be usable on its own
+	_, err = dest.ExecContext(ctx, `PRAGMA journal_mode = DELETE`)
+	return err
+}
+
+// TempFile returns a new empty file in the backup directory, on the same disk as the backups
+func (b *Backups) TempFile() (*os.File, error) {
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(b.dir, ".tmp-*.db")
+}
+
+// Restore replaces the content of the database with the database at path, then migrates it. The current
+// content is backed up first.
+func (b *Backups) Restore(ctx context.Context, path string) error {
+	if err := checkBackup(path); err != nil {
+		return err
+	}
+
+	saved, err := b.write(ctx, "pre-restore-"+time.Now().Format(backupTimeLayout)+".db")
+	if err != nil {
+		return fmt.Errorf("failed to back up the current database: %w", err)
+	}
+	log.Printf("[Database] Current database saved to %s before restoring", saved)
+
+	source, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := copyDatabase(ctx, b.db.db, source); err != nil {
+		return fmt.Errorf("failed to restore the database: %w", err)
+	}
+	return Migrate(b.db)
+}
+
+// write makes a backup in a temporary file renamed once complete, so a backup is never half written
+func (b *Backups) write(ctx context.Context, name string) (string, error) {
+	tmp, err := b.TempFile()
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := b.Snapshot(ctx, tmp.Name()); err != nil {
+		return "", err
+	}
+	path := filepath.Join(b.dir, name)
+	return path, os.Rename(tmp.Name(), path)
+}
+
+func (b *Backups) prune() error {
+	// Names sort by date
+	paths, err := filepath.Glob(filepath.Join(b.dir, backupPattern))
+	if err != nil || len(paths) <= b.retention {
+		return err
+	}
+	slices.Sort(paths)
+	for _, path := range paths[:len(paths)-b.retention] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBackup refuses files that are not sane go-home databases, before anything is overwritten
+func checkBackup(path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("not a database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("database is corrupted: %s", result)
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("not a go-home database: %w", err)
+	}
+	list, err := migrations(DialectSQLite)
+	if err != nil {
+		return err
+	}
+	if int(version.Int64) > len(list) {
+		return fmt.Errorf("database schema version %d is newer than this version of go-home (%d)", version.Int64, len(list))
+	}
+	return nil
+}
+
+// copyDatabase replaces the content of dest with the content of source
+func copyDatabase(ctx context.Context, dest *sql.DB, source *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	sourceConn, err := source.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sourceConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return sourceConn.Raw(func(sourceDriver any) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", sourceDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			for {
+				// Step returns false without error while a database is locked by a write
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				select {
+				case <-ctx.Done():
+					backup.Close()
+					return ctx.Err()
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		})
+	})
+}
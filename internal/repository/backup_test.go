@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func userCount(t *testing.T, repo *UserRepository) int {
+	users, err := repo.FindAll()
+	if err != nil {
+		t.Fatalf("Failed to list users %v", err)
+	}
+	return len(users)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+	users := NewUserRepository(db)
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash) VALUES ('1', 'a@example.com', '')`); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+
+	dir := t.TempDir()
+	backups := NewBackups(db, dir, 0, 2)
+	backup, err := backups.Create(ctx)
+	if err != nil {
+		t.Fatalf("Backup failed %v", err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash) VALUES ('2', 'b@example.com', '')`); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	if err := backups.Restore(ctx, backup); err != nil {
+		t.Fatalf("Restore failed %v", err)
+	}
+	if count := userCount(t, users); count != 1 {
+		t.Fatalf("Expected the user of the backup only, got %d", count)
+	}
+
+	// The database is saved before being restored
+	saved, _ := filepath.Glob(filepath.Join(dir, "pre-restore-*.db"))
+	if len(saved) != 1 {
+		t.Fatalf("Database not saved before the restore %v", saved)
+	}
+}
+
+func TestRestoreRefusesInvalidFiles(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+	backups := NewBackups(db, t.TempDir(), 0, 2)
+
+	path := filepath.Join(t.TempDir(), "invalid.db")
+	os.WriteFile(path, []byte("not a database"), 0o600)
+	if err := backups.Restore(context.Background(), path); err == nil {
+		t.Fatalf("Restored a file that is not a database")
+	}
+
+	// A valid SQLite database that is not a go-home one
+	other := filepath.Join(t.TempDir(), "other.db")
+	otherDB, err := OpenSQLiteDB(other, DefaultSQLiteOptions())
+	if err != nil {
+		t.Fatalf("Failed to open db %v", err)
+	}
+	otherDB.Exec(`CREATE TABLE things (id TEXT)`)
+	otherDB.Close()
+	if err := backups.Restore(context.Background(), other); err == nil {
+		t.Fatalf("Restored a database without migrations")
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	for _, name := range []string{"gohome-20240101-000000.db", "gohome-20240102-000000.db", "pre-restore-20240101-000000.db"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+	}
+
+	backups := NewBackups(db, dir, 0, 2)
+	if _, err := backups.Create(context.Background()); err != nil {
+		t.Fatalf("Backup failed %v", err)
+	}
+
+	left, _ := filepath.Glob(filepath.Join(dir, "*.db"))
+	if len(left) != 3 {
+		t.Fatalf("Unexpected files after pruning %v", left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gohome-20240101-000000.db")); !os.IsNotExist(err) {
+		t.Fatalf("Oldest backup not removed")
+	}
+}
@@ -0,0 +1,484 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// The conformance tests run against every storage driver. SQLite always runs, PostgreSQL runs when
+// GOHOME_TEST_POSTGRES_URL points to a database, each test gets its own schema there.
+const postgresURLEnv = "GOHOME_TEST_POSTGRES_URL"
+
+func forEachStore(t *testing.T, test func(t *testing.T, store *Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := OpenStore(StorageOptions{
+			Driver:     DialectSQLite,
+			SQLitePath: filepath.Join(t.TempDir(), "test.db"),
+			SQLite:     DefaultSQLiteOptions(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to open store %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		test(t, store)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		base := os.Getenv(postgresURLEnv)
+		if base == "" {
+			t.Skipf("%s is not set", postgresURLEnv)
+		}
+		test(t, openPostgresTestStore(t, base))
+	})
+}
+
+func openPostgresTestStore(t *testing.T, base string) *Store {
+	admin, err := OpenPostgresDB(base, DefaultPostgresOptions())
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "gohome_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Failed to create schema %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("Invalid %s %v", postgresURLEnv, err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	store, err := OpenStore(StorageOptions{Driver: DialectPostgres, PostgresURL: u.String(), Postgres: DefaultPostgresOptions()})
+	if err != nil {
+		t.Fatalf("Failed to open store %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestConformanceDevices(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		repo := store.Devices
+
+		device := types.NewDevice("AA:BB", "Sensor", []string{"mqtt", "homekit"}, types.BasicAddress)
+		device.Tags = []string{"garden"}
+		device.Capabilities[types.CapabilityTemperature] = &types.Capability{Name: types.CapabilityTemperature, Value: 21.5, Type: types.TypeFloat, Unit: types.UnitCelsius}
+		if err := repo.Save(device); err != nil {
+			t.Fatalf("Failed to save device %v", err)
+		}
+
+		found, err := repo.FindByAddress("AA:BB", types.BasicAddress)
+		if err != nil || found == nil || found.ID != device.ID {
+			t.Fatalf("Failed to find device by address %v %v", found, err)
+		}
+		temperature := found.Capabilities[types.CapabilityTemperature]
+		if !slices.Equal(found.AdapterIDs, []string{"homekit", "mqtt"}) || !slices.Equal(found.Tags, []string{"garden"}) ||
+			temperature == nil || temperature.Value != 21.5 || temperature.Unit != types.UnitCelsius {
+			t.Fatalf("Device not saved as is %+v", found)
+		}
+		if missing, err := repo.FindByID("unknown"); missing != nil || err != nil {
+			t.Fatalf("Expected no device %v %v", missing, err)
+		}
+
+		// Update leaves the adapters and capabilities untouched
+		found.Name = "Garden sensor"
+		found.Notes = "Behind the shed"
+		if err := repo.Update(found); err != nil {
+			t.Fatalf("Failed to update device %v", err)
+		}
+		// Saving again replaces the capabilities
+		found.Capabilities = map[types.CapabilityType]*types.Capability{
+			types.CapabilityBattery: {Name: types.CapabilityBattery, Value: 80.0, Unit: types.UnitPercent},
+		}
+		found.AdapterIDs = []string{"homekit"}
+		if err := repo.Save(found); err != nil {
+			t.Fatalf("Failed to save device again %v", err)
+		}
+		saved, err := repo.FindByID(device.ID)
+		if err != nil || saved.Name != "Garden sensor" || saved.Notes != "Behind the shed" || len(saved.Capabilities) != 1 || len(saved.AdapterIDs) != 1 {
+			t.Fatalf("Device not updated %+v %v", saved, err)
+		}
+
+		// Readings update the values and add the new capabilities
+		readings := []*types.Capability{
+			{Name: types.CapabilityBattery, Value: 75.0, Unit: types.UnitPercent},
+			{Name: types.CapabilityTemperature, Value: 19.0, Unit: types.UnitCelsius},
+		}
+		if err := repo.SaveState(device.ID, readings, time.Now()); err != nil {
+			t.Fatalf("Failed to save device state %v", err)
+		}
+		saved, err = repo.FindByID(device.ID)
+		if err != nil || len(saved.Capabilities) != 2 || saved.Capabilities[types.CapabilityBattery].Value != 75.0 {
+			t.Fatalf("Device state not saved %+v %v", saved, err)
+		}
+		if err := repo.SaveState("unknown", readings, time.Now()); err != nil {
+			t.Fatalf("Saving the state of a deleted device should do nothing %v", err)
+		}
+
+		other := types.NewDevice("CC:DD", "Other", nil, types.BasicAddress)
+		if err := repo.Save(other); err != nil {
+			t.Fatalf("Failed to save device %v", err)
+		}
+		for range 2 {
+			if err := repo.LinkAdapter(other.ID, "homekit"); err != nil {
+				t.Fatalf("Failed to link adapter %v", err)
+			}
+		}
+		if err := repo.LinkAdapter("unknown", "homekit"); err == nil {
+			t.Fatalf("Linked an unknown device")
+		}
+		linked, err := repo.FindByAdapter("homekit")
+		if err != nil || len(linked) != 2 {
+			t.Fatalf("Expected 2 devices linked to homekit %v %v", linked, err)
+		}
+		if err := repo.UnlinkAdapter(other.ID, "homekit"); err != nil {
+			t.Fatalf("Failed to unlink adapter %v", err)
+		}
+
+		if err := repo.Delete(device.ID); err != nil {
+			t.Fatalf("Failed to delete device %v", err)
+		}
+		linked, err = repo.FindByAdapter("homekit")
+		if err != nil || len(linked) != 0 {
+			t.Fatalf("Links not deleted with the device %v %v", linked, err)
+		}
+		all, err := repo.FindAll()
+		if err != nil || len(all) != 1 || all[0].ID != other.ID {
+			t.Fatalf("Unexpected devices %v %v", all, err)
+		}
+	})
+}
+
+func TestConformanceAreas(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		now := time.Now()
+		house := &types.Area{ID: "house", Name: "House", CreatedAt: now}
+		kitchen := &types.Area{ID: "kitchen", Name: "Kitchen", ParentID: "house", CreatedAt: now}
+		for _, area := range []*types.Area{house, kitchen} {
+			if err := store.Areas.Save(area); err != nil {
+				t.Fatalf("Failed to save area %v", err)
+			}
+		}
+		device := types.NewDevice("AA:BB", "Sensor", nil, types.BasicAddress)
+		device.AreaID = "house"
+		if err := store.Devices.Save(device); err != nil {
+			t.Fatalf("Failed to save device %v", err)
+		}
+
+		areas, err := store.Areas.FindAll()
+		if err != nil || len(areas) != 2 || areas[0].Name != "House" {
+			t.Fatalf("Unexpected areas %v %v", areas, err)
+		}
+
+		// Children move to the parent of the deleted area, devices leave it
+		if err := store.Areas.Delete("house"); err != nil {
+			t.Fatalf("Failed to delete area %v", err)
+		}
+		if err := store.Areas.Delete("house"); err != nil {
+			t.Fatalf("Deleting a missing area failed %v", err)
+		}
+		found, err := store.Areas.FindByID("kitchen")
+		if err != nil || found == nil || found.ParentID != "" {
+			t.Fatalf("Child not moved %v %v", found, err)
+		}
+		saved, err := store.Devices.FindByID(device.ID)
+		if err != nil || saved.AreaID != "" {
+			t.Fatalf("Device still in the deleted area %v %v", saved, err)
+		}
+	})
+}
+
+func TestConformanceUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		repo := store.Users
+
+		admin := &core.User{ID: "1", Email: "admin@example.com", PasswordHash: "hash", Role: core.RoleAdmin}
+		viewer := &core.User{ID: "2", Email: "viewer@example.com", PasswordHash: "hash", Role: core.RoleViewer}
+		for _, user := range []*core.User{admin, viewer} {
+			if err := repo.Save(user); err != nil {
+				t.Fatalf("Failed to save user %v", err)
+			}
+		}
+		if err := repo.Save(&core.User{ID: "3", Email: "admin@example.com", Role: core.RoleViewer}); err == nil {
+			t.Fatalf("Saved two users with the same email")
+		}
+
+		found, err := repo.FindByEmail("admin@example.com")
+		if err != nil || found == nil || found.ID != "1" || found.Role != core.RoleAdmin || found.CreatedAt.IsZero() {
+			t.Fatalf("Failed to find user by email %+v %v", found, err)
+		}
+		if missing, err := repo.FindByID("unknown"); missing != nil || err != nil {
+			t.Fatalf("Expected no user %v %v", missing, err)
+		}
+
+		viewer.Role = core.RoleMember
+		viewer.TotpEnabled = true
+		viewer.TotpSecret = "secret"
+		if err := repo.Save(viewer); err != nil {
+			t.Fatalf("Failed to update user %v", err)
+		}
+		found, err = repo.FindByID("2")
+		if err != nil || found.Role != core.RoleMember || !found.TotpEnabled || found.TotpSecret != "secret" {
+			t.Fatalf("User not updated %+v %v", found, err)
+		}
+
+		// Steps only move forward
+		if ok, err := repo.UpdateTotpLastStep("2", 10); !ok || err != nil {
+			t.Fatalf("Failed to update the totp step %v", err)
+		}
+		if ok, err := repo.UpdateTotpLastStep("2", 10); ok || err != nil {
+			t.Fatalf("Used the same totp step twice %v", err)
+		}
+
+		count, err := repo.Count()
+		if err != nil || *count != 2 {
+			t.Fatalf("Expected 2 users %v", err)
+		}
+		if admins, err := repo.CountByRole(core.RoleAdmin); err != nil || admins != 1 {
+			t.Fatalf("Expected 1 admin, got %d %v", admins, err)
+		}
+
+		if err := repo.Delete("1"); err != nil {
+			t.Fatalf("Failed to delete user %v", err)
+		}
+		users, err := repo.FindAll()
+		if err != nil || len(users) != 1 || users[0].ID != "2" {
+			t.Fatalf("Unexpected users %v %v", users, err)
+		}
+	})
+}
+
+func TestConformanceInvitationsAndPasswordResets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		now := time.Now()
+
+		expired := &core.Invitation{ID: "1", Email: "a@example.com", Role: core.RoleViewer, TokenHash: "a", CreatedBy: "admin", ExpiresAt: now.Add(-time.Hour), CreatedAt: now}
+		valid := &core.Invitation{ID: "2", Email: "b@example.com", Role: core.RoleMember, TokenHash: "b", CreatedBy: "admin", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+		for _, invitation := range []*core.Invitation{expired, valid} {
+			if err := store.Invitations.Save(invitation); err != nil {
+				t.Fatalf("Failed to save invitation %v", err)
+			}
+		}
+		if err := store.Invitations.DeleteExpired(now); err != nil {
+			t.Fatalf("Failed to delete expired invitations %v", err)
+		}
+		invitations, err := store.Invitations.FindAll()
+		if err != nil || len(invitations) != 1 || invitations[0].ID != "2" {
+			t.Fatalf("Unexpected invitations %v %v", invitations, err)
+		}
+		found, err := store.Invitations.FindByTokenHash("b")
+		if err != nil || found == nil || found.Role != core.RoleMember {
+			t.Fatalf("Failed to find invitation %v %v", found, err)
+		}
+		if err := store.Invitations.Delete("2"); err != nil {
+			t.Fatalf("Failed to delete invitation %v", err)
+		}
+		if found, err := store.Invitations.FindByTokenHash("b"); found != nil || err != nil {
+			t.Fatalf("Invitation not deleted %v %v", found, err)
+		}
+
+		reset := &core.PasswordReset{TokenHash: "reset", UserID: "1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+		if err := store.PasswordResets.Save(reset); err != nil {
+			t.Fatalf("Failed to save password reset %v", err)
+		}
+		foundReset, err := store.PasswordResets.FindByTokenHash("reset")
+		if err != nil || foundReset == nil || foundReset.UserID != "1" {
+			t.Fatalf("Failed to find password reset %v %v", foundReset, err)
+		}
+		if err := store.PasswordResets.DeleteByUser("1"); err != nil {
+			t.Fatalf("Failed to delete password resets %v", err)
+		}
+		if foundReset, err := store.PasswordResets.FindByTokenHash("reset"); foundReset != nil || err != nil {
+			t.Fatalf("Password reset not deleted %v %v", foundReset, err)
+		}
+	})
+}
+
+func TestConformanceApiTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		repo := store.ApiTokens
+		now := time.Now()
+
+		token := &core.ApiToken{ID: "1", UserID: "alice", Name: "script", Scope: core.ScopeRead, TokenHash: "hash", CreatedAt: now}
+		if err := repo.Save(token); err != nil {
+			t.Fatalf("Failed to save api token %v", err)
+		}
+		found, err := repo.FindByTokenHash("hash")
+		if err != nil || found == nil || found.ExpiresAt != nil || found.LastUsedAt != nil || found.Scope != core.ScopeRead {
+			t.Fatalf("Failed to find api token %+v %v", found, err)
+		}
+
+		if err := repo.UpdateLastUsed("1", now); err != nil {
+			t.Fatalf("Failed to update last use %v", err)
+		}
+		tokens, err := repo.FindByUser("alice")
+		if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+			t.Fatalf("Last use not saved %v %v", tokens, err)
+		}
+
+		// Only the owner deletes a token
+		if deleted, err := repo.Delete("1", "bob"); deleted || err != nil {
+			t.Fatalf("Deleted the token of another user %v", err)
+		}
+		if deleted, err := repo.Delete("1", "alice"); !deleted || err != nil {
+			t.Fatalf("Failed to delete api token %v", err)
+		}
+
+		if err := repo.Save(&core.ApiToken{ID: "2", UserID: "alice", Name: "other", Scope: core.ScopeWrite, TokenHash: "other", ExpiresAt: &now, CreatedAt: now}); err != nil {
+			t.Fatalf("Failed to save api token %v", err)
+		}
+		if err := repo.DeleteByUser("alice"); err != nil {
+			t.Fatalf("Failed to delete api tokens %v", err)
+		}
+		if tokens, err := repo.FindByUser("alice"); err != nil || len(tokens) != 0 {
+			t.Fatalf("Api tokens not deleted %v %v", tokens, err)
+		}
+	})
+}
+
+func TestConformanceSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		repo := store.Sessions
+		now := time.Now()
+
+		for _, id := range []string{"a", "b", "c"} {
+			session := &core.Session{ID: id, UserID: "alice", Data: []byte("data"), IP: "127.0.0.1", CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+			if err := repo.Save(session); err != nil {
+				t.Fatalf("Failed to save session %v", err)
+			}
+		}
+		// Saving again updates the session
+		if err := repo.Save(&core.Session{ID: "a", UserID: "alice", Data: []byte("updated"), IP: "127.0.0.1", CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("Failed to update session %v", err)
+		}
+		found, err := repo.FindByID("a")
+		if err != nil || found == nil || string(found.Data) != "updated" {
+			t.Fatalf("Session not updated %v %v", found, err)
+		}
+
+		if err := repo.Touch("b", now.Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to touch session %v", err)
+		}
+		sessions, err := repo.FindByUser("alice")
+		if err != nil || len(sessions) != 3 || sessions[0].ID != "b" {
+			t.Fatalf("Expected the last seen session first %v %v", sessions, err)
+		}
+
+		if deleted, err := repo.DeleteForUser("a", "bob"); deleted || err != nil {
+			t.Fatalf("Deleted the session of another user %v", err)
+		}
+		if err := repo.DeleteByUser("alice", "a"); err != nil {
+			t.Fatalf("Failed to delete sessions %v", err)
+		}
+		if sessions, err := repo.FindByUser("alice"); err != nil || len(sessions) != 1 || sessions[0].ID != "a" {
+			t.Fatalf("Expected only the kept session %v %v", sessions, err)
+		}
+
+		if err := repo.DeleteExpired(now.Add(2*time.Hour), now.Add(-time.Hour)); err != nil {
+			t.Fatalf("Failed to delete expired sessions %v", err)
+		}
+		if found, err := repo.FindByID("a"); found != nil || err != nil {
+			t.Fatalf("Expired session not deleted %v %v", found, err)
+		}
+	})
+}
+
+func TestConformanceAuditAndRecoveryCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		for _, auditType := range []core.AuditType{core.AuditLoginFailed, core.AuditLoginSucceeded, core.AuditLogout} {
+			entry := &core.AuditEntry{Type: auditType, UserID: "alice", IP: "127.0.0.1", CreatedAt: time.Now()}
+			if err := store.Audit.Save(entry); err != nil {
+				t.Fatalf("Failed to save audit entry %v", err)
+			}
+			if entry.ID == 0 {
+				t.Fatalf("No id assigned to the audit entry")
+			}
+		}
+		entries, err := store.Audit.FindRecent(2)
+		if err != nil || len(entries) != 2 || entries[0].Type != core.AuditLogout || entries[1].Type != core.AuditLoginSucceeded {
+			t.Fatalf("Expected the 2 most recent entries %v %v", entries, err)
+		}
+
+		codes := []*core.RecoveryCode{
+			{ID: "1", Hint: "ab", CodeHash: "h1"},
+			{ID: "2", Hint: "ab", CodeHash: "h2"},
+			{ID: "3", Hint: "cd", CodeHash: "h3"},
+		}
+		if err := store.RecoveryCodes.Replace("alice", codes); err != nil {
+			t.Fatalf("Failed to save recovery codes %v", err)
+		}
+		found, err := store.RecoveryCodes.FindByHint("alice", "ab")
+		if err != nil || len(found) != 2 || found[0].UserID != "alice" {
+			t.Fatalf("Unexpected recovery codes %v %v", found, err)
+		}
+		if deleted, err := store.RecoveryCodes.Delete("1"); !deleted || err != nil {
+			t.Fatalf("Failed to use recovery code %v", err)
+		}
+		if deleted, err := store.RecoveryCodes.Delete("1"); deleted || err != nil {
+			t.Fatalf("Used a recovery code twice %v", err)
+		}
+		if err := store.RecoveryCodes.Replace("alice", codes[2:]); err != nil {
+			t.Fatalf("Failed to replace recovery codes %v", err)
+		}
+		if found, err := store.RecoveryCodes.FindByHint("alice", "ab"); err != nil || len(found) != 0 {
+			t.Fatalf("Previous recovery codes still work %v %v", found, err)
+		}
+		if err := store.RecoveryCodes.DeleteByUser("alice"); err != nil {
+			t.Fatalf("Failed to delete recovery codes %v", err)
+		}
+	})
+}
+
+func TestConformancePluginCredentials(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		repo := store.PluginCredentials
+		now := time.Now()
+
+		if err := repo.Save(&core.PluginCredential{PluginID: "homekit", PluginType: plugin.PluginAdapter, PasswordHash: "first", CreatedAt: now}); err != nil {
+			t.Fatalf("Failed to save plugin credential %v", err)
+		}
+		// Issuing again replaces the password
+		if err := repo.Save(&core.PluginCredential{PluginID: "homekit", PluginType: plugin.PluginAdapter, PasswordHash: "second", CreatedAt: now}); err != nil {
+			t.Fatalf("Failed to replace plugin credential %v", err)
+		}
+		found, err := repo.FindByPluginID("homekit")
+		if err != nil || found == nil || found.PasswordHash != "second" || found.PluginType != plugin.PluginAdapter {
+			t.Fatalf("Failed to find plugin credential %+v %v", found, err)
+		}
+		if missing, err := repo.FindByPluginID("unknown"); missing != nil || err != nil {
+			t.Fatalf("Found an unknown plugin %+v %v", missing, err)
+		}
+
+		if err := repo.Save(&core.PluginCredential{PluginID: "bluetooth", PluginType: plugin.PluginScanner, PasswordHash: "hash", CreatedAt: now}); err != nil {
+			t.Fatalf("Failed to save plugin credential %v", err)
+		}
+		all, err := repo.FindAll()
+		if err != nil || len(all) != 2 || all[0].PluginID != "bluetooth" {
+			t.Fatalf("Failed to list plugin credentials %v %v", all, err)
+		}
+
+		if deleted, err := repo.Delete("homekit"); !deleted || err != nil {
+			t.Fatalf("Failed to delete plugin credential %v", err)
+		}
+		if deleted, err := repo.Delete("homekit"); deleted || err != nil {
+			t.Fatalf("Deleted a plugin credential twice %v", err)
+		}
+	})
+}
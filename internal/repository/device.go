@@ -4,178 +4,311 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-
-	"slices"
+	"strings"
+	"time"
 
 	"github.com/Bastien2203/go-home/shared/types"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type DeviceRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewDeviceRepository(db *sql.DB) (*DeviceRepository, error) {
-	query := `
-	CREATE TABLE IF NOT EXISTS devices (
-		id TEXT PRIMARY KEY,
-		address TEXT,
-		address_type TEXT,
-		name TEXT,
-		adapter_ids TEXT,
-		created_at DATETIME,
-		capabilities TEXT,
-		last_updated DATETIME
-	);
-	CREATE INDEX IF NOT EXISTS idx_device_address ON devices(address, address_type);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create devices table: %w", err)
-	}
+const deviceColumns = `id, address, address_type, name, created_at, last_updated, area_id, icon, manufacturer, model, notes, tags`
 
-	return &DeviceRepository{db: db}, nil
+func NewDeviceRepository(db *DB) *DeviceRepository {
+	return &DeviceRepository{db: db}
 }
 
+// Delete removes the device, its adapter links and capabilities are deleted with it
 func (r *DeviceRepository) Delete(deviceId string) error {
 	query := `DELETE FROM devices WHERE id = ?`
 	_, err := r.db.Exec(query, deviceId)
 	return err
 }
 
+// Save creates or replaces the device with its adapters and capabilities
 func (r *DeviceRepository) Save(device *types.Device) error {
-	adapterIDsJson, err := json.Marshal(device.AdapterIDs)
+	tagsJson, err := marshalTags(device.Tags)
 	if err != nil {
-		return fmt.Errorf("failed to marshal adapter_ids: %w", err)
+		return err
 	}
 
-	capabilitiesJson, err := json.Marshal(device.Capabilities)
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to marshal capabilities: %w", err)
+		return err
 	}
+	defer tx.Rollback()
 
 	query := `
-	INSERT OR REPLACE INTO devices 
-	(id, address, address_type, name, adapter_ids, created_at, capabilities, last_updated)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO devices (` + deviceColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		address = excluded.address,
+		address_type = excluded.address_type,
+		name = excluded.name,
+		created_at = excluded.created_at,
+		last_updated = excluded.last_updated,
+		area_id = excluded.area_id,
+		icon = excluded.icon,
+		manufacturer = excluded.manufacturer,
+		model = excluded.model,
+		notes = excluded.notes,
+		tags = excluded.tags
 	`
-
-	_, err = r.db.Exec(query,
+	_, err = tx.Exec(query,
 		device.ID,
 		device.Address,
 		device.AddressType,
 		device.Name,
-		string(adapterIDsJson),
 		device.CreatedAt,
-		string(capabilitiesJson),
 		device.LastUpdated,
+		device.AreaID,
+		device.Icon,
+		device.Manufacturer,
+		device.Model,
+		device.Notes,
+		tagsJson,
 	)
-
 	if err != nil {
 		return fmt.Errorf("failed to save device: %w", err)
 	}
 
-	return nil
-}
-
-func (r *DeviceRepository) FindByID(id string) (*types.Device, error) {
-	query := `SELECT id, address, address_type, name, adapter_ids, created_at, capabilities, last_updated FROM devices WHERE id = ?`
+	if _, err := tx.Exec(`DELETE FROM device_adapters WHERE device_id = ?`, device.ID); err != nil {
+		return err
+	}
+	if err := insertDeviceAdapters(tx, device.ID, device.AdapterIDs); err != nil {
+		return fmt.Errorf("failed to save device adapters: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM device_capabilities WHERE device_id = ?`, device.ID); err != nil {
+		return err
+	}
+	if err := insertDeviceCapabilities(tx, device.ID, device.Capabilities); err != nil {
+		return fmt.Errorf("failed to save device capabilities: %w", err)
+	}
 
-	row := r.db.QueryRow(query, id)
-	return r.scanDevice(row)
+	return tx.Commit()
 }
 
-func (r *DeviceRepository) FindAll() ([]*types.Device, error) {
-	query := `SELECT id, address, address_type, name, adapter_ids, created_at, capabilities, last_updated FROM devices ORDER BY id`
-
-	rows, err := r.db.Query(query)
-	if err != nil {
-		return nil, err
+func insertDeviceAdapters(tx *Tx, deviceID string, adapterIDs []string) error {
+	for _, adapterID := range adapterIDs {
+		if _, err := tx.Exec(`INSERT INTO device_adapters (device_id, adapter_id) VALUES (?, ?) ON CONFLICT DO NOTHING`, deviceID, adapterID); err != nil {
+			return err
+		}
 	}
-	defer rows.Close()
+	return nil
+}
 
-	var devices []*types.Device
-	for rows.Next() {
-		device, err := r.scanDevice(rows)
+func insertDeviceCapabilities(tx *Tx, deviceID string, capabilities map[types.CapabilityType]*types.Capability) error {
+	for name, c := range capabilities {
+		if c == nil {
+			continue
+		}
+		value, err := json.Marshal(c.Value)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to marshal value of %s: %w", name, err)
+		}
+		query := `INSERT INTO device_capabilities (device_id, name, type, unit, value) VALUES (?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(query, deviceID, name, c.Type, c.Unit, string(value)); err != nil {
+			return err
 		}
-		devices = append(devices, device)
 	}
-	return devices, nil
-}
-
-func (r *DeviceRepository) FindByAddress(address string, addressType types.AddressType) (*types.Device, error) {
-	query := `SELECT id, address, address_type, name, adapter_ids, created_at, capabilities, last_updated FROM devices WHERE address = ? AND address_type = ?`
-
-	row := r.db.QueryRow(query, address, addressType)
-	return r.scanDevice(row)
+	return nil
 }
 
-func (r *DeviceRepository) LinkAdapter(deviceID, adapterID string) error {
+// SaveState upserts the latest capability values of a device, nothing is saved once the device is deleted
+func (r *DeviceRepository) SaveState(deviceID string, capabilities []*types.Capability, lastUpdated time.Time) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	device, err := r.FindByID(deviceID)
+	result, err := tx.Exec(`UPDATE devices SET last_updated = ? WHERE id = ?`, lastUpdated, deviceID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to save device state: %w", err)
 	}
-	if device == nil {
-		return nil // Device not found
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return err
 	}
 
-	if slices.Contains(device.AdapterIDs, adapterID) {
-		return nil
+	for _, c := range capabilities {
+		value, err := json.Marshal(c.Value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal value of %s: %w", c.Name, err)
+		}
+		query := `
+		INSERT INTO device_capabilities (device_id, name, type, unit, value) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(device_id, name) DO UPDATE SET type = excluded.type, unit = excluded.unit, value = excluded.value
+		`
+		if _, err := tx.Exec(query, deviceID, c.Name, c.Type, c.Unit, string(value)); err != nil {
+			return fmt.Errorf("failed to save device state: %w", err)
+		}
 	}
+	return tx.Commit()
+}
 
-	device.AdapterIDs = append(device.AdapterIDs, adapterID)
+// Update saves the name, address and metadata of a device, its adapters and state are left untouched
+func (r *DeviceRepository) Update(device *types.Device) error {
+	tagsJson, err := marshalTags(device.Tags)
+	if err != nil {
+		return err
+	}
 
-	adapterIDsJson, _ := json.Marshal(device.AdapterIDs)
+	query := `
+	UPDATE devices SET address = ?, address_type = ?, name = ?, area_id = ?, icon = ?, manufacturer = ?, model = ?, notes = ?, tags = ?
+	WHERE id = ?
+	`
+	_, err = r.db.Exec(query,
+		device.Address,
+		device.AddressType,
+		device.Name,
+		device.AreaID,
+		device.Icon,
+		device.Manufacturer,
+		device.Model,
+		device.Notes,
+		tagsJson,
+		device.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	return nil
+}
 
-	_, err = tx.Exec(`UPDATE devices SET adapter_ids = ? WHERE id = ?`, string(adapterIDsJson), deviceID)
+func marshalTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	tagsJson, err := json.Marshal(tags)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to marshal tags: %w", err)
 	}
+	return string(tagsJson), nil
+}
 
-	return tx.Commit()
+func (r *DeviceRepository) FindByID(id string) (*types.Device, error) {
+	return r.findOne(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`, id)
+}
+
+func (r *DeviceRepository) FindAll() ([]*types.Device, error) {
+	return r.findMany(`SELECT ` + deviceColumns + ` FROM devices ORDER BY id`)
+}
+
+func (r *DeviceRepository) FindByAddress(address string, addressType types.AddressType) (*types.Device, error) {
+	return r.findOne(`SELECT `+deviceColumns+` FROM devices WHERE address = ? AND address_type = ?`, address, addressType)
+}
+
+// FindByAdapter returns the devices linked to the adapter
+func (r *DeviceRepository) FindByAdapter(adapterID string) ([]*types.Device, error) {
+	query := `
+	SELECT ` + deviceColumns + ` FROM devices
+	WHERE id IN (SELECT device_id FROM device_adapters WHERE adapter_id = ?)
+	ORDER BY id
+	`
+	return r.findMany(query, adapterID)
+}
+
+// LinkAdapter does nothing when the device is already linked to the adapter
+func (r *DeviceRepository) LinkAdapter(deviceID, adapterID string) error {
+	_, err := r.db.Exec(`INSERT INTO device_adapters (device_id, adapter_id) VALUES (?, ?) ON CONFLICT DO NOTHING`, deviceID, adapterID)
+	return err
 }
 
 func (r *DeviceRepository) UnlinkAdapter(deviceID, adapterID string) error {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
+	_, err := r.db.Exec(`DELETE FROM device_adapters WHERE device_id = ? AND adapter_id = ?`, deviceID, adapterID)
+	return err
+}
+
+func (r *DeviceRepository) findOne(query string, args ...any) (*types.Device, error) {
+	device, err := r.scanDevice(r.db.QueryRow(query, args...))
+	if err != nil || device == nil {
+		return device, err
 	}
-	defer tx.Rollback()
+	if err := r.loadRelations([]*types.Device{device}); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
 
-	device, err := r.FindByID(deviceID)
+func (r *DeviceRepository) findMany(query string, args ...any) ([]*types.Device, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if device == nil {
-		return nil
+	defer rows.Close()
+
+	var devices []*types.Device
+	for rows.Next() {
+		device, err := r.scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	device.AdapterIDs = slices.DeleteFunc(device.AdapterIDs, func(e string) bool {
-		return e == adapterID
-	})
+	if err := r.loadRelations(devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
 
-	adapterIDsJson, _ := json.Marshal(device.AdapterIDs)
+// loadRelations loads the adapters and capabilities of the devices, with one query for each table
+func (r *DeviceRepository) loadRelations(devices []*types.Device) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	byID := make(map[string]*types.Device, len(devices))
+	ids := make([]any, 0, len(devices))
+	for _, device := range devices {
+		byID[device.ID] = device
+		ids = append(ids, device.ID)
+	}
+	in := `(?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
 
-	_, err = tx.Exec(`UPDATE devices SET adapter_ids = ? WHERE id = ?`, string(adapterIDsJson), deviceID)
+	rows, err := r.db.Query(`SELECT device_id, adapter_id FROM device_adapters WHERE device_id IN `+in+` ORDER BY adapter_id`, ids...)
 	if err != nil {
 		return err
 	}
+	for rows.Next() {
+		var deviceID, adapterID string
+		if err := rows.Scan(&deviceID, &adapterID); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[deviceID].AdapterIDs = append(byID[deviceID].AdapterIDs, adapterID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	rows, err = r.db.Query(`SELECT device_id, name, type, unit, value FROM device_capabilities WHERE device_id IN `+in, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deviceID, valueJson string
+		var c types.Capability
+		if err := rows.Scan(&deviceID, &c.Name, &c.Type, &c.Unit, &valueJson); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(valueJson), &c.Value); err != nil {
+			return fmt.Errorf("failed to unmarshal value of %s: %w", c.Name, err)
+		}
+		byID[deviceID].Capabilities[c.Name] = &c
+	}
+	return rows.Err()
 }
 
 func (r *DeviceRepository) scanDevice(row Scanner) (*types.Device, error) {
 	var d types.Device
-	var adapterIDsJson []byte
-	var capabilitiesJson []byte
+	var tagsJson []byte
 	var addressType string
 
 	err := row.Scan(
@@ -183,10 +316,14 @@ func (r *DeviceRepository) scanDevice(row Scanner) (*types.Device, error) {
 		&d.Address,
 		&addressType,
 		&d.Name,
-		&adapterIDsJson,
 		&d.CreatedAt,
-		&capabilitiesJson,
 		&d.LastUpdated,
+		&d.AreaID,
+		&d.Icon,
+		&d.Manufacturer,
+		&d.Model,
+		&d.Notes,
+		&tagsJson,
 	)
 
 	if err == sql.ErrNoRows {
@@ -198,21 +335,17 @@ func (r *DeviceRepository) scanDevice(row Scanner) (*types.Device, error) {
 
 	d.AddressType = types.AddressType(addressType)
 
-	if len(adapterIDsJson) > 0 {
-		if err := json.Unmarshal(adapterIDsJson, &d.AdapterIDs); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal adapter_ids: %w", err)
+	if len(tagsJson) > 0 {
+		if err := json.Unmarshal(tagsJson, &d.Tags); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
 		}
 	}
-
-	if len(capabilitiesJson) > 0 {
-		if err := json.Unmarshal(capabilitiesJson, &d.Capabilities); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal capabilities: %w", err)
-		}
+	if d.Tags == nil {
+		d.Tags = []string{}
 	}
 
-	if d.Capabilities == nil {
-		d.Capabilities = make(map[types.CapabilityType]*types.Capability)
-	}
+	d.AdapterIDs = []string{}
+	d.Capabilities = make(map[types.CapabilityType]*types.Capability)
 
 	return &d, nil
 }
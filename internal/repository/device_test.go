@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func TestDeviceAdapterLinks(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+	repo := NewDeviceRepository(db)
+
+	device := types.NewDevice("AA:BB", "Sensor", []string{"homekit"}, types.BasicAddress)
+	device.Capabilities[types.CapabilityBattery] = &types.Capability{Name: types.CapabilityBattery, Value: 80.0, Unit: types.UnitPercent}
+	if err := repo.Save(device); err != nil {
+		t.Fatalf("Failed to save device %v", err)
+	}
+	other := types.NewDevice("CC:DD", "Other", nil, types.BasicAddress)
+	if err := repo.Save(other); err != nil {
+		t.Fatalf("Failed to save device %v", err)
+	}
+
+	// Linking twice is a no-op
+	for range 2 {
+		if err := repo.LinkAdapter(device.ID, "mqtt"); err != nil {
+			t.Fatalf("Failed to link adapter %v", err)
+		}
+	}
+	if err := repo.LinkAdapter("unknown", "mqtt"); err == nil {
+		t.Fatalf("Linked an unknown device")
+	}
+
+	devices, err := repo.FindByAdapter("mqtt")
+	if err != nil || len(devices) != 1 || devices[0].ID != device.ID {
+		t.Fatalf("Unexpected devices of mqtt %v %v", devices, err)
+	}
+	if len(devices[0].AdapterIDs) != 2 || devices[0].Capabilities[types.CapabilityBattery].Value != 80.0 {
+		t.Fatalf("Relations not loaded %+v", devices[0])
+	}
+
+	if err := repo.UnlinkAdapter(device.ID, "homekit"); err != nil {
+		t.Fatalf("Failed to unlink adapter %v", err)
+	}
+	if devices, _ := repo.FindByAdapter("homekit"); len(devices) != 0 {
+		t.Fatalf("Device still linked to homekit")
+	}
+
+	// Links and capabilities are deleted with the device
+	if err := repo.Delete(device.ID); err != nil {
+		t.Fatalf("Failed to delete device %v", err)
+	}
+	var count int
+	db.QueryRow(`SELECT (SELECT COUNT(*) FROM device_adapters) + (SELECT COUNT(*) FROM device_capabilities)`).Scan(&count)
+	if count != 0 {
+		t.Fatalf("%d rows left after deleting the device", count)
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type InvitationRepository struct {
+	db *DB
+}
+
+func NewInvitationRepository(db *DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+func (r *InvitationRepository) Save(invitation *core.Invitation) error {
+	query := `
+	INSERT INTO invitations
+	(id, email, role, token_hash, created_by, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		email = excluded.email,
+		role = excluded.role,
+		token_hash = excluded.token_hash,
+		created_by = excluded.created_by,
+		expires_at = excluded.expires_at,
+		created_at = excluded.created_at
+	`
+
+	_, err := r.db.Exec(query,
+		invitation.ID,
+		invitation.Email,
+		invitation.Role,
+		invitation.TokenHash,
+		invitation.CreatedBy,
+		invitation.ExpiresAt,
+		invitation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *InvitationRepository) Delete(id string) error {
+	query := `DELETE FROM invitations WHERE id = ?`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+func (r *InvitationRepository) DeleteExpired(now time.Time) error {
+	query := `DELETE FROM invitations WHERE expires_at < ?`
+	_, err := r.db.Exec(query, now)
+	return err
+}
+
+func (r *InvitationRepository) FindAll() ([]*core.Invitation, error) {
+	query := `SELECT id, email, role, token_hash, created_by, expires_at, created_at FROM invitations ORDER BY created_at`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*core.Invitation{}
+	for rows.Next() {
+		i, err := r.scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *InvitationRepository) FindByTokenHash(tokenHash string) (*core.Invitation, error) {
+	query := `SELECT id, email, role, token_hash, created_by, expires_at, created_at FROM invitations WHERE token_hash = ?`
+
+	row := r.db.QueryRow(query, tokenHash)
+	return r.scanInvitation(row)
+}
+
+func (r *InvitationRepository) scanInvitation(row Scanner) (*core.Invitation, error) {
+	var i core.Invitation
+
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.TokenHash,
+		&i.CreatedBy,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
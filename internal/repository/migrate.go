@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var sqlMigrations embed.FS
+
+// Migration brings the schema from the previous version to Version. SQL migrations are the files of the
+// migrations/{dialect} directory named {version}_{name}.sql, Go migrations are listed in goMigrations.
+// Each dialect has its own versions, PostgreSQL support started from the current schema.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *Tx) error
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil while pending
+}
+
+// migrations returns the SQL and Go migrations of the dialect sorted by version, versions must follow each other
+func migrations(dialect Dialect) ([]Migration, error) {
+	var list []Migration
+	if dialect == DialectSQLite {
+		list = slices.Clone(goMigrations)
+	}
+
+	files, err := fs.Glob(sqlMigrations, "migrations/"+string(dialect)+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		number, name, found := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+		query, err := sqlMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: name, up: func(tx *Tx) error {
+			_, err := tx.Exec(string(query))
+			return err
+		}})
+	}
+
+	slices.SortFunc(list, func(a, b Migration) int { return a.Version - b.Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing or duplicated, found %d_%s", i+1, m.Version, m.Name)
+		}
+	}
+	return list, nil
+}
+
+func createMigrationsTable(db *DB) error {
+	timestamp := "DATETIME"
+	if db.Dialect() == DialectPostgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + timestamp + ` NOT NULL
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations only reads, none are applied while the schema_migrations table does not exist
+func appliedMigrations(db *DB) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	exists, err := tableExists(db, "schema_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func tableExists(db *DB, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if db.Dialect() == DialectPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+// Migrate applies the pending migrations, each one in its own transaction
+func Migrate(db *DB) error {
+	list, err := migrations(db.Dialect())
+	if err != nil {
+		return err
+	}
+	if err := createMigrationsTable(db); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for version := range applied {
+		if version > len(list) {
+			return fmt.Errorf("database schema version %d is newer than this version of go-home (%d)", version, len(list))
+		}
+	}
+
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("[Database] Migration %04d_%s applied", m.Version, m.Name)
+	}
+	return nil
+}
+
+func applyMigration(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationStatuses does not write to the database, it can be called before the first migration
+func MigrationStatuses(db *DB) ([]MigrationStatus, error) {
+	list, err := migrations(db.Dialect())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(list))
+	for _, m := range list {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Databases created before migrations existed may already have the columns added by a migration, SQLite only
+func addColumnIfNotExists(tx *Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+func columnExists(tx *Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func openTestDB(t *testing.T) *DB {
+	db, err := OpenSQLiteDB(filepath.Join(t.TempDir(), "test.db"), DefaultSQLiteOptions())
+	if err != nil {
+		t.Fatalf("Failed to open db %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func pendingMigrations(t *testing.T, db *DB) int {
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("Failed to read migration statuses %v", err)
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	if pendingMigrations(t, db) == 0 {
+		t.Fatalf("No pending migration on a new database")
+	}
+	// Reading the statuses does not create the table
+	if exists, err := tableExists(db, "schema_migrations"); err != nil || exists {
+		t.Fatalf("schema_migrations created by a status query %v", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+	if pending := pendingMigrations(t, db); pending != 0 {
+		t.Fatalf("%d migrations still pending", pending)
+	}
+
+	// Nothing to apply the second time
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Second migration failed %v", err)
+	}
+}
+
+// Databases created before migrations existed have their tables and some of the columns
+func TestMigrateDatabaseWithoutVersion(t *testing.T) {
+	db := openTestDB(t)
+
+	legacy := `
+	CREATE TABLE devices (id TEXT PRIMARY KEY, address TEXT, address_type TEXT, name TEXT, adapter_ids TEXT,
+		created_at DATETIME, capabilities TEXT, last_updated DATETIME, icon TEXT NOT NULL DEFAULT '');
+	CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT UNIQUE, password_hash TEXT, created_at DATETIME, role TEXT NOT NULL DEFAULT 'admin');
+	INSERT INTO devices (id, address, address_type, name, created_at, last_updated, adapter_ids, capabilities) VALUES
+		('1', 'a', 'basic', 'a', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, '["homekit","mqtt"]',
+			'{"temperature":{"name":"temperature","value":21.5,"type":"float","unit":"celsius"}}'),
+		('2', 'b', 'basic', 'b', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'null', ''),
+		('3', 'c', 'basic', 'c', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, '[]', '{}');
+	INSERT INTO users (id, email, role) VALUES ('1', 'a@example.com', 'member');
+	`
+	if _, err := db.Exec(legacy); err != nil {
+		t.Fatalf("Failed to create legacy schema %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+
+	device, err := NewDeviceRepository(db).FindByID("1")
+	if err != nil || device == nil {
+		t.Fatalf("Failed to find device %v", err)
+	}
+	temperature := device.Capabilities[types.CapabilityTemperature]
+	if len(device.AdapterIDs) != 2 || device.AdapterIDs[1] != "mqtt" || temperature == nil || temperature.Value != 21.5 || temperature.Unit != types.UnitCelsius {
+		t.Fatalf("Adapters or capabilities not migrated %+v", device)
+	}
+
+	var role string
+	var totpEnabled bool
+	if err := db.QueryRow(`SELECT role, totp_enabled FROM users WHERE id = '1'`).Scan(&role, &totpEnabled); err != nil || role != "member" {
+		t.Fatalf("Users not migrated %s %v", role, err)
+	}
+}
+
+func TestRefuseNewerDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migration failed %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (1000, 'future', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("Failed to insert migration %v", err)
+	}
+
+	if err := Migrate(db); err == nil {
+		t.Fatalf("Migrated a database of a newer version")
+	}
+}
+
+func TestMigrationsOfEveryDialect(t *testing.T) {
+	for _, dialect := range []Dialect{DialectSQLite, DialectPostgres} {
+		list, err := migrations(dialect)
+		if err != nil || len(list) == 0 {
+			t.Fatalf("Invalid %s migrations %v %v", dialect, list, err)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := `UPDATE devices SET area_id = '', notes = 'why?' WHERE area_id = ? AND id IN (?, ?)`
+
+	if got := DialectSQLite.rebind(query); got != query {
+		t.Fatalf("SQLite query changed %s", got)
+	}
+	expected := `UPDATE devices SET area_id = '', notes = 'why?' WHERE area_id = $1 AND id IN ($2, $3)`
+	if got := DialectPostgres.rebind(query); got != expected {
+		t.Fatalf("Unexpected postgres query %s", got)
+	}
+}
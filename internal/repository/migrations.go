@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+// Migrations of SQLite databases needing more than SQL, versions are shared with the files of migrations/sqlite
+var goMigrations = []Migration{
+	{Version: 2, Name: "user_roles_and_totp", up: addUserRolesAndTotp},
+	{Version: 3, Name: "device_metadata", up: addDeviceMetadata},
+	{Version: 5, Name: "device_adapters_and_capabilities", up: normalizeDeviceAdaptersAndCapabilities},
+}
+
+func addUserRolesAndTotp(tx *Tx) error {
+	columns := []struct{ name, definition string }{
+		// Before roles existed the only account was the owner of the instance
+		{"role", "TEXT NOT NULL DEFAULT 'admin'"},
+		{"totp_enabled", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfNotExists(tx, "users", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addDeviceMetadata(tx *Tx) error {
+	for _, column := range []string{"icon", "manufacturer", "model", "notes"} {
+		if err := addColumnIfNotExists(tx, "devices", column, `TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return addColumnIfNotExists(tx, "devices", "tags", `TEXT NOT NULL DEFAULT '[]'`)
+}
+
+// Adapters and capabilities of devices were JSON arrays and objects in the devices table
+func normalizeDeviceAdaptersAndCapabilities(tx *Tx) error {
+	query := `
+	CREATE TABLE device_adapters (
+		device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		adapter_id TEXT NOT NULL,
+		PRIMARY KEY (device_id, adapter_id)
+	);
+	CREATE INDEX idx_device_adapters_adapter ON device_adapters(adapter_id);
+
+	CREATE TABLE device_capabilities (
+		device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT '',
+		unit TEXT NOT NULL DEFAULT '',
+		value TEXT NOT NULL DEFAULT 'null',
+		PRIMARY KEY (device_id, name)
+	);
+	`
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	type blobs struct {
+		deviceID                 string
+		adapterIDs, capabilities []byte
+	}
+	rows, err := tx.Query(`SELECT id, adapter_ids, capabilities FROM devices`)
+	if err != nil {
+		return err
+	}
+	var devices []blobs
+	for rows.Next() {
+		var b blobs
+		if err := rows.Scan(&b.deviceID, &b.adapterIDs, &b.capabilities); err != nil {
+			rows.Close()
+			return err
+		}
+		devices = append(devices, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		var adapterIDs []string
+		if len(d.adapterIDs) > 0 {
+			if err := json.Unmarshal(d.adapterIDs, &adapterIDs); err != nil {
+				return fmt.Errorf("invalid adapter_ids of device %s: %w", d.deviceID, err)
+			}
+		}
+		if err := insertDeviceAdapters(tx, d.deviceID, adapterIDs); err != nil {
+			return err
+		}
+
+		var capabilities map[types.CapabilityType]*types.Capability
+		if len(d.capabilities) > 0 {
+			if err := json.Unmarshal(d.capabilities, &capabilities); err != nil {
+				return fmt.Errorf("invalid capabilities of device %s: %w", d.deviceID, err)
+			}
+		}
+		if err := insertDeviceCapabilities(tx, d.deviceID, capabilities); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`ALTER TABLE devices DROP COLUMN adapter_ids`); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`ALTER TABLE devices DROP COLUMN capabilities`)
+	return err
+}
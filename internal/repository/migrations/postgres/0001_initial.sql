@@ -0,0 +1,115 @@
+-- Schema of SQLite databases at version 5, PostgreSQL support started from it
+
+CREATE TABLE devices (
+	id TEXT PRIMARY KEY,
+	address TEXT NOT NULL,
+	address_type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_updated TIMESTAMPTZ NOT NULL,
+	area_id TEXT NOT NULL DEFAULT '',
+	icon TEXT NOT NULL DEFAULT '',
+	manufacturer TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	notes TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX idx_device_address ON devices(address, address_type);
+
+CREATE TABLE device_adapters (
+	device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	adapter_id TEXT NOT NULL,
+	PRIMARY KEY (device_id, adapter_id)
+);
+CREATE INDEX idx_device_adapters_adapter ON device_adapters(adapter_id);
+
+CREATE TABLE device_capabilities (
+	device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL DEFAULT '',
+	unit TEXT NOT NULL DEFAULT '',
+	value TEXT NOT NULL DEFAULT 'null',
+	PRIMARY KEY (device_id, name)
+);
+
+CREATE TABLE areas (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	parent_id TEXT NOT NULL DEFAULT '',
+	icon TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_areas_parent ON areas(parent_id);
+
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	role TEXT NOT NULL,
+	totp_enabled BOOLEAN NOT NULL DEFAULT false,
+	totp_secret TEXT NOT NULL DEFAULT '',
+	totp_last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE invitations (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_by TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE password_resets (
+	token_hash TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_password_resets_user ON password_resets(user_id);
+
+CREATE TABLE api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_api_tokens_user ON api_tokens(user_id);
+
+CREATE TABLE sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data BYTEA,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_seen_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+CREATE TABLE audit_log (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	type TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	details TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+CREATE TABLE recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	hint TEXT NOT NULL,
+	code_hash TEXT NOT NULL
+);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_id);
@@ -0,0 +1,6 @@
+CREATE TABLE plugin_credentials (
+	plugin_id TEXT PRIMARY KEY,
+	plugin_type TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
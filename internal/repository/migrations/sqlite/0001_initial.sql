@@ -0,0 +1,82 @@
+-- Tables as they were before migrations existed, databases created back then already have them
+
+CREATE TABLE IF NOT EXISTS devices (
+	id TEXT PRIMARY KEY,
+	address TEXT,
+	address_type TEXT,
+	name TEXT,
+	adapter_ids TEXT,
+	created_at DATETIME,
+	capabilities TEXT,
+	last_updated DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_device_address ON devices(address, address_type);
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	email TEXT UNIQUE,
+	password_hash TEXT,
+	created_at DATETIME default current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS invitations (
+	id TEXT PRIMARY KEY,
+	email TEXT,
+	role TEXT,
+	token_hash TEXT UNIQUE,
+	created_by TEXT,
+	expires_at DATETIME,
+	created_at DATETIME default current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+	token_hash TEXT PRIMARY KEY,
+	user_id TEXT,
+	expires_at DATETIME,
+	created_at DATETIME default current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user ON password_resets(user_id);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT,
+	name TEXT,
+	scope TEXT,
+	token_hash TEXT UNIQUE,
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	created_at DATETIME default current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT,
+	data BLOB,
+	ip TEXT,
+	user_agent TEXT,
+	created_at DATETIME,
+	last_seen_at DATETIME,
+	expires_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT,
+	user_id TEXT,
+	email TEXT,
+	ip TEXT,
+	user_agent TEXT,
+	details TEXT,
+	created_at DATETIME default current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT,
+	hint TEXT,
+	code_hash TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE areas (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	parent_id TEXT NOT NULL DEFAULT '',
+	icon TEXT NOT NULL DEFAULT '',
+	created_at DATETIME
+);
+CREATE INDEX idx_areas_parent ON areas(parent_id);
+
+ALTER TABLE devices ADD COLUMN area_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type PasswordResetRepository struct {
+	db *DB
+}
+
+func NewPasswordResetRepository(db *DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Save(reset *core.PasswordReset) error {
+	query := `
+	INSERT INTO password_resets
+	(token_hash, user_id, expires_at, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(token_hash) DO UPDATE SET
+		user_id = excluded.user_id,
+		expires_at = excluded.expires_at,
+		created_at = excluded.created_at
+	`
+
+	_, err := r.db.Exec(query,
+		reset.TokenHash,
+		reset.UserID,
+		reset.ExpiresAt,
+		reset.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save password reset: %w", err)
+	}
+	return nil
+}
+
+// A new reset or a successful one invalidates every previous token of the user
+func (r *PasswordResetRepository) DeleteByUser(userID string) error {
+	query := `DELETE FROM password_resets WHERE user_id = ?`
+	_, err := r.db.Exec(query, userID)
+	return err
+}
+
+func (r *PasswordResetRepository) FindByTokenHash(tokenHash string) (*core.PasswordReset, error) {
+	query := `SELECT token_hash, user_id, expires_at, created_at FROM password_resets WHERE token_hash = ?`
+
+	var reset core.PasswordReset
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&reset.TokenHash,
+		&reset.UserID,
+		&reset.ExpiresAt,
+		&reset.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type PluginCredentialRepository struct {
+	db *DB
+}
+
+func NewPluginCredentialRepository(db *DB) *PluginCredentialRepository {
+	return &PluginCredentialRepository{db: db}
+}
+
+// Save issues the credential of a plugin, replacing the previous one
+func (r *PluginCredentialRepository) Save(credential *core.PluginCredential) error {
+	query := `
+	INSERT INTO plugin_credentials
+	(plugin_id, plugin_type, password_hash, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(plugin_id) DO UPDATE SET
+		plugin_type = excluded.plugin_type,
+		password_hash = excluded.password_hash,
+		created_at = excluded.created_at
+	`
+
+	_, err := r.db.Exec(query, credential.PluginID, credential.PluginType, credential.PasswordHash, credential.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save plugin credential: %w", err)
+	}
+	return nil
+}
+
+func (r *PluginCredentialRepository) Delete(pluginID string) (bool, error) {
+	res, err := r.db.Exec(`DELETE FROM plugin_credentials WHERE plugin_id = ?`, pluginID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PluginCredentialRepository) FindAll() ([]*core.PluginCredential, error) {
+	rows, err := r.db.Query(`SELECT plugin_id, plugin_type, password_hash, created_at FROM plugin_credentials ORDER BY plugin_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []*core.PluginCredential{}
+	for rows.Next() {
+		c, err := r.scanPluginCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *PluginCredentialRepository) FindByPluginID(pluginID string) (*core.PluginCredential, error) {
+	row := r.db.QueryRow(`SELECT plugin_id, plugin_type, password_hash, created_at FROM plugin_credentials WHERE plugin_id = ?`, pluginID)
+	return r.scanPluginCredential(row)
+}
+
+func (r *PluginCredentialRepository) scanPluginCredential(row Scanner) (*core.PluginCredential, error) {
+	var c core.PluginCredential
+	err := row.Scan(&c.PluginID, &c.PluginType, &c.PasswordHash, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
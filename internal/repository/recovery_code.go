@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type RecoveryCodeRepository struct {
+	db *DB
+}
+
+func NewRecoveryCodeRepository(db *DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+// Replace the codes of the user, the previous ones stop working
+func (r *RecoveryCodeRepository) Replace(userID string, codes []*core.RecoveryCode) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, c := range codes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (id, user_id, hint, code_hash) VALUES (?, ?, ?, ?)`, c.ID, userID, c.Hint, c.CodeHash); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *RecoveryCodeRepository) FindByHint(userID string, hint string) ([]*core.RecoveryCode, error) {
+	query := `SELECT id, user_id, hint, code_hash FROM recovery_codes WHERE user_id = ? AND hint = ?`
+
+	rows, err := r.db.Query(query, userID, hint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []*core.RecoveryCode{}
+	for rows.Next() {
+		var c core.RecoveryCode
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Hint, &c.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, &c)
+	}
+	return codes, rows.Err()
+}
+
+// Returns false if the code was already used by a concurrent request
+func (r *RecoveryCodeRepository) Delete(id string) (bool, error) {
+	res, err := r.db.Exec(`DELETE FROM recovery_codes WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *RecoveryCodeRepository) DeleteByUser(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+type SessionRepository struct {
+	db *DB
+}
+
+func NewSessionRepository(db *DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Save(session *core.Session) error {
+	query := `
+	INSERT INTO sessions
+	(id, user_id, data, ip, user_agent, created_at, last_seen_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		user_id = excluded.user_id,
+		data = excluded.data,
+		ip = excluded.ip,
+		user_agent = excluded.user_agent,
+		created_at = excluded.created_at,
+		last_seen_at = excluded.last_seen_at,
+		expires_at = excluded.expires_at
+	`
+
+	_, err := r.db.Exec(query,
+		session.ID,
+		session.UserID,
+		session.Data,
+		session.IP,
+		session.UserAgent,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) Touch(id string, lastSeen time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, lastSeen, id)
+	return err
+}
+
+func (r *SessionRepository) Delete(id string) error {
+	query := `DELETE FROM sessions WHERE id = ?`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+// Scoped to the owner so a user cannot revoke the sessions of someone else
+func (r *SessionRepository) DeleteForUser(id string, userID string) (bool, error) {
+	query := `DELETE FROM sessions WHERE id = ? AND user_id = ?`
+	res, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Deletes every session of the user except keepID, which can be empty
+func (r *SessionRepository) DeleteByUser(userID string, keepID string) error {
+	query := `DELETE FROM sessions WHERE user_id = ? AND id != ?`
+	_, err := r.db.Exec(query, userID, keepID)
+	return err
+}
+
+func (r *SessionRepository) DeleteExpired(now time.Time, idleSince time.Time) error {
+	query := `DELETE FROM sessions WHERE expires_at < ? OR last_seen_at < ?`
+	_, err := r.db.Exec(query, now, idleSince)
+	return err
+}
+
+func (r *SessionRepository) FindByID(id string) (*core.Session, error) {
+	query := `SELECT id, user_id, data, ip, user_agent, created_at, last_seen_at, expires_at FROM sessions WHERE id = ?`
+
+	row := r.db.QueryRow(query, id)
+	return r.scanSession(row)
+}
+
+func (r *SessionRepository) FindByUser(userID string) ([]*core.Session, error) {
+	query := `SELECT id, user_id, data, ip, user_agent, created_at, last_seen_at, expires_at FROM sessions WHERE user_id = ? ORDER BY last_seen_at DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*core.Session{}
+	for rows.Next() {
+		s, err := r.scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) scanSession(row Scanner) (*core.Session, error) {
+	var s core.Session
+
+	err := row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Data,
+		&s.IP,
+		&s.UserAgent,
+		&s.CreatedAt,
+		&s.LastSeenAt,
+		&s.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+// StorageOptions select the database, SQLite unless the driver is postgres
+type StorageOptions struct {
+	Driver Dialect
+
+	SQLitePath string
+	SQLite     SQLiteOptions
+
+	PostgresURL string
+	Postgres    PostgresOptions
+}
+
+// Store holds the repositories of every entity, backed by the same database
+type Store struct {
+	DB *DB
+
+	Devices           core.DeviceRepository
+	Areas             core.AreaRepository
+	Users             core.UserRepository
+	Invitations       core.InvitationRepository
+	PasswordResets    core.PasswordResetRepository
+	ApiTokens         core.ApiTokenRepository
+	Sessions          core.SessionRepository
+	Audit             core.AuditRepository
+	RecoveryCodes     core.RecoveryCodeRepository
+	PluginCredentials core.PluginCredentialRepository
+}
+
+// OpenDB opens the database selected by the options without migrating it
+func OpenDB(options StorageOptions) (*DB, error) {
+	switch options.Driver {
+	case DialectSQLite, "":
+		// An empty path would open a temporary database, lost on restart
+		if options.SQLitePath == "" {
+			return nil, fmt.Errorf("the sqlite driver needs a database path")
+		}
+		return OpenSQLiteDB(options.SQLitePath, options.SQLite)
+	case DialectPostgres:
+		if options.PostgresURL == "" {
+			return nil, fmt.Errorf("the postgres driver needs a database url")
+		}
+		return OpenPostgresDB(options.PostgresURL, options.Postgres)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q, expected %s or %s", options.Driver, DialectSQLite, DialectPostgres)
+}
+
+// OpenStore opens the database selected by the options and applies the pending migrations
+func OpenStore(options StorageOptions) (*Store, error) {
+	db, err := OpenDB(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return NewStore(db), nil
+}
+
+func NewStore(db *DB) *Store {
+	return &Store{
+		DB:                db,
+		Devices:           NewDeviceRepository(db),
+		Areas:             NewAreaRepository(db),
+		Users:             NewUserRepository(db),
+		Invitations:       NewInvitationRepository(db),
+		PasswordResets:    NewPasswordResetRepository(db),
+		ApiTokens:         NewApiTokenRepository(db),
+		Sessions:          NewSessionRepository(db),
+		Audit:             NewAuditRepository(db),
+		RecoveryCodes:     NewRecoveryCodeRepository(db),
+		PluginCredentials: NewPluginCredentialRepository(db),
+	}
+}
+
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
@@ -7,38 +7,38 @@ import (
 	"github.com/Bastien2203/go-home/internal/core"
 )
 
+const userColumns = `id, email, created_at, password_hash, role, totp_enabled, totp_secret, totp_last_step`
+
 type UserRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewUserRepository(db *sql.DB) (*UserRepository, error) {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		email TEXT UNIQUE,
-		password_hash TEXT,
-		created_at DATETIME default current_timestamp
-	);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create users table: %w", err)
-	}
-
-	return &UserRepository{db: db}, nil
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{db: db}
 }
 
 func (r *UserRepository) Save(user *core.User) error {
 	query := `
-	INSERT OR REPLACE INTO users 
-	(id, email, password_hash)
-	VALUES (?, ?, ?)
+	INSERT INTO users 
+	(id, email, password_hash, role, totp_enabled, totp_secret, totp_last_step)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		email = excluded.email,
+		password_hash = excluded.password_hash,
+		role = excluded.role,
+		totp_enabled = excluded.totp_enabled,
+		totp_secret = excluded.totp_secret,
+		totp_last_step = excluded.totp_last_step
 	`
 
 	_, err := r.db.Exec(query,
 		user.ID,
 		user.Email,
 		user.PasswordHash,
+		user.Role,
+		user.TotpEnabled,
+		user.TotpSecret,
+		user.TotpLastStep,
 	)
 
 	if err != nil {
@@ -48,20 +48,57 @@ func (r *UserRepository) Save(user *core.User) error {
 	return nil
 }
 
+func (r *UserRepository) Delete(id string) error {
+	query := `DELETE FROM users WHERE id = ?`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+func (r *UserRepository) FindAll() ([]*core.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*core.User{}
+	for rows.Next() {
+		u, err := r.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
 func (r *UserRepository) FindByEmail(email string) (*core.User, error) {
-	query := `SELECT id, email, created_at, password_hash FROM users WHERE email = ?`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
 
 	row := r.db.QueryRow(query, email)
 	return r.scanUser(row)
 }
 
 func (r *UserRepository) FindByID(id string) (*core.User, error) {
-	query := `SELECT id, email, created_at, password_hash FROM users WHERE id = ?`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
 
 	row := r.db.QueryRow(query, id)
 	return r.scanUser(row)
 }
 
+// UpdateTotpLastStep only moves forward, so concurrent logins cannot both use the same code
+func (r *UserRepository) UpdateTotpLastStep(id string, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+	res, err := r.db.Exec(query, step, id, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
 func (r *UserRepository) Count() (*int, error) {
 	query := `SELECT COUNT(id) FROM users`
 
@@ -75,6 +112,16 @@ func (r *UserRepository) Count() (*int, error) {
 	return &count, nil
 }
 
+func (r *UserRepository) CountByRole(role core.Role) (int, error) {
+	query := `SELECT COUNT(id) FROM users WHERE role = ?`
+
+	var count int
+	if err := r.db.QueryRow(query, role).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (r *UserRepository) scanUser(row Scanner) (*core.User, error) {
 	var u core.User
 
@@ -83,6 +130,10 @@ func (r *UserRepository) scanUser(row Scanner) (*core.User, error) {
 		&u.Email,
 		&u.CreatedAt,
 		&u.PasswordHash,
+		&u.Role,
+		&u.TotpEnabled,
+		&u.TotpSecret,
+		&u.TotpLastStep,
 	)
 
 	if err == sql.ErrNoRows {
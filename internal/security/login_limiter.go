@@ -0,0 +1,100 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginLimiter locks a key (an ip or an account) out after too many failed logins within a window
+type LoginLimiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	attempts    map[string]*loginAttempts
+	lastPrune   time.Time
+	now         func() time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+func NewLoginLimiter(maxFailures int, window, lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		attempts:    make(map[string]*loginAttempts),
+		now:         time.Now,
+	}
+}
+
+// Locked returns how long the key stays locked, 0 if it is not
+func (l *LoginLimiter) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok {
+		return 0
+	}
+	if remaining := a.lockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failed login and returns true if the key is now locked
+func (l *LoginLimiter) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	a, ok := l.attempts[key]
+	if !ok || now.Sub(a.windowStart) > l.window {
+		a = &loginAttempts{windowStart: now, lockedUntil: a.lockedUntilOrZero()}
+		l.attempts[key] = a
+	}
+
+	a.failures++
+	if a.failures >= l.maxFailures {
+		a.failures = 0
+		a.windowStart = now
+		a.lockedUntil = now.Add(l.lockout)
+		return true
+	}
+	return false
+}
+
+// Reset forgets the failures of the key after a successful login
+func (l *LoginLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+func (a *loginAttempts) lockedUntilOrZero() time.Time {
+	if a == nil {
+		return time.Time{}
+	}
+	return a.lockedUntil
+}
+
+// Drop keys which are neither locked nor inside their window, at most once per window
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+	l.lastPrune = now
+
+	for key, a := range l.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.windowStart) > l.window {
+			delete(l.attempts, key)
+		}
+	}
+}
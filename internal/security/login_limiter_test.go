@@ -0,0 +1,58 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLoginLimiter(3, 10*time.Minute, 15*time.Minute)
+	l.now = func() time.Time { return now }
+
+	if l.Fail("ip:1.2.3.4") || l.Fail("ip:1.2.3.4") {
+		t.Fatal("locked before max failures")
+	}
+	if l.Locked("ip:1.2.3.4") != 0 {
+		t.Fatal("locked before max failures")
+	}
+	if !l.Fail("ip:1.2.3.4") {
+		t.Fatal("expected lock after 3 failures")
+	}
+	if got := l.Locked("ip:1.2.3.4"); got != 15*time.Minute {
+		t.Fatalf("expected 15m lockout, got %v", got)
+	}
+	if l.Locked("ip:5.6.7.8") != 0 {
+		t.Fatal("other keys must not be locked")
+	}
+
+	now = now.Add(16 * time.Minute)
+	if l.Locked("ip:1.2.3.4") != 0 {
+		t.Fatal("lockout should have expired")
+	}
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLoginLimiter(3, 10*time.Minute, 15*time.Minute)
+	l.now = func() time.Time { return now }
+
+	l.Fail("account:a@b.c")
+	l.Fail("account:a@b.c")
+
+	// Failures outside of the window are forgotten
+	now = now.Add(11 * time.Minute)
+	if l.Fail("account:a@b.c") {
+		t.Fatal("failures from a previous window must not count")
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	l := NewLoginLimiter(2, time.Minute, time.Minute)
+
+	l.Fail("account:a@b.c")
+	l.Reset("account:a@b.c")
+	if l.Fail("account:a@b.c") {
+		t.Fatal("reset should clear failures")
+	}
+}
@@ -0,0 +1,93 @@
+package security
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 secret, truncated to 6 digits
+func TestTotpCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		got, err := TotpCode(secret, TotpStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("t=%d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	step := TotpStep(now)
+
+	previous, _ := TotpCode(secret, step-1)
+	if got, ok := ValidateTotp(secret, previous, now, 0); !ok || got != step-1 {
+		t.Fatal("previous code should be accepted for clock drift")
+	}
+
+	old, _ := TotpCode(secret, step-2)
+	if _, ok := ValidateTotp(secret, old, now, 0); ok {
+		t.Fatal("code outside of the skew window accepted")
+	}
+
+	current, _ := TotpCode(secret, step)
+	if _, ok := ValidateTotp(secret, current, now, step); ok {
+		t.Fatal("replayed code accepted")
+	}
+
+	if _, ok := ValidateTotp(secret, "12345", now, 0); ok {
+		t.Fatal("short code accepted")
+	}
+}
+
+func TestTotpURI(t *testing.T) {
+	uri := TotpURI("GoHome", "bob@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/GoHome:bob@example.com?") {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+	for _, part := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=GoHome", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("uri %s misses %s", uri, part)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Fatalf("normalization failed for %q", code)
+		}
+	}
+}
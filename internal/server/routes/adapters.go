@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/types"
 
 	"net/http"
 )
@@ -18,6 +19,7 @@ func NewAdaptersRouter(kernel *core.Kernel, mux *http.ServeMux, middleware func(
 	}
 
 	mux.Handle("GET /api/adapters", middleware(http.HandlerFunc(r.handleListAdapters)))
+	mux.Handle("GET /api/adapters/{adapterId}/devices", middleware(http.HandlerFunc(r.handleAdapterDevices)))
 	mux.Handle("POST /api/devices/{id}/adapters/{adapterId}", middleware(http.HandlerFunc(r.handleLinkAdapter)))
 	mux.Handle("DELETE /api/devices/{id}/adapters/{adapterId}", middleware(http.HandlerFunc(r.handleUnlinkAdapter)))
 	mux.Handle("POST /api/adapters/start/{adapterId}", middleware(http.HandlerFunc(r.handleStartAdapter)))
@@ -30,6 +32,18 @@ func (s *AdaptersRouter) handleListAdapters(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(s.kernel.ListAdapters())
 }
 
+func (s *AdaptersRouter) handleAdapterDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.kernel.ListAdapterDevices(r.PathValue("adapterId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if devices == nil {
+		devices = []*types.Device{}
+	}
+	json.NewEncoder(w).Encode(devices)
+}
+
 func (s *AdaptersRouter) handleLinkAdapter(w http.ResponseWriter, r *http.Request) {
 	deviceID := r.PathValue("id")
 	adapterID := r.PathValue("adapterId")
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/repository"
+	"github.com/Bastien2203/go-home/internal/transfer"
+)
+
+const (
+	maxRestoreSize = 1 << 30
+	maxImportSize  = 16 << 20
+)
+
+type AdminRouter struct {
+	kernel   *core.Kernel
+	backups  *repository.Backups // nil when the database is not SQLite
+	transfer *transfer.Transfer
+}
+
+func NewAdminRouter(kernel *core.Kernel, backups *repository.Backups, transfer *transfer.Transfer, mux *http.ServeMux, middleware func(next http.Handler) http.Handler) *AdminRouter {
+	r := &AdminRouter{
+		kernel:   kernel,
+		backups:  backups,
+		transfer: transfer,
+	}
+
+	mux.Handle("POST /api/admin/backup", middleware(r.requireBackups(http.HandlerFunc(r.handleBackup))))
+	mux.Handle("POST /api/admin/restore", middleware(r.requireBackups(http.HandlerFunc(r.handleRestore))))
+	mux.Handle("GET /api/admin/export", middleware(http.HandlerFunc(r.handleExport)))
+	mux.Handle("POST /api/admin/import", middleware(http.HandlerFunc(r.handleImport)))
+
+	return r
+}
+
+func (s *AdminRouter) requireBackups(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.backups == nil {
+			http.Error(w, "Backups are only available with SQLite, use the tools of your database", http.StatusNotImplemented)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleBackup downloads a consistent snapshot of the database
+func (s *AdminRouter) handleBackup(w http.ResponseWriter, r *http.Request) {
+	tmp, err := s.backups.TempFile()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := s.backups.Snapshot(r.Context(), tmp.Name()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to back up the database: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := "gohome-" + time.Now().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	io.Copy(w, file)
+}
+
+// handleRestore replaces the database with the uploaded one, sent as the body or as the "file" field of a form
+func (s *AdminRouter) handleRestore(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+
+	var upload io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		upload = file
+	}
+
+	tmp, err := s.backups.TempFile()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, upload)
+	tmp.Close()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read the upload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.backups.Restore(r.Context(), tmp.Name()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to restore the database: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := s.kernel.Reload(); err != nil {
+		http.Error(w, fmt.Sprintf("Database restored but not reloaded, restart the server: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Server] Database restored by %s", CurrentUser(r).Email)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "restored"}`))
+}
+
+// handleExport downloads the configuration, ?format=yaml for YAML and ?secrets=true to include password hashes
+// and TOTP secrets
+func (s *AdminRouter) handleExport(w http.ResponseWriter, r *http.Request) {
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withSecrets := r.URL.Query().Get("secrets") == "true"
+
+	doc, err := s.transfer.Export(withSecrets)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := doc.Marshal(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if withSecrets {
+		log.Printf("[Server] Configuration exported with secrets by %s", CurrentUser(r).Email)
+	}
+	name := "gohome-config-" + time.Now().Format("20060102-150405") + "." + string(format)
+	w.Header().Set("Content-Type", "application/"+string(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Write(data)
+}
+
+// handleImport applies an exported configuration, ?mode=merge|replace and ?dry_run=true to only list the changes.
+// The format is YAML with ?format=yaml or a yaml content type, JSON otherwise.
+func (s *AdminRouter) handleImport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format, err := transfer.ParseFormat(query.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Get("format") == "" && strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		format = transfer.FormatYAML
+	}
+	mode, err := transfer.ParseMode(query.Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun := query.Get("dry_run") == "true"
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read the body: %v", err), http.StatusBadRequest)
+		return
+	}
+	doc, err := transfer.Parse(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := CurrentUser(r)
+	result, err := s.transfer.Import(doc, mode, dryRun, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !dryRun {
+		log.Printf("[Server] Configuration imported by %s (%s, %d changes, %d failed)", user.Email, mode, len(result.Changes), result.Failed)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/google/uuid"
+)
+
+const (
+	apiTokenPrefix = "gh_"
+	// Avoid a database write on every scripted request
+	lastUsedResolution = time.Minute
+)
+
+type ApiTokenCreateRequest struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty"`
+}
+
+type ApiTokenCreateResponse struct {
+	*core.ApiToken
+	Token string `json:"token"`
+}
+
+func (s *UsersRouter) handleListApiTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.apiTokenRepository.FindByUser(CurrentUser(r).ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// The token is only returned once
+func (s *UsersRouter) handleCreateApiToken(w http.ResponseWriter, r *http.Request) {
+	// A leaked token must not be able to mint new ones
+	if CurrentApiToken(r) != nil {
+		http.Error(w, "Api tokens can only be created from a session", http.StatusForbidden)
+		return
+	}
+
+	var req ApiTokenCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Missing token name", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := core.ParseTokenScope(req.Scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := security.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	secret = apiTokenPrefix + secret
+
+	now := time.Now()
+	token := &core.ApiToken{
+		ID:        uuid.New().String(),
+		UserID:    CurrentUser(r).ID,
+		Name:      strings.TrimSpace(req.Name),
+		Scope:     scope,
+		TokenHash: security.HashToken(secret),
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.apiTokenRepository.Save(token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ApiTokenCreateResponse{ApiToken: token, Token: secret})
+}
+
+func (s *UsersRouter) handleDeleteApiToken(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.apiTokenRepository.Delete(r.PathValue("id"), CurrentUser(r).ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "revoked"}`))
+}
+
+func (s *UsersRouter) tokenUser(authorization string) (*core.User, core.Role, *core.ApiToken) {
+	secret, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil, "", nil
+	}
+
+	token, err := s.apiTokenRepository.FindByTokenHash(security.HashToken(secret))
+	if err != nil || token == nil {
+		return nil, "", nil
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, "", nil
+	}
+
+	user, err := s.userRepository.FindByID(token.UserID)
+	if err != nil || user == nil {
+		return nil, "", nil
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedResolution {
+		if err := s.apiTokenRepository.UpdateLastUsed(token.ID, now); err != nil {
+			log.Printf("[Users] failed to update last use of api token %s: %v", token.ID, err)
+		}
+		token.LastUsedAt = &now
+	}
+
+	return user, token.EffectiveRole(user), token
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type AreasRouter struct {
+	kernel *core.Kernel
+}
+
+type AreaCreateRequest struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+	Icon     string `json:"icon"`
+}
+
+// Fields left out of the request are not changed, an empty parent_id moves the area to the top level
+type AreaUpdateRequest struct {
+	Name     *string `json:"name"`
+	ParentID *string `json:"parent_id"`
+	Icon     *string `json:"icon"`
+}
+
+func (req *AreaUpdateRequest) apply(area *types.Area) error {
+	setTrimmed(&area.Name, req.Name)
+	setTrimmed(&area.ParentID, req.ParentID)
+	setTrimmed(&area.Icon, req.Icon)
+	return nil
+}
+
+func NewAreasRouter(kernel *core.Kernel, mux *http.ServeMux, middleware func(next http.Handler) http.Handler) *AreasRouter {
+	r := &AreasRouter{
+		kernel: kernel,
+	}
+
+	mux.Handle("GET /api/areas", middleware(http.HandlerFunc(r.handleListAreas)))
+	mux.Handle("POST /api/areas", middleware(http.HandlerFunc(r.handleCreateArea)))
+	mux.Handle("GET /api/areas/aggregates", middleware(http.HandlerFunc(r.handleAreaAggregates)))
+	mux.Handle("GET /api/areas/{id}", middleware(http.HandlerFunc(r.handleGetArea)))
+	mux.Handle("PATCH /api/areas/{id}", middleware(http.HandlerFunc(r.handleUpdateArea)))
+	mux.Handle("DELETE /api/areas/{id}", middleware(http.HandlerFunc(r.handleDeleteArea)))
+	mux.Handle("GET /api/areas/{id}/devices", middleware(http.HandlerFunc(r.handleAreaDevices)))
+
+	return r
+}
+
+func (s *AreasRouter) handleListAreas(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.kernel.ListAreas())
+}
+
+func (s *AreasRouter) handleCreateArea(w http.ResponseWriter, r *http.Request) {
+	var req AreaCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	area := types.NewArea(req.Name, strings.TrimSpace(req.ParentID), strings.TrimSpace(req.Icon))
+	if err := s.kernel.CreateArea(area); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create area: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(area)
+}
+
+func (s *AreasRouter) handleAreaAggregates(w http.ResponseWriter, r *http.Request) {
+	aggregates, err := s.kernel.AreaAggregates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(aggregates)
+}
+
+func (s *AreasRouter) handleGetArea(w http.ResponseWriter, r *http.Request) {
+	area, err := s.kernel.GetArea(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(area)
+}
+
+func (s *AreasRouter) handleUpdateArea(w http.ResponseWriter, r *http.Request) {
+	var req AreaUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	area, err := s.kernel.UpdateArea(r.PathValue("id"), req.apply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(area)
+}
+
+func (s *AreasRouter) handleDeleteArea(w http.ResponseWriter, r *http.Request) {
+	if err := s.kernel.DeleteArea(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "deleted"}`))
+}
+
+// Devices of the sub areas are included
+func (s *AreasRouter) handleAreaDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.kernel.AreaDevices(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if devices == nil {
+		devices = []*types.Device{}
+	}
+	json.NewEncoder(w).Encode(devices)
+}
@@ -3,6 +3,8 @@ package routes
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 
 	"net/http"
 
@@ -19,6 +21,57 @@ type DeviceCreateRequest struct {
 	Name        string   `json:"name"`
 	AdapterIDs  []string `json:"adapter_ids"`
 	AddressType string   `json:"address_type"`
+	AreaID      string   `json:"area_id"`
+}
+
+// Fields left out of the request are not changed
+type DeviceUpdateRequest struct {
+	Name         *string   `json:"name"`
+	Address      *string   `json:"address"`
+	AddressType  *string   `json:"address_type"`
+	AreaID       *string   `json:"area_id"`
+	Icon         *string   `json:"icon"`
+	Manufacturer *string   `json:"manufacturer"`
+	Model        *string   `json:"model"`
+	Notes        *string   `json:"notes"`
+	Tags         *[]string `json:"tags"`
+}
+
+func (req *DeviceUpdateRequest) apply(device *types.Device) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return fmt.Errorf("name cannot be empty")
+		}
+		device.Name = name
+	}
+	if req.Address != nil {
+		address := strings.TrimSpace(*req.Address)
+		if address == "" {
+			return fmt.Errorf("address cannot be empty")
+		}
+		device.Address = address
+	}
+	if req.AddressType != nil {
+		device.AddressType = types.AddressType(*req.AddressType)
+	}
+
+	setTrimmed(&device.AreaID, req.AreaID)
+	setTrimmed(&device.Icon, req.Icon)
+	setTrimmed(&device.Manufacturer, req.Manufacturer)
+	setTrimmed(&device.Model, req.Model)
+	setTrimmed(&device.Notes, req.Notes)
+
+	if req.Tags != nil {
+		tags := make([]string, 0, len(*req.Tags))
+		for _, tag := range *req.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		device.Tags = tags
+	}
+	return nil
 }
 
 func NewDevicesRouter(kernel *core.Kernel, mux *http.ServeMux, middleware func(next http.Handler) http.Handler) *DevicesRouter {
@@ -28,11 +81,18 @@ func NewDevicesRouter(kernel *core.Kernel, mux *http.ServeMux, middleware func(n
 
 	mux.Handle("GET /api/devices", middleware(http.HandlerFunc(r.handleListDevices)))
 	mux.Handle("POST /api/devices", middleware(http.HandlerFunc(r.handleCreateDevice)))
+	mux.Handle("PATCH /api/devices/{id}", middleware(http.HandlerFunc(r.handleUpdateDevice)))
 	mux.Handle("DELETE /api/devices/{id}", middleware(http.HandlerFunc(r.handleDeleteDevice)))
 
 	return r
 }
 
+func setTrimmed(field *string, value *string) {
+	if value != nil {
+		*field = strings.TrimSpace(*value)
+	}
+}
+
 func (s *DevicesRouter) handleListDevices(w http.ResponseWriter, r *http.Request) {
 	devices, err := s.kernel.ListDevices()
 	if err != nil {
@@ -53,6 +113,7 @@ func (s *DevicesRouter) handleCreateDevice(w http.ResponseWriter, r *http.Reques
 	}
 
 	dev := types.NewDevice(req.Address, req.Name, req.AdapterIDs, types.AddressType(req.AddressType))
+	dev.AreaID = strings.TrimSpace(req.AreaID)
 	if err := s.kernel.RegisterDevice(dev); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to register device: %v", err), http.StatusInternalServerError)
 		return
@@ -62,6 +123,21 @@ func (s *DevicesRouter) handleCreateDevice(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(dev)
 }
 
+func (s *DevicesRouter) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+	var req DeviceUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	device, err := s.kernel.UpdateDevice(r.PathValue("id"), req.apply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(device)
+}
+
 func (s *DevicesRouter) handleDeleteDevice(w http.ResponseWriter, r *http.Request) {
 	deviceID := r.PathValue("id")
 
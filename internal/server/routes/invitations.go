@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultInvitationTTL = 72 * time.Hour
+	maxInvitationTTL     = 30 * 24 * time.Hour
+)
+
+type InvitationCreateRequest struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"`
+}
+
+type InvitationCreateResponse struct {
+	*core.Invitation
+	Token string `json:"token"`
+}
+
+func (s *UsersRouter) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	if err := s.invitationRepository.DeleteExpired(time.Now()); err != nil {
+		log.Printf("[Users] failed to delete expired invitations: %v", err)
+	}
+
+	invitations, err := s.invitationRepository.FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// The token is only returned once, the invited user registers with it
+func (s *UsersRouter) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req InvitationCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := core.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !mailIsValid(req.Email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	if existing, _ := s.userRepository.FindByEmail(req.Email); existing != nil {
+		http.Error(w, "Email already registered", http.StatusConflict)
+		return
+	}
+
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = min(time.Duration(req.ExpiresInHours)*time.Hour, maxInvitationTTL)
+	}
+
+	token, err := security.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	invitation := &core.Invitation{
+		ID:        uuid.New().String(),
+		Email:     req.Email,
+		Role:      role,
+		TokenHash: security.HashToken(token),
+		CreatedBy: CurrentUser(r).ID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	if err := s.invitationRepository.Save(invitation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(InvitationCreateResponse{Invitation: invitation, Token: token})
+}
+
+func (s *UsersRouter) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	if err := s.invitationRepository.Delete(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "deleted"}`))
+}
+
+// Public, lets the register page show who is invited and with which role
+func (s *UsersRouter) handleGetInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation := s.findValidInvitation(r.PathValue("token"))
+	if invitation == nil {
+		http.Error(w, "Invalid or expired invitation", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+func (s *UsersRouter) findValidInvitation(token string) *core.Invitation {
+	if token == "" {
+		return nil
+	}
+
+	invitation, err := s.invitationRepository.FindByTokenHash(security.HashToken(token))
+	if err != nil || invitation == nil || time.Now().After(invitation.ExpiresAt) {
+		return nil
+	}
+	return invitation
+}
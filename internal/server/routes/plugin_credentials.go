@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/Bastien2203/go-home/shared/plugin"
+)
+
+const pluginPasswordPrefix = "ghp_"
+
+type PluginCredentialsRouter struct {
+	repository core.PluginCredentialRepository
+}
+
+type PluginCredentialRequest struct {
+	PluginID   string            `json:"plugin_id"`
+	PluginType plugin.PluginType `json:"plugin_type"`
+}
+
+type PluginCredentialResponse struct {
+	*core.PluginCredential
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func NewPluginCredentialsRouter(repository core.PluginCredentialRepository, mux *http.ServeMux, middleware func(next http.Handler) http.Handler) *PluginCredentialsRouter {
+	r := &PluginCredentialsRouter{
+		repository: repository,
+	}
+
+	mux.Handle("GET /api/admin/plugin-credentials", middleware(http.HandlerFunc(r.handleList)))
+	mux.Handle("POST /api/admin/plugin-credentials", middleware(http.HandlerFunc(r.handleIssue)))
+	mux.Handle("DELETE /api/admin/plugin-credentials/{id}", middleware(http.HandlerFunc(r.handleRevoke)))
+
+	return r
+}
+
+func (s *PluginCredentialsRouter) handleList(w http.ResponseWriter, r *http.Request) {
+	credentials, err := s.repository.FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(credentials)
+}
+
+// handleIssue creates the broker credential of a plugin, or replaces it. The password is only returned once.
+func (s *PluginCredentialsRouter) handleIssue(w http.ResponseWriter, r *http.Request) {
+	var req PluginCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	// The id is a topic level of the plugin topics
+	if req.PluginID == "" || strings.ContainsAny(req.PluginID, "/+#") {
+		http.Error(w, "Invalid plugin id", http.StatusBadRequest)
+		return
+	}
+	if req.PluginType != plugin.PluginAdapter && req.PluginType != plugin.PluginScanner {
+		http.Error(w, "Invalid plugin type", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := security.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	password := pluginPasswordPrefix + secret
+
+	credential := &core.PluginCredential{
+		PluginID:     req.PluginID,
+		PluginType:   req.PluginType,
+		PasswordHash: security.HashToken(password),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.repository.Save(credential); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Server] Broker credential of plugin %s issued by %s", credential.PluginID, CurrentUser(r).Email)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PluginCredentialResponse{PluginCredential: credential, Username: credential.PluginID, Password: password})
+}
+
+// handleRevoke refuses the next connections of the plugin, the current one is kept until it disconnects
+func (s *PluginCredentialsRouter) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.repository.Delete(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Credential not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[Server] Broker credential of plugin %s revoked by %s", r.PathValue("id"), CurrentUser(r).Email)
+	w.WriteHeader(http.StatusNoContent)
+}
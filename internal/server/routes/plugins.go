@@ -17,9 +17,19 @@ func NewPluginsRouter(kernel *core.Kernel, mux *http.ServeMux, middleware func(n
 		kernel: kernel,
 	}
 	mux.Handle("GET /api/plugins", middleware(http.HandlerFunc(r.handleListPlugins)))
+	mux.Handle("GET /api/plugins/{id}", middleware(http.HandlerFunc(r.handleGetPlugin)))
 	return r
 }
 
 func (s *PluginsRouter) handleListPlugins(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(s.kernel.ListPlugins())
 }
+
+func (s *PluginsRouter) handleGetPlugin(w http.ResponseWriter, r *http.Request) {
+	p, err := s.kernel.GetPlugin(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(p)
+}
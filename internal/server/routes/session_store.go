@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	sessionName = "session-name"
+	// Avoid a database write on every request
+	lastSeenResolution = time.Minute
+)
+
+// SessionStore is a gorilla sessions.Store keeping the session data in the database,
+// the cookie only carries a signed random token so sessions can be listed and revoked
+type SessionStore struct {
+	repository      core.SessionRepository
+	codecs          []securecookie.Codec
+	serializer      securecookie.GobEncoder
+	options         *sessions.Options
+	absoluteTimeout time.Duration
+	idleTimeout     time.Duration
+	trustProxy      bool
+}
+
+func NewSessionStore(repository core.SessionRepository, secret string, options *sessions.Options, absoluteTimeout, idleTimeout time.Duration, trustProxy bool) *SessionStore {
+	options.MaxAge = int(absoluteTimeout.Seconds())
+	return &SessionStore{
+		repository:      repository,
+		codecs:          securecookie.CodecsFromPairs([]byte(secret)),
+		options:         options,
+		absoluteTimeout: absoluteTimeout,
+		idleTimeout:     idleTimeout,
+		trustProxy:      trustProxy,
+	}
+}
+
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the cookie, or returns an empty session if it is missing, expired or revoked
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.codecs...); err != nil {
+		// Cookies from an older store or signed with another secret
+		return session, nil
+	}
+
+	stored, err := s.repository.FindByID(security.HashToken(token))
+	if err != nil {
+		return session, err
+	}
+
+	now := time.Now()
+	if stored == nil || s.expired(stored, now) {
+		return session, nil
+	}
+
+	if err := s.serializer.Deserialize(stored.Data, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+
+	if now.Sub(stored.LastSeenAt) > lastSeenResolution {
+		if err := s.repository.Touch(stored.ID, now); err != nil {
+			log.Printf("[Session] failed to update last seen: %v", err)
+		}
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repository.Delete(security.HashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now()
+	stored := &core.Session{
+		IP:         s.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.absoluteTimeout),
+	}
+
+	if session.ID == "" {
+		token, err := security.GenerateToken()
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	} else if existing, err := s.repository.FindByID(security.HashToken(session.ID)); err == nil && existing != nil {
+		// Saving again must not extend the absolute timeout
+		stored.CreatedAt = existing.CreatedAt
+		stored.ExpiresAt = existing.ExpiresAt
+	}
+
+	stored.ID = security.HashToken(session.ID)
+	stored.UserID, _ = session.Values["user_id"].(string)
+
+	data, err := s.serializer.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	stored.Data = data
+
+	if err := s.repository.Save(stored); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	opts := *session.Options
+	opts.MaxAge = int(time.Until(stored.ExpiresAt).Seconds())
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, &opts))
+	return nil
+}
+
+// Renew gives the session a new token, done on login to prevent session fixation
+func (s *SessionStore) Renew(session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.repository.Delete(security.HashToken(session.ID)); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
+
+// SessionID returns the id exposed by the API for the session, the hash of its token
+func (s *SessionStore) SessionID(session *sessions.Session) string {
+	if session.ID == "" {
+		return ""
+	}
+	return security.HashToken(session.ID)
+}
+
+func (s *SessionStore) DeleteExpired() error {
+	now := time.Now()
+	return s.repository.DeleteExpired(now, now.Add(-s.idleTimeout))
+}
+
+func (s *SessionStore) expired(session *core.Session, now time.Time) bool {
+	return now.After(session.ExpiresAt) || now.Sub(session.LastSeenAt) > s.idleTimeout
+}
+
+// X-Forwarded-For can be forged, it is only used behind a trusted reverse proxy
+func (s *SessionStore) ClientIP(r *http.Request) string {
+	if s.trustProxy {
+		if ip := r.Header.Get("X-Real-Ip"); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
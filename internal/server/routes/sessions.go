@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type SessionResponse struct {
+	*core.Session
+	Current bool `json:"current"`
+}
+
+func (s *UsersRouter) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	stored, err := s.store.repository.FindByUser(CurrentUser(r).ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := s.store.Get(r, sessionName)
+	currentID := s.store.SessionID(session)
+
+	now := time.Now()
+	sessions := make([]SessionResponse, 0, len(stored))
+	for _, sess := range stored {
+		if s.store.expired(sess, now) {
+			continue
+		}
+		sessions = append(sessions, SessionResponse{Session: sess, Current: sess.ID == currentID})
+	}
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (s *UsersRouter) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	deleted, err := s.store.repository.DeleteForUser(r.PathValue("id"), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	s.audit(r, core.AuditSessionRevoked, user.ID, user.Email, r.PathValue("id"))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "revoked"}`))
+}
+
+// Log out of every device, including this one
+func (s *UsersRouter) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if err := s.store.repository.DeleteByUser(user.ID, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := s.store.Get(r, sessionName)
+	session.Values = make(map[any]any)
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Error while logging out", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, core.AuditLogoutAll, user.ID, user.Email, "")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Logged out"}`))
+}
+
+func (s *UsersRouter) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxAuditLimit)
+	}
+
+	entries, err := s.auditRepository.FindRecent(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *UsersRouter) audit(r *http.Request, auditType core.AuditType, userID, email, details string) {
+	entry := &core.AuditEntry{
+		Type:      auditType,
+		UserID:    userID,
+		Email:     email,
+		IP:        s.store.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+	if err := s.auditRepository.Save(entry); err != nil {
+		log.Printf("[Audit] failed to save %s entry: %v", auditType, err)
+	}
+}
@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/security"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "GoHome"
+	recoveryCodeCount = 10
+	// Time allowed between the password and the TOTP code
+	pendingLoginTTL = 5 * time.Minute
+)
+
+type TotpLoginRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TotpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TotpPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// Second step of the login, when the user has TOTP enabled
+func (s *UsersRouter) handleLoginTotp(w http.ResponseWriter, r *http.Request) {
+	var req TotpLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := s.store.Get(r, sessionName)
+	userID, _ := session.Values["pending_user_id"].(string)
+	pendingAt, _ := session.Values["pending_at"].(int64)
+	if userID == "" || time.Since(time.Unix(pendingAt, 0)) > pendingLoginTTL {
+		http.Error(w, "Login expired, enter your password again", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil || user == nil || !user.TotpEnabled {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ipKey := "ip:" + s.store.ClientIP(r)
+	accountKey := "account:" + strings.ToLower(user.Email)
+	if retryAfter := max(s.ipLimiter.Locked(ipKey), s.accountLimiter.Locked(accountKey)); retryAfter > 0 {
+		s.audit(r, core.AuditLoginLocked, user.ID, user.Email, "totp")
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	details := "totp"
+	var ok bool
+	if req.RecoveryCode != "" {
+		details = "recovery code"
+		ok = s.useRecoveryCode(user.ID, req.RecoveryCode)
+	} else {
+		ok = s.useTotpCode(user, req.Code)
+	}
+
+	if !ok {
+		s.ipLimiter.Fail(ipKey)
+		s.accountLimiter.Fail(accountKey)
+		s.audit(r, core.AuditLoginFailed, user.ID, user.Email, "invalid "+details)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.ipLimiter.Reset(ipKey)
+	s.accountLimiter.Reset(accountKey)
+
+	if err := s.store.Renew(session); err != nil {
+		log.Printf("[Session] error while renewing session %v", err)
+	}
+	if err := s.completeLogin(w, r, session, user, details); err != nil {
+		http.Error(w, "Session save failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "logged"})
+}
+
+// Enrollment starts with a new secret, TOTP is only enabled once a code generated from it is verified
+func (s *UsersRouter) handleTotpSetup(w http.ResponseWriter, r *http.Request) {
+	if CurrentApiToken(r) != nil {
+		http.Error(w, "Two-factor authentication can only be configured from a session", http.StatusForbidden)
+		return
+	}
+
+	user := CurrentUser(r)
+	if user.TotpEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := security.GenerateTotpSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.TotpSecret = secret
+	if err := s.userRepository.Save(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": security.TotpURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (s *UsersRouter) handleTotpEnable(w http.ResponseWriter, r *http.Request) {
+	if CurrentApiToken(r) != nil {
+		http.Error(w, "Two-factor authentication can only be configured from a session", http.StatusForbidden)
+		return
+	}
+
+	var req TotpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	user := CurrentUser(r)
+	if user.TotpEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TotpSecret == "" {
+		http.Error(w, "Call setup first", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := security.ValidateTotp(user.TotpSecret, req.Code, time.Now(), user.TotpLastStep)
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.TotpEnabled = true
+	user.TotpLastStep = step
+	if err := s.userRepository.Save(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, core.AuditTotpEnabled, user.ID, user.Email, "")
+
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
+
+func (s *UsersRouter) handleTotpDisable(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.checkPassword(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.disableTotp(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, core.AuditTotpDisabled, user.ID, user.Email, "")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "disabled"}`))
+}
+
+func (s *UsersRouter) handleTotpRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.checkPassword(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.TotpEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
+
+// For users who lost both their authenticator and their recovery codes
+func (s *UsersRouter) handleTotpReset(w http.ResponseWriter, r *http.Request) {
+	user, err := s.userRepository.FindByID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.disableTotp(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, core.AuditTotpDisabled, user.ID, user.Email, "reset by "+CurrentUser(r).Email)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "disabled"}`))
+}
+
+func (s *UsersRouter) checkPassword(w http.ResponseWriter, r *http.Request) (*core.User, bool) {
+	if CurrentApiToken(r) != nil {
+		http.Error(w, "Two-factor authentication can only be configured from a session", http.StatusForbidden)
+		return nil, false
+	}
+
+	var req TotpPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user := CurrentUser(r)
+	if !security.CheckPasswordHash(req.Password, user.PasswordHash) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *UsersRouter) disableTotp(user *core.User) error {
+	user.TotpEnabled = false
+	user.TotpSecret = ""
+	if err := s.userRepository.Save(user); err != nil {
+		return err
+	}
+	return s.recoveryCodeRepository.DeleteByUser(user.ID)
+}
+
+func (s *UsersRouter) useTotpCode(user *core.User, code string) bool {
+	step, ok := security.ValidateTotp(user.TotpSecret, code, time.Now(), user.TotpLastStep)
+	if !ok {
+		return false
+	}
+
+	// Losing the race against a concurrent login with the same code means the code was replayed
+	updated, err := s.userRepository.UpdateTotpLastStep(user.ID, step)
+	if err != nil {
+		log.Printf("[Users] failed to update totp step of %s: %v", user.ID, err)
+		return false
+	}
+	return updated
+}
+
+func (s *UsersRouter) useRecoveryCode(userID string, code string) bool {
+	code = security.NormalizeRecoveryCode(code)
+	candidates, err := s.recoveryCodeRepository.FindByHint(userID, security.RecoveryCodeHint(code))
+	if err != nil {
+		log.Printf("[Users] failed to load recovery codes of %s: %v", userID, err)
+		return false
+	}
+
+	for _, c := range candidates {
+		if !security.CheckPasswordHash(code, c.CodeHash) {
+			continue
+		}
+		deleted, err := s.recoveryCodeRepository.Delete(c.ID)
+		if err != nil {
+			log.Printf("[Users] failed to delete recovery code of %s: %v", userID, err)
+			return false
+		}
+		return deleted
+	}
+	return false
+}
+
+// The plain codes are only returned to the user once, bcrypt is slow on purpose so they are hashed concurrently
+func (s *UsersRouter) newRecoveryCodes(userID string) ([]string, error) {
+	plain, err := security.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]*core.RecoveryCode, len(plain))
+	errs := make([]error, len(plain))
+	var wg sync.WaitGroup
+	for i, p := range plain {
+		wg.Go(func() {
+			hash, err := security.HashPassword(p)
+			codes[i] = &core.RecoveryCode{ID: uuid.New().String(), UserID: userID, Hint: security.RecoveryCodeHint(p), CodeHash: hash}
+			errs[i] = err
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.recoveryCodeRepository.Replace(userID, codes); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
@@ -1,11 +1,16 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"log"
 	"net/http"
 	"net/mail"
+	"strconv"
+	"strings"
 
 	"github.com/Bastien2203/go-home/internal/core"
 	"github.com/Bastien2203/go-home/internal/repository"
@@ -15,30 +20,114 @@ import (
 	"github.com/gorilla/sessions"
 )
 
+const (
+	minPasswordLength = 8
+	passwordResetTTL  = time.Hour
+)
+
+type contextKey string
+
+const (
+	userContextKey     contextKey = "user"
+	roleContextKey     contextKey = "role"
+	apiTokenContextKey contextKey = "api_token"
+)
+
 type UsersRouter struct {
-	store          *sessions.CookieStore
-	userRepository *repository.UserRepository
-	appEnv         config.AppEnv
+	store                   *SessionStore
+	userRepository          core.UserRepository
+	invitationRepository    core.InvitationRepository
+	passwordResetRepository core.PasswordResetRepository
+	apiTokenRepository      core.ApiTokenRepository
+	auditRepository         core.AuditRepository
+	recoveryCodeRepository  core.RecoveryCodeRepository
+	ipLimiter               *security.LoginLimiter
+	accountLimiter          *security.LoginLimiter
 }
 
 type UserRequest struct {
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	InvitationToken string `json:"invitation_token,omitempty"`
+}
+
+type UserCreateRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type RoleUpdateRequest struct {
+	Role string `json:"role"`
 }
 
-func NewUsersRouter(mux *http.ServeMux, sessionSecret string, appEnv config.AppEnv, userRepository *repository.UserRepository) *UsersRouter {
-	var store = sessions.NewCookieStore([]byte(sessionSecret))
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewUsersRouter(mux *http.ServeMux, cfg *config.Config, repositories *repository.Store) *UsersRouter {
+	store := NewSessionStore(repositories.Sessions, cfg.SessionSecret, &sessions.Options{
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   cfg.AppEnv == config.Production,
+		SameSite: http.SameSiteLaxMode,
+	}, cfg.SessionMaxAge, cfg.SessionIdleTimeout, cfg.TrustProxyHeaders)
+
 	r := &UsersRouter{
-		store:          store,
-		userRepository: userRepository,
-		appEnv:         appEnv,
+		store:                   store,
+		userRepository:          repositories.Users,
+		invitationRepository:    repositories.Invitations,
+		passwordResetRepository: repositories.PasswordResets,
+		apiTokenRepository:      repositories.ApiTokens,
+		auditRepository:         repositories.Audit,
+		recoveryCodeRepository:  repositories.RecoveryCodes,
+		// The window is the lockout duration: failures are forgotten once a lockout would have ended
+		ipLimiter:      security.NewLoginLimiter(cfg.LoginMaxFailuresIP, cfg.LoginLockout, cfg.LoginLockout),
+		accountLimiter: security.NewLoginLimiter(cfg.LoginMaxFailuresAccount, cfg.LoginLockout, cfg.LoginLockout),
 	}
 
+	admin := r.RequireRole(core.RoleAdmin)
+	anyUser := r.RequireRole(core.RoleViewer)
+
 	mux.HandleFunc("POST /api/users/login", r.handleLogin)
+	mux.HandleFunc("POST /api/users/login/totp", r.handleLoginTotp)
 	mux.HandleFunc("POST /api/users/logout", r.handleLogout)
 	mux.HandleFunc("POST /api/users/register", r.handleRegister)
 	mux.HandleFunc("GET /api/users/me", r.handleMe)
 	mux.HandleFunc("GET /api/users/can_register", r.handleCanRegister)
+	mux.HandleFunc("POST /api/users/password_reset", r.handlePasswordReset)
+	mux.Handle("POST /api/users/me/password", anyUser(http.HandlerFunc(r.handleChangePassword)))
+	mux.Handle("POST /api/users/logout_all", anyUser(http.HandlerFunc(r.handleLogoutAll)))
+	mux.Handle("GET /api/users/me/sessions", anyUser(http.HandlerFunc(r.handleListSessions)))
+	mux.Handle("DELETE /api/users/me/sessions/{id}", anyUser(http.HandlerFunc(r.handleDeleteSession)))
+	mux.Handle("GET /api/users/audit", admin(http.HandlerFunc(r.handleListAudit)))
+
+	mux.Handle("GET /api/users", admin(http.HandlerFunc(r.handleListUsers)))
+	mux.Handle("POST /api/users", admin(http.HandlerFunc(r.handleCreateUser)))
+	mux.Handle("DELETE /api/users/{id}", admin(http.HandlerFunc(r.handleDeleteUser)))
+	mux.Handle("PUT /api/users/{id}/role", admin(http.HandlerFunc(r.handleUpdateRole)))
+	mux.Handle("POST /api/users/{id}/password_reset", admin(http.HandlerFunc(r.handleCreatePasswordReset)))
+
+	mux.Handle("POST /api/users/me/totp/setup", anyUser(http.HandlerFunc(r.handleTotpSetup)))
+	mux.Handle("POST /api/users/me/totp/enable", anyUser(http.HandlerFunc(r.handleTotpEnable)))
+	mux.Handle("POST /api/users/me/totp/disable", anyUser(http.HandlerFunc(r.handleTotpDisable)))
+	mux.Handle("POST /api/users/me/totp/recovery_codes", anyUser(http.HandlerFunc(r.handleTotpRecoveryCodes)))
+	mux.Handle("POST /api/users/{id}/totp/reset", admin(http.HandlerFunc(r.handleTotpReset)))
+
+	mux.Handle("GET /api/users/me/tokens", anyUser(http.HandlerFunc(r.handleListApiTokens)))
+	mux.Handle("POST /api/users/me/tokens", anyUser(http.HandlerFunc(r.handleCreateApiToken)))
+	mux.Handle("DELETE /api/users/me/tokens/{id}", anyUser(http.HandlerFunc(r.handleDeleteApiToken)))
+
+	mux.HandleFunc("GET /api/users/invitations/{token}", r.handleGetInvitation)
+	mux.Handle("GET /api/users/invitations", admin(http.HandlerFunc(r.handleListInvitations)))
+	mux.Handle("POST /api/users/invitations", admin(http.HandlerFunc(r.handleCreateInvitation)))
+	mux.Handle("DELETE /api/users/invitations/{id}", admin(http.HandlerFunc(r.handleDeleteInvitation)))
 
 	return r
 }
@@ -56,30 +145,56 @@ func (s *UsersRouter) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.userRepository.FindByEmail(loginRequest.Email)
-	if err != nil {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	ipKey := "ip:" + s.store.ClientIP(r)
+	accountKey := "account:" + strings.ToLower(loginRequest.Email)
+
+	if retryAfter := max(s.ipLimiter.Locked(ipKey), s.accountLimiter.Locked(accountKey)); retryAfter > 0 {
+		s.audit(r, core.AuditLoginLocked, "", loginRequest.Email, "")
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
 		return
 	}
 
-	passOk := security.CheckPasswordHash(loginRequest.Password, user.PasswordHash)
-	if !passOk {
+	user, err := s.userRepository.FindByEmail(loginRequest.Email)
+	if err != nil || user == nil || !security.CheckPasswordHash(loginRequest.Password, user.PasswordHash) {
+		details := "invalid password"
+		if user == nil {
+			details = "unknown account"
+		}
+		if s.ipLimiter.Fail(ipKey) {
+			details += ", ip locked"
+		}
+		if s.accountLimiter.Fail(accountKey) {
+			details += ", account locked"
+		}
+		s.audit(r, core.AuditLoginFailed, "", loginRequest.Email, details)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	session, _ := s.store.Get(r, "session-name")
-	session.Values["authenticated"] = true
-	session.Values["user_id"] = user.ID
+	session, _ := s.store.Get(r, sessionName)
+	if err := s.store.Renew(session); err != nil {
+		log.Printf("[Session] error while renewing session %v", err)
+	}
+
+	// The password is right but the session stays unauthenticated until the TOTP code is verified
+	if user.TotpEnabled {
+		session.Values = map[any]any{
+			"pending_user_id": user.ID,
+			"pending_at":      time.Now().Unix(),
+		}
+		if err := session.Save(r, w); err != nil {
+			log.Printf("[Session] error while saving session %v", err)
+			http.Error(w, "Session save failed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "totp_required"})
+		return
+	}
 
-	session.Options.HttpOnly = true
-	session.Options.Secure = s.appEnv == config.Production
-	session.Options.SameSite = http.SameSiteLaxMode
-	session.Options.Path = "/"
-	session.Options.Domain = ""
-	err = session.Save(r, w)
-	if err != nil {
-		log.Printf("[Session] error while saving session %v", err)
+	s.ipLimiter.Reset(ipKey)
+	s.accountLimiter.Reset(accountKey)
+	if err := s.completeLogin(w, r, session, user, ""); err != nil {
 		http.Error(w, "Session save failed", http.StatusInternalServerError)
 		return
 	}
@@ -88,8 +203,27 @@ func (s *UsersRouter) handleLogin(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "logged"})
 }
 
+func (s *UsersRouter) completeLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, user *core.User, details string) error {
+	session.Values = map[any]any{
+		"authenticated": true,
+		"user_id":       user.ID,
+	}
+
+	if err := session.Save(r, w); err != nil {
+		log.Printf("[Session] error while saving session %v", err)
+		return err
+	}
+
+	if err := s.store.DeleteExpired(); err != nil {
+		log.Printf("[Session] error while deleting expired sessions %v", err)
+	}
+	s.audit(r, core.AuditLoginSucceeded, user.ID, user.Email, details)
+	return nil
+}
+
 func (s *UsersRouter) handleLogout(w http.ResponseWriter, r *http.Request) {
-	session, _ := s.store.Get(r, "session-name")
+	session, _ := s.store.Get(r, sessionName)
+	userID, _ := session.Values["user_id"].(string)
 	session.Values = make(map[any]any)
 	session.Options.MaxAge = -1
 
@@ -99,6 +233,10 @@ func (s *UsersRouter) handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if userID != "" {
+		s.audit(r, core.AuditLogout, userID, "", "")
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Logged out"}`))
 }
@@ -113,31 +251,19 @@ func (s *UsersRouter) handleCanRegister(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *UsersRouter) handleMe(w http.ResponseWriter, r *http.Request) {
-	session, _ := s.store.Get(r, "session-name")
-
-	if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	userID, ok := session.Values["user_id"].(string)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	user, err := s.userRepository.FindByID(userID)
-	if err != nil {
+	user, _, _ := s.authenticate(r)
+	if user == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	json.NewEncoder(w).Encode(user)
 }
 
+// The first account becomes admin, the next ones need an invitation
 func (s *UsersRouter) handleRegister(w http.ResponseWriter, r *http.Request) {
 	count, err := s.userRepository.Count()
-	if err != nil || *count != 0 {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -148,20 +274,39 @@ func (s *UsersRouter) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role := core.RoleAdmin
+	var invitation *core.Invitation
+	if *count != 0 {
+		invitation = s.findValidInvitation(signInRequest.InvitationToken)
+		if invitation == nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		// The invitation is bound to the invited address
+		signInRequest.Email = invitation.Email
+		role = invitation.Role
+	}
+
 	if !mailIsValid(signInRequest.Email) {
 		http.Error(w, "Invalid email format", http.StatusBadRequest)
 		return
 	}
 
-	hashedPassword, err := security.HashPassword(signInRequest.Password)
+	if existing, _ := s.userRepository.FindByEmail(signInRequest.Email); existing != nil {
+		http.Error(w, "Email already registered", http.StatusConflict)
+		return
+	}
+
+	hashedPassword, err := hashNewPassword(signInRequest.Password)
 	if err != nil {
-		http.Error(w, "Invalid password format", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	u := &core.User{
 		ID:           uuid.New().String(),
 		Email:        signInRequest.Email,
+		Role:         role,
 		PasswordHash: hashedPassword,
 	}
 
@@ -170,23 +315,376 @@ func (s *UsersRouter) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if invitation != nil {
+		if err := s.invitationRepository.Delete(invitation.ID); err != nil {
+			log.Printf("[Users] failed to delete used invitation %s: %v", invitation.ID, err)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
 }
 
+func (s *UsersRouter) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.userRepository.FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(users)
+}
+
+func (s *UsersRouter) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req UserCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := core.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !mailIsValid(req.Email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	if existing, _ := s.userRepository.FindByEmail(req.Email); existing != nil {
+		http.Error(w, "Email already registered", http.StatusConflict)
+		return
+	}
+
+	hashedPassword, err := hashNewPassword(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := &core.User{
+		ID:           uuid.New().String(),
+		Email:        req.Email,
+		Role:         role,
+		PasswordHash: hashedPassword,
+		CreatedAt:    time.Now(),
+	}
+
+	if err := s.userRepository.Save(u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+func (s *UsersRouter) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if CurrentUser(r).ID == id {
+		http.Error(w, "You cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.userRepository.Delete(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.passwordResetRepository.DeleteByUser(id); err != nil {
+		log.Printf("[Users] failed to delete password resets of %s: %v", id, err)
+	}
+	if err := s.apiTokenRepository.DeleteByUser(id); err != nil {
+		log.Printf("[Users] failed to delete api tokens of %s: %v", id, err)
+	}
+	if err := s.store.repository.DeleteByUser(id, ""); err != nil {
+		log.Printf("[Users] failed to delete sessions of %s: %v", id, err)
+	}
+	if err := s.recoveryCodeRepository.DeleteByUser(id); err != nil {
+		log.Printf("[Users] failed to delete recovery codes of %s: %v", id, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "deleted"}`))
+}
+
+func (s *UsersRouter) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	var req RoleUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := core.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.userRepository.FindByID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Never leave the instance without an admin
+	if user.Role == core.RoleAdmin && role != core.RoleAdmin {
+		admins, err := s.userRepository.CountByRole(core.RoleAdmin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if admins <= 1 {
+			http.Error(w, "At least one admin is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user.Role = role
+	if err := s.userRepository.Save(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+func (s *UsersRouter) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	user := CurrentUser(r)
+	if !security.CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := hashNewPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user.PasswordHash = hashedPassword
+	if err := s.userRepository.Save(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the current session, log out everywhere else
+	session, _ := s.store.Get(r, sessionName)
+	if err := s.store.repository.DeleteByUser(user.ID, s.store.SessionID(session)); err != nil {
+		log.Printf("[Users] failed to delete sessions of %s: %v", user.ID, err)
+	}
+	s.audit(r, core.AuditPasswordChanged, user.ID, user.Email, "")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "updated"}`))
+}
+
+// There is no mail server, the admin hands the token over to the user
+func (s *UsersRouter) handleCreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, err := s.userRepository.FindByID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	token, err := security.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.passwordResetRepository.DeleteByUser(user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reset := &core.PasswordReset{
+		TokenHash: security.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := s.passwordResetRepository.Save(reset); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":      token,
+		"expires_at": reset.ExpiresAt,
+	})
+}
+
+func (s *UsersRouter) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	reset, err := s.passwordResetRepository.FindByTokenHash(security.HashToken(req.Token))
+	if err != nil || reset == nil || time.Now().After(reset.ExpiresAt) {
+		http.Error(w, "Invalid or expired token", http.StatusForbidden)
+		return
+	}
+
+	user, err := s.userRepository.FindByID(reset.UserID)
+	if err != nil || user == nil {
+		http.Error(w, "Invalid or expired token", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := hashNewPassword(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user.PasswordHash = hashedPassword
+	if err := s.userRepository.Save(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.passwordResetRepository.DeleteByUser(user.ID); err != nil {
+		log.Printf("[Users] failed to delete password resets of %s: %v", user.ID, err)
+	}
+	if err := s.store.repository.DeleteByUser(user.ID, ""); err != nil {
+		log.Printf("[Users] failed to delete sessions of %s: %v", user.ID, err)
+	}
+	s.audit(r, core.AuditPasswordReset, user.ID, user.Email, "")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "updated"}`))
+}
+
+// AuthMiddleware lets viewers read, anything else requires at least the member role
 func (s *UsersRouter) AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, _ := s.store.Get(r, "session-name")
+	return s.authorize(next, func(r *http.Request) core.Role {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return core.RoleViewer
+		}
+		return core.RoleMember
+	})
+}
+
+// RequireRole is for routes where the default of AuthMiddleware doesn't fit
+func (s *UsersRouter) RequireRole(role core.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.authorize(next, func(*http.Request) core.Role { return role })
+	}
+}
 
-		if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
+func (s *UsersRouter) authorize(next http.Handler, requiredRole func(r *http.Request) core.Role) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Loaded on every request so deleted users and role changes apply immediately
+		user, role, token := s.authenticate(r)
+		if user == nil {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if required := requiredRole(r); !role.Allows(required) {
+			http.Error(w, fmt.Sprintf("Forbidden: %s role required", required), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, roleContextKey, role)
+		if token != nil {
+			ctx = context.WithValue(ctx, apiTokenContextKey, token)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// Requests are authenticated by an api token if they send one, by the session cookie otherwise
+func (s *UsersRouter) authenticate(r *http.Request) (*core.User, core.Role, *core.ApiToken) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		return s.tokenUser(header)
+	}
+
+	user := s.sessionUser(r)
+	if user == nil {
+		return nil, "", nil
+	}
+	return user, user.Role, nil
+}
+
+func (s *UsersRouter) sessionUser(r *http.Request) *core.User {
+	session, _ := s.store.Get(r, sessionName)
+
+	if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
+		return nil
+	}
+
+	userID, ok := session.Values["user_id"].(string)
+	if !ok {
+		return nil
+	}
+
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// CurrentUser returns the user authenticated by AuthMiddleware or RequireRole
+func CurrentUser(r *http.Request) *core.User {
+	user, _ := r.Context().Value(userContextKey).(*core.User)
+	return user
+}
+
+// CurrentRole returns the role granted to the request, lower than the role of the user for read only api tokens
+func CurrentRole(r *http.Request) core.Role {
+	role, _ := r.Context().Value(roleContextKey).(core.Role)
+	return role
+}
+
+// CurrentApiToken returns the token used to authenticate the request, nil for session requests
+func CurrentApiToken(r *http.Request) *core.ApiToken {
+	token, _ := r.Context().Value(apiTokenContextKey).(*core.ApiToken)
+	return token
+}
+
+func hashNewPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := security.HashPassword(password)
+	if err != nil {
+		return "", fmt.Errorf("invalid password format")
+	}
+	return hash, nil
+}
+
 func mailIsValid(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
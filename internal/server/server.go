@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/subtle"
 	"fmt"
 
 	"log"
@@ -9,30 +10,40 @@ import (
 	"path/filepath"
 
 	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/metrics"
 	"github.com/Bastien2203/go-home/internal/repository"
 	"github.com/Bastien2203/go-home/internal/server/routes"
+	"github.com/Bastien2203/go-home/internal/sse"
+	"github.com/Bastien2203/go-home/internal/transfer"
 	"github.com/Bastien2203/go-home/internal/websockets"
 	"github.com/Bastien2203/go-home/shared/config"
 	"github.com/Bastien2203/go-home/shared/middlewares"
 )
 
 type Server struct {
-	kernel         *core.Kernel
-	addr           string
-	wsHub          *websockets.Hub
-	userRepository *repository.UserRepository
-	sessionSecret  string
-	appEnv         config.AppEnv
+	kernel       *core.Kernel
+	addr         string
+	wsHub        *websockets.Hub
+	sseBroker    *sse.Broker
+	store        *repository.Store
+	backups      *repository.Backups
+	cfg          *config.Config
+	metrics      *metrics.Metrics
+	metricsToken string
 }
 
-func NewServer(kernel *core.Kernel, port int, sessionSecret string, appEnv config.AppEnv, wsHub *websockets.Hub, userRepository *repository.UserRepository) *Server {
+// backups is nil with PostgreSQL, metrics when the /metrics endpoint is disabled
+func NewServer(kernel *core.Kernel, cfg *config.Config, wsHub *websockets.Hub, sseBroker *sse.Broker, store *repository.Store, backups *repository.Backups, metrics *metrics.Metrics) *Server {
 	return &Server{
-		kernel:         kernel,
-		addr:           fmt.Sprintf(":%d", port),
-		wsHub:          wsHub,
-		sessionSecret:  sessionSecret,
-		appEnv:         appEnv,
-		userRepository: userRepository,
+		kernel:       kernel,
+		addr:         fmt.Sprintf(":%d", cfg.ApiPort),
+		wsHub:        wsHub,
+		sseBroker:    sseBroker,
+		cfg:          cfg,
+		store:        store,
+		backups:      backups,
+		metrics:      metrics,
+		metricsToken: cfg.MetricsToken,
 	}
 }
 
@@ -43,15 +54,25 @@ func (s *Server) Start() error {
 
 	// --- Routes ---
 
-	userRouter := routes.NewUsersRouter(mux, s.sessionSecret, s.appEnv, s.userRepository)
+	userRouter := routes.NewUsersRouter(mux, s.cfg, s.store)
 	routes.NewAdaptersRouter(s.kernel, mux, userRouter.AuthMiddleware)
 	routes.NewDevicesRouter(s.kernel, mux, userRouter.AuthMiddleware)
+	routes.NewAreasRouter(s.kernel, mux, userRouter.AuthMiddleware)
+	routes.NewAdminRouter(s.kernel, s.backups, transfer.NewTransfer(s.kernel, s.store.Users), mux, userRouter.RequireRole(core.RoleAdmin))
+	routes.NewPluginCredentialsRouter(s.store.PluginCredentials, mux, userRouter.RequireRole(core.RoleAdmin))
 	routes.NewPluginsRouter(s.kernel, mux, userRouter.AuthMiddleware)
 	routes.NewScannersRouter(s.kernel, mux, userRouter.AuthMiddleware)
 
-	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		websockets.ServeWs(s.wsHub, w, r)
-	})
+	mux.Handle("GET /ws", userRouter.RequireRole(core.RoleViewer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websockets.ServeWs(s.wsHub, w, r, routes.CurrentRole(r))
+	})))
+	mux.Handle("GET /api/events/stream", userRouter.RequireRole(core.RoleViewer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.sseBroker.ServeStream(w, r, routes.CurrentRole(r))
+	})))
+
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metricsAuth(s.metrics.Handler()))
+	}
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		path := filepath.Join(staticDir, r.URL.Path)
@@ -70,11 +91,30 @@ func (s *Server) Start() error {
 		http.FileServer(http.Dir(staticDir)).ServeHTTP(w, r)
 	})
 
+	handler := middlewares.CorsMiddleware(mux)
+	if s.metrics != nil {
+		handler = s.metrics.Middleware(handler)
+	}
+
 	server := &http.Server{
 		Addr:    s.addr,
-		Handler: middlewares.CorsMiddleware(mux),
+		Handler: handler,
 	}
 
 	log.Printf("[Server] API listening on http://localhost%s", s.addr)
 	return server.ListenAndServe()
 }
+
+// Prometheus scrapers have no session, the endpoint is either public or protected by a static token
+func (s *Server) metricsAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.metricsToken != "" {
+			expected := []byte("Bearer " + s.metricsToken)
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,235 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/websockets"
+)
+
+const (
+	defaultHeartbeat = 15 * time.Second
+	subscriberBuffer = 256
+	retryMillis      = 3000
+)
+
+type event struct {
+	seq   uint64
+	topic websockets.Topic
+	data  []byte // the websocket message, so both transports carry the same payloads
+}
+
+type subscriber struct {
+	accept func(topic websockets.Topic) bool
+	events chan event
+}
+
+// Broker streams the messages broadcast by the websocket hub as Server-Sent Events.
+// The last messages are kept in a ring buffer so clients can resume with Last-Event-ID.
+type Broker struct {
+	hub       *websockets.Hub
+	epoch     int64 // event ids are "{epoch}-{seq}", ids from before a restart are not resumed
+	heartbeat time.Duration
+
+	mu          sync.Mutex
+	buffer      []event
+	seq         uint64
+	subscribers map[*subscriber]bool
+}
+
+// NewBroker must be called before the hub runs, bufferSize is the number of messages kept for resuming
+func NewBroker(hub *websockets.Hub, bufferSize int) *Broker {
+	b := &Broker{
+		hub:         hub,
+		epoch:       time.Now().Unix(),
+		heartbeat:   defaultHeartbeat,
+		buffer:      make([]event, max(bufferSize, 1)),
+		subscribers: make(map[*subscriber]bool),
+	}
+	hub.Mirror(b.publish)
+	return b
+}
+
+func (b *Broker) publish(msg *websockets.Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[SSE] error encoding message of %s : %v", msg.Topic, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := event{seq: b.seq, topic: msg.Topic, data: data}
+	b.buffer[b.seq%uint64(len(b.buffer))] = e
+
+	for s := range b.subscribers {
+		if !s.accept(e.topic) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			// Too slow, the client reconnects and resumes from its last event
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// subscribe registers s and returns the buffered events after lastSeq. resumed is false when some of them
+// were already dropped from the buffer.
+func (b *Broker) subscribe(s *subscriber, lastSeq uint64, resume bool) (replay []event, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[s] = true
+	if !resume || lastSeq > b.seq {
+		return nil, false
+	}
+
+	size := uint64(len(b.buffer))
+	if b.seq > size && lastSeq < b.seq-size {
+		return nil, false
+	}
+	for seq := lastSeq + 1; seq <= b.seq; seq++ {
+		if e := b.buffer[seq%size]; s.accept(e.topic) {
+			replay = append(replay, e)
+		}
+	}
+	return replay, true
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, s)
+}
+
+func (b *Broker) eventID(seq uint64) string {
+	return fmt.Sprintf("%d-%d", b.epoch, seq)
+}
+
+func (b *Broker) parseEventID(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != strconv.FormatInt(b.epoch, 10) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// ServeStream streams the topics given by the "topic" query parameters (repeated or comma separated),
+// every topic the role can read when there is none. Clients resuming with Last-Event-ID (or the
+// "last_event_id" parameter) receive the messages they missed, other clients the snapshot of the topics.
+func (b *Broker) ServeStream(w http.ResponseWriter, r *http.Request, role core.Role) {
+	var topics []websockets.Topic
+	for _, param := range r.URL.Query()["topic"] {
+		for name := range strings.SplitSeq(param, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				topics = append(topics, websockets.Topic(name))
+			}
+		}
+	}
+
+	accept := func(topic websockets.Topic) bool {
+		return websockets.CanSubscribe(role, topic)
+	}
+	if len(topics) > 0 {
+		wanted := make(map[websockets.Topic]bool, len(topics))
+		for _, topic := range topics {
+			if !websockets.CanSubscribe(role, topic) {
+				http.Error(w, fmt.Sprintf("cannot subscribe to %s", topic), http.StatusForbidden)
+				return
+			}
+			wanted[topic] = true
+		}
+		accept = func(topic websockets.Topic) bool { return wanted[topic] }
+	} else {
+		for _, topic := range websockets.Topics() {
+			if accept(topic) {
+				topics = append(topics, topic)
+			}
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	lastSeq, resume := b.parseEventID(lastEventID)
+
+	s := &subscriber{accept: accept, events: make(chan event, subscriberBuffer)}
+	replay, resumed := b.subscribe(s, lastSeq, resume)
+	defer b.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx buffers responses by default
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+
+	if !resumed {
+		// Sent after subscribing, a change can be both in the snapshot and in the stream but never in neither
+		for _, topic := range topics {
+			snapshot, err := b.hub.Snapshot(topic)
+			if err != nil {
+				snapshot = &websockets.Message{Action: websockets.ActionError, Topic: topic, Error: err.Error()}
+			}
+			if snapshot == nil {
+				continue
+			}
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", topic, data)
+		}
+	}
+	for _, e := range replay {
+		b.writeEvent(w, e)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(b.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case e, ok := <-s.events:
+			if !ok {
+				return
+			}
+			if err := b.writeEvent(w, e); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (b *Broker) writeEvent(w http.ResponseWriter, e event) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", b.eventID(e.seq), e.topic, e.data)
+	return err
+}
@@ -0,0 +1,135 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/websockets"
+)
+
+func publishN(b *Broker, topic websockets.Topic, n int) {
+	for range n {
+		b.publish(&websockets.Message{Action: websockets.ActionBroadcast, Topic: topic})
+	}
+}
+
+func acceptAll(websockets.Topic) bool { return true }
+
+func TestResumeFromBuffer(t *testing.T) {
+	b := NewBroker(websockets.NewHub(nil), 4)
+	publishN(b, websockets.TopicDeviceState, 6)
+
+	replay, resumed := b.subscribe(&subscriber{accept: acceptAll, events: make(chan event, 1)}, 3, true)
+	if !resumed || len(replay) != 3 || replay[0].seq != 4 || replay[2].seq != 6 {
+		t.Fatalf("Unexpected replay %v %v", resumed, replay)
+	}
+
+	// Event 2 was dropped from the buffer
+	if _, resumed := b.subscribe(&subscriber{accept: acceptAll, events: make(chan event, 1)}, 1, true); resumed {
+		t.Fatalf("Resumed although events were dropped")
+	}
+
+	// Id from the future, e.g. before a restart
+	if _, resumed := b.subscribe(&subscriber{accept: acceptAll, events: make(chan event, 1)}, 10, true); resumed {
+		t.Fatalf("Resumed from an unknown event")
+	}
+}
+
+func TestEventIDs(t *testing.T) {
+	b := NewBroker(websockets.NewHub(nil), 4)
+
+	if seq, ok := b.parseEventID(b.eventID(42)); !ok || seq != 42 {
+		t.Fatalf("Failed to parse own event id")
+	}
+	if _, ok := b.parseEventID("1-42"); ok {
+		t.Fatalf("Parsed an event id of another epoch")
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := NewBroker(websockets.NewHub(nil), 4)
+	s := &subscriber{accept: acceptAll, events: make(chan event, 1)}
+	b.subscribe(s, 0, false)
+
+	publishN(b, websockets.TopicDeviceState, 3)
+
+	received := 0
+	for range s.events {
+		received++
+	}
+	if received != 1 {
+		t.Fatalf("Expected the buffered event only, got %d", received)
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	b := NewBroker(websockets.NewHub(nil), 4)
+	b.heartbeat = 50 * time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.ServeStream(w, r, core.RoleViewer)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?topic=" + string(websockets.TopicBluetoothDevice))
+	if err != nil {
+		t.Fatalf("Request failed %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Viewer streamed a member topic, status %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?topic=device:a,device:b", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	// Wait for the subscription before publishing
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		count := len(b.subscribers)
+		b.mu.Unlock()
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stream not subscribed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	publishN(b, websockets.TopicDeviceState, 1)
+	publishN(b, websockets.DeviceTopic("b"), 1)
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if strings.HasPrefix(scanner.Text(), ": heartbeat") {
+			break
+		}
+	}
+	stream := strings.Join(lines, "\n")
+
+	expected := "id: " + b.eventID(2) + "\nevent: device:b\ndata: {\"action\":\"broadcast\",\"topic\":\"device:b\"}"
+	if !strings.Contains(stream, expected) {
+		t.Fatalf("Event of device:b missing from\n%s", stream)
+	}
+	if strings.Contains(stream, string(websockets.TopicDeviceState)) {
+		t.Fatalf("Stream not filtered\n%s", stream)
+	}
+}
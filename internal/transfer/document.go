@@ -0,0 +1,202 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the document format, documents of a newer version are refused
+const Version = 1
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("invalid format %q, expected json or yaml", s)
+}
+
+// Document is the configuration of an instance: what was set up by hand, not the state of the devices
+type Document struct {
+	Version    int       `json:"version" yaml:"version"`
+	ExportedAt time.Time `json:"exported_at" yaml:"exported_at"`
+	Areas      []Area    `json:"areas" yaml:"areas"`
+	Devices    []Device  `json:"devices" yaml:"devices"`
+	Users      []User    `json:"users" yaml:"users"`
+	Plugins    []Plugin  `json:"plugins" yaml:"plugins"`
+}
+
+type Area struct {
+	ID       string `json:"id" yaml:"id"`
+	Name     string `json:"name" yaml:"name"`
+	ParentID string `json:"parent_id,omitempty" yaml:"parent_id,omitempty"`
+	Icon     string `json:"icon,omitempty" yaml:"icon,omitempty"`
+}
+
+type Device struct {
+	ID           string            `json:"id,omitempty" yaml:"id,omitempty"`
+	Address      string            `json:"address" yaml:"address"`
+	AddressType  types.AddressType `json:"address_type" yaml:"address_type"`
+	Name         string            `json:"name" yaml:"name"`
+	AdapterIDs   []string          `json:"adapter_ids,omitempty" yaml:"adapter_ids,omitempty"`
+	AreaID       string            `json:"area_id,omitempty" yaml:"area_id,omitempty"`
+	Icon         string            `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Manufacturer string            `json:"manufacturer,omitempty" yaml:"manufacturer,omitempty"`
+	Model        string            `json:"model,omitempty" yaml:"model,omitempty"`
+	Notes        string            `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Tags         []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt    time.Time         `json:"created_at,omitzero" yaml:"created_at,omitempty"`
+}
+
+// User secrets are only exported on request, users imported without a password hash need a password reset
+type User struct {
+	ID           string    `json:"id,omitempty" yaml:"id,omitempty"`
+	Email        string    `json:"email" yaml:"email"`
+	Role         core.Role `json:"role" yaml:"role"`
+	CreatedAt    time.Time `json:"created_at,omitzero" yaml:"created_at,omitempty"`
+	PasswordHash string    `json:"password_hash,omitempty" yaml:"password_hash,omitempty"`
+	TotpEnabled  bool      `json:"totp_enabled,omitempty" yaml:"totp_enabled,omitempty"`
+	TotpSecret   string    `json:"totp_secret,omitempty" yaml:"totp_secret,omitempty"`
+}
+
+// Plugin configuration owned by the core, plugins are configured by their own environment otherwise
+type Plugin struct {
+	ID    string            `json:"id" yaml:"id"`
+	Name  string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Type  plugin.PluginType `json:"type" yaml:"type"`
+	State types.State       `json:"state" yaml:"state"`
+}
+
+func (d *Document) Marshal(format Format) ([]byte, error) {
+	if format == FormatYAML {
+		var b bytes.Buffer
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(d); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), encoder.Close()
+	}
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Parse decodes and validates a document, unknown fields are refused so typos are not silently ignored
+func Parse(data []byte, format Format) (*Document, error) {
+	var doc Document
+	if format == FormatYAML {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid yaml: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Validate checks each entry on its own, references to areas and devices are resolved by the import
+func (d *Document) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch {
+	case d.Version == 0:
+		invalid("version is required")
+	case d.Version > Version:
+		invalid("document version %d is newer than this version of go-home (%d)", d.Version, Version)
+	}
+
+	areaIDs := make(map[string]bool)
+	for i, area := range d.Areas {
+		if area.ID == "" {
+			invalid("areas[%d]: id is required", i)
+		} else if areaIDs[area.ID] {
+			invalid("areas[%d]: duplicate id %s", i, area.ID)
+		}
+		areaIDs[area.ID] = true
+		if strings.TrimSpace(area.Name) == "" {
+			invalid("areas[%d]: name is required", i)
+		}
+	}
+
+	deviceIDs := make(map[string]bool)
+	addresses := make(map[string]bool)
+	for i, device := range d.Devices {
+		if device.ID != "" {
+			if deviceIDs[device.ID] {
+				invalid("devices[%d]: duplicate id %s", i, device.ID)
+			}
+			deviceIDs[device.ID] = true
+		}
+		if device.Address == "" {
+			invalid("devices[%d]: address is required", i)
+		}
+		if device.AddressType != types.BLEAddress && device.AddressType != types.BasicAddress {
+			invalid("devices[%d]: invalid address type %q, expected %s or %s", i, device.AddressType, types.BLEAddress, types.BasicAddress)
+		}
+		key := string(device.AddressType) + "/" + device.Address
+		if addresses[key] {
+			invalid("devices[%d]: duplicate address %s", i, device.Address)
+		}
+		addresses[key] = true
+		if strings.TrimSpace(device.Name) == "" {
+			invalid("devices[%d]: name is required", i)
+		}
+	}
+
+	emails := make(map[string]bool)
+	for i, user := range d.Users {
+		if !strings.Contains(user.Email, "@") {
+			invalid("users[%d]: invalid email %q", i, user.Email)
+		} else if emails[strings.ToLower(user.Email)] {
+			invalid("users[%d]: duplicate email %s", i, user.Email)
+		}
+		emails[strings.ToLower(user.Email)] = true
+		if _, err := core.ParseRole(string(user.Role)); err != nil {
+			invalid("users[%d]: %v", i, err)
+		}
+	}
+
+	for i, p := range d.Plugins {
+		if p.ID == "" {
+			invalid("plugins[%d]: id is required", i)
+		}
+		if p.Type != plugin.PluginAdapter && p.Type != plugin.PluginScanner {
+			invalid("plugins[%d]: invalid type %q", i, p.Type)
+		}
+		if p.State != types.StateRunning && p.State != types.StateStopped {
+			invalid("plugins[%d]: invalid state %q, expected %s or %s", i, p.State, types.StateRunning, types.StateStopped)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: time.Now().Truncate(time.Second),
+		Areas:      []Area{{ID: "a1", Name: "House"}, {ID: "a2", Name: "Kitchen", ParentID: "a1"}},
+		Devices: []Device{{
+			ID: "d1", Address: "AA:BB", AddressType: types.BLEAddress, Name: "Sensor",
+			AdapterIDs: []string{"homekit"}, AreaID: "a2", Tags: []string{"garden"}, CreatedAt: time.Now().Truncate(time.Second),
+		}},
+		Users:   []User{{ID: "u1", Email: "a@example.com", Role: core.RoleAdmin}},
+		Plugins: []Plugin{{ID: "homekit", Type: plugin.PluginAdapter, State: types.StateRunning}},
+	}
+
+	for _, format := range []Format{FormatJSON, FormatYAML} {
+		data, err := doc.Marshal(format)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s %v", format, err)
+		}
+		parsed, err := Parse(data, format)
+		if err != nil {
+			t.Fatalf("Failed to parse %s %v\n%s", format, err, data)
+		}
+		device := parsed.Devices[0]
+		if len(parsed.Areas) != 2 || parsed.Areas[1].ParentID != "a1" || device.AreaID != "a2" || device.AdapterIDs[0] != "homekit" ||
+			!device.CreatedAt.Equal(doc.Devices[0].CreatedAt) || parsed.Users[0].Role != core.RoleAdmin || parsed.Plugins[0].State != types.StateRunning {
+			t.Fatalf("Document changed by a %s round trip %+v", format, parsed)
+		}
+	}
+}
+
+func TestParseRefusesInvalidDocuments(t *testing.T) {
+	tests := map[string]string{
+		"newer version": `{"version": 1000}`,
+		"unknown field": `{"version": 1, "devicez": []}`,
+		"address type":  `{"version": 1, "devices": [{"address": "a", "address_type": "zigbee", "name": "a"}]}`,
+		"duplicate":     `{"version": 1, "devices": [{"address": "a", "address_type": "basic", "name": "a"}, {"address": "a", "address_type": "basic", "name": "b"}]}`,
+		"role":          `{"version": 1, "users": [{"email": "a@example.com", "role": "owner"}]}`,
+		"plugin state":  `{"version": 1, "plugins": [{"id": "p", "type": "plugin_adapter", "state": "restarting"}]}`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data), FormatJSON); err == nil {
+			t.Fatalf("%s: parsed an invalid document", name)
+		}
+	}
+
+	// Every problem is reported at once
+	_, err := Parse([]byte("version: 1\nareas:\n  - name: House\ndevices:\n  - address: a\n    address_type: basic\n"), FormatYAML)
+	if err == nil || !strings.Contains(err.Error(), "areas[0]: id is required") || !strings.Contains(err.Error(), "devices[0]: name is required") {
+		t.Fatalf("Expected every error %v", err)
+	}
+}
@@ -0,0 +1,493 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+	"github.com/google/uuid"
+)
+
+type Mode string
+
+const (
+	ModeMerge   Mode = "merge"   // creates and updates, nothing is deleted
+	ModeReplace Mode = "replace" // also deletes the devices and areas missing from the sections of the document, and unlinks their adapters
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case "":
+		return ModeMerge, nil
+	case ModeMerge, ModeReplace:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, expected %s or %s", s, ModeMerge, ModeReplace)
+}
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Change is one step of an import, applied through the kernel so adapters are notified
+type Change struct {
+	Kind   string   `json:"kind"` // area, device, user or plugin
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Action Action   `json:"action"`
+	Fields []string `json:"fields,omitempty"` // what an update changes
+	Error  string   `json:"error,omitempty"`  // set when the change failed to apply
+
+	apply func() error
+}
+
+type ImportResult struct {
+	Mode     Mode      `json:"mode"`
+	DryRun   bool      `json:"dry_run"`
+	Changes  []*Change `json:"changes"`
+	Warnings []string  `json:"warnings"`
+	Failed   int       `json:"failed"`
+}
+
+// Transfer exports the configuration of the instance and imports it, on another one or after a reinstall
+type Transfer struct {
+	kernel *core.Kernel
+	users  core.UserRepository
+}
+
+func NewTransfer(kernel *core.Kernel, users core.UserRepository) *Transfer {
+	return &Transfer{kernel: kernel, users: users}
+}
+
+// Export returns the configuration, password hashes and TOTP secrets are only included with withSecrets
+func (t *Transfer) Export(withSecrets bool) (*Document, error) {
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: time.Now(),
+		Areas:      []Area{},
+		Devices:    []Device{},
+		Users:      []User{},
+		Plugins:    []Plugin{},
+	}
+
+	for _, area := range t.kernel.ListAreas() {
+		doc.Areas = append(doc.Areas, Area{ID: area.ID, Name: area.Name, ParentID: area.ParentID, Icon: area.Icon})
+	}
+
+	devices, err := t.kernel.ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		doc.Devices = append(doc.Devices, Device{
+			ID:           device.ID,
+			Address:      device.Address,
+			AddressType:  device.AddressType,
+			Name:         device.Name,
+			AdapterIDs:   device.AdapterIDs,
+			AreaID:       device.AreaID,
+			Icon:         device.Icon,
+			Manufacturer: device.Manufacturer,
+			Model:        device.Model,
+			Notes:        device.Notes,
+			Tags:         device.Tags,
+			CreatedAt:    device.CreatedAt,
+		})
+	}
+
+	users, err := t.users.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		u := User{ID: user.ID, Email: user.Email, Role: user.Role, CreatedAt: user.CreatedAt}
+		if withSecrets {
+			u.PasswordHash = user.PasswordHash
+			u.TotpEnabled = user.TotpEnabled
+			u.TotpSecret = user.TotpSecret
+		}
+		doc.Users = append(doc.Users, u)
+	}
+
+	for _, p := range t.kernel.ListPlugins() {
+		if p.State == types.StateRunning || p.State == types.StateStopped {
+			doc.Plugins = append(doc.Plugins, Plugin{ID: p.ID, Name: p.Name, Type: p.Type, State: p.State})
+		}
+	}
+
+	return doc, nil
+}
+
+// Import brings the instance to the document. Nothing is changed during a dry run, the result lists what
+// would be. Users are never deleted and currentUserID keeps its role, so an import cannot lock the admin out.
+func (t *Transfer) Import(doc *Document, mode Mode, dryRun bool, currentUserID string) (*ImportResult, error) {
+	result := &ImportResult{Mode: mode, DryRun: dryRun, Changes: []*Change{}, Warnings: []string{}}
+
+	areaIDs, err := t.planAreas(doc, mode, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.planDevices(doc, mode, areaIDs, result); err != nil {
+		return nil, err
+	}
+	if err := t.planUsers(doc, currentUserID, result); err != nil {
+		return nil, err
+	}
+	t.planPlugins(doc, result)
+
+	// Areas are deleted last, their devices may still be in them until they are updated
+	slices.SortStableFunc(result.Changes, func(a, b *Change) int {
+		return deleteOrder(a) - deleteOrder(b)
+	})
+
+	if dryRun {
+		return result, nil
+	}
+	for _, change := range result.Changes {
+		if err := change.apply(); err != nil {
+			change.Error = err.Error()
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+func deleteOrder(c *Change) int {
+	switch {
+	case c.Action != ActionDelete:
+		return 0
+	case c.Kind == "device":
+		return 1
+	}
+	return 2
+}
+
+// planAreas returns the id of each area of the document on this instance, an area with the same name is reused
+func (t *Transfer) planAreas(doc *Document, mode Mode, result *ImportResult) (map[string]string, error) {
+	areas := t.kernel.ListAreas()
+	existing := make(map[string]*types.Area)
+	byName := make(map[string]*types.Area)
+	for _, area := range areas {
+		existing[area.ID] = area
+		byName[strings.ToLower(area.Name)] = area
+	}
+
+	// Parents are planned before their children
+	areaIDs := make(map[string]string)
+	pending := slices.Clone(doc.Areas)
+	for len(pending) > 0 {
+		var next []Area
+		for _, area := range pending {
+			parentID := area.ParentID
+			if inDocument(doc.Areas, area.ParentID) {
+				mapped, ok := areaIDs[area.ParentID]
+				if !ok {
+					next = append(next, area)
+					continue
+				}
+				parentID = mapped
+			} else if parentID != "" && existing[parentID] == nil {
+				return nil, fmt.Errorf("area %s: parent %s not found", area.Name, area.ParentID)
+			}
+			areaIDs[area.ID] = t.planArea(area, parentID, existing, byName, result)
+		}
+		if len(next) == len(pending) {
+			return nil, fmt.Errorf("area %s: its parents form a cycle", next[0].Name)
+		}
+		pending = next
+	}
+
+	// A section missing from the document is left as it is, an empty one deletes everything
+	if mode == ModeReplace && doc.Areas != nil {
+		kept := make(map[string]bool)
+		for _, id := range areaIDs {
+			kept[id] = true
+		}
+		for _, area := range areas {
+			if !kept[area.ID] {
+				result.Changes = append(result.Changes, &Change{Kind: "area", ID: area.ID, Name: area.Name, Action: ActionDelete, apply: func() error {
+					return t.kernel.DeleteArea(area.ID)
+				}})
+			}
+		}
+	}
+	return areaIDs, nil
+}
+
+func inDocument(areas []Area, id string) bool {
+	return slices.ContainsFunc(areas, func(a Area) bool { return a.ID == id })
+}
+
+func (t *Transfer) planArea(area Area, parentID string, existing, byName map[string]*types.Area, result *ImportResult) string {
+	current := existing[area.ID]
+	if current == nil {
+		current = byName[strings.ToLower(strings.TrimSpace(area.Name))]
+	}
+
+	if current == nil {
+		created := &types.Area{ID: area.ID, Name: area.Name, ParentID: parentID, Icon: area.Icon, CreatedAt: time.Now()}
+		result.Changes = append(result.Changes, &Change{Kind: "area", ID: area.ID, Name: area.Name, Action: ActionCreate, apply: func() error {
+			return t.kernel.CreateArea(created)
+		}})
+		return area.ID
+	}
+
+	var fields []string
+	if current.Name != strings.TrimSpace(area.Name) {
+		fields = append(fields, "name")
+	}
+	if current.ParentID != parentID {
+		fields = append(fields, "parent_id")
+	}
+	if current.Icon != area.Icon {
+		fields = append(fields, "icon")
+	}
+	if len(fields) > 0 {
+		id := current.ID
+		result.Changes = append(result.Changes, &Change{Kind: "area", ID: id, Name: area.Name, Action: ActionUpdate, Fields: fields, apply: func() error {
+			_, err := t.kernel.UpdateArea(id, func(a *types.Area) error {
+				a.Name, a.ParentID, a.Icon = area.Name, parentID, area.Icon
+				return nil
+			})
+			return err
+		}})
+	}
+	return current.ID
+}
+
+// planDevices matches the devices of the document by id, then by address
+func (t *Transfer) planDevices(doc *Document, mode Mode, areaIDs map[string]string, result *ImportResult) error {
+	devices, err := t.kernel.ListDevices()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*types.Device)
+	byAddress := make(map[string]*types.Device)
+	for _, device := range devices {
+		byID[device.ID] = device
+		byAddress[string(device.AddressType)+"/"+device.Address] = device
+	}
+
+	var errs []error
+	kept := make(map[string]bool)
+	for _, device := range doc.Devices {
+		areaID := device.AreaID
+		if areaID != "" {
+			if mapped, ok := areaIDs[areaID]; ok {
+				areaID = mapped
+			} else if _, err := t.kernel.GetArea(areaID); err != nil {
+				errs = append(errs, fmt.Errorf("device %s: area %s not found", device.Name, device.AreaID))
+				continue
+			}
+		}
+
+		current := byID[device.ID]
+		if current == nil {
+			current = byAddress[string(device.AddressType)+"/"+device.Address]
+		}
+		if current == nil {
+			result.Changes = append(result.Changes, t.createDevice(device, areaID))
+			continue
+		}
+		kept[current.ID] = true
+		if change := t.updateDevice(current, device, areaID, mode); change != nil {
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if mode == ModeReplace && doc.Devices != nil {
+		for _, device := range devices {
+			if !kept[device.ID] {
+				id := device.ID
+				result.Changes = append(result.Changes, &Change{Kind: "device", ID: id, Name: device.Name, Action: ActionDelete, apply: func() error {
+					return t.kernel.UnregisterDevice(id)
+				}})
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Transfer) createDevice(device Device, areaID string) *Change {
+	created := types.NewDevice(device.Address, strings.TrimSpace(device.Name), slices.Clone(device.AdapterIDs), device.AddressType)
+	if device.ID != "" {
+		created.ID = device.ID
+	}
+	if !device.CreatedAt.IsZero() {
+		created.CreatedAt = device.CreatedAt
+	}
+	if created.AdapterIDs == nil {
+		created.AdapterIDs = []string{}
+	}
+	created.AreaID = areaID
+	created.Icon, created.Manufacturer, created.Model, created.Notes = device.Icon, device.Manufacturer, device.Model, device.Notes
+	if device.Tags != nil {
+		created.Tags = device.Tags
+	}
+
+	return &Change{Kind: "device", ID: created.ID, Name: created.Name, Action: ActionCreate, apply: func() error {
+		return t.kernel.RegisterDevice(created)
+	}}
+}
+
+// updateDevice returns nil when the device already matches. Adapters of the document are linked, the other
+// ones are only unlinked when replacing.
+func (t *Transfer) updateDevice(current *types.Device, device Device, areaID string, mode Mode) *Change {
+	tags := device.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	name := strings.TrimSpace(device.Name)
+
+	var fields []string
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{"address", current.Address != device.Address || current.AddressType != device.AddressType},
+		{"name", current.Name != name},
+		{"area_id", current.AreaID != areaID},
+		{"icon", current.Icon != device.Icon},
+		{"manufacturer", current.Manufacturer != device.Manufacturer},
+		{"model", current.Model != device.Model},
+		{"notes", current.Notes != device.Notes},
+		{"tags", !slices.Equal(current.Tags, tags)},
+	} {
+		if f.changed {
+			fields = append(fields, f.name)
+		}
+	}
+
+	var link, unlink []string
+	for _, adapterID := range device.AdapterIDs {
+		if !slices.Contains(current.AdapterIDs, adapterID) {
+			link = append(link, adapterID)
+		}
+	}
+	if mode == ModeReplace {
+		for _, adapterID := range current.AdapterIDs {
+			if !slices.Contains(device.AdapterIDs, adapterID) {
+				unlink = append(unlink, adapterID)
+			}
+		}
+	}
+	edited := len(fields) > 0
+	if len(link) > 0 || len(unlink) > 0 {
+		fields = append(fields, "adapter_ids")
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	id := current.ID
+	return &Change{Kind: "device", ID: id, Name: name, Action: ActionUpdate, Fields: fields, apply: func() error {
+		if edited {
+			_, err := t.kernel.UpdateDevice(id, func(d *types.Device) error {
+				d.Address, d.AddressType, d.Name, d.AreaID = device.Address, device.AddressType, name, areaID
+				d.Icon, d.Manufacturer, d.Model, d.Notes, d.Tags = device.Icon, device.Manufacturer, device.Model, device.Notes, tags
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		// Linking needs the adapter to be connected
+		var errs []error
+		for _, adapterID := range link {
+			errs = append(errs, t.kernel.LinkDeviceToAdapter(id, adapterID))
+		}
+		for _, adapterID := range unlink {
+			errs = append(errs, t.kernel.UnlinkDeviceFromAdapter(id, adapterID))
+		}
+		return errors.Join(errs...)
+	}}
+}
+
+// planUsers matches users by email
+func (t *Transfer) planUsers(doc *Document, currentUserID string, result *ImportResult) error {
+	for _, user := range doc.Users {
+		current, err := t.users.FindByEmail(user.Email)
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			created := &core.User{ID: user.ID, Email: user.Email, Role: user.Role, PasswordHash: user.PasswordHash}
+			// The id may be used by another user on this instance
+			if other, err := t.users.FindByID(user.ID); err != nil || other != nil || user.ID == "" {
+				created.ID = uuid.New().String()
+			}
+			if user.TotpEnabled && user.TotpSecret != "" {
+				created.TotpEnabled, created.TotpSecret = true, user.TotpSecret
+			}
+			result.Changes = append(result.Changes, &Change{Kind: "user", ID: created.ID, Name: user.Email, Action: ActionCreate, apply: func() error {
+				return t.users.Save(created)
+			}})
+			if user.PasswordHash == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("user %s has no password, an admin must create a password reset for them", user.Email))
+			}
+			continue
+		}
+
+		updated := *current
+		var fields []string
+		if current.Role != user.Role && current.ID != currentUserID {
+			updated.Role = user.Role
+			fields = append(fields, "role")
+		}
+		if user.PasswordHash != "" && current.PasswordHash != user.PasswordHash {
+			updated.PasswordHash = user.PasswordHash
+			fields = append(fields, "password_hash")
+		}
+		if user.TotpSecret != "" && (current.TotpSecret != user.TotpSecret || current.TotpEnabled != user.TotpEnabled) {
+			updated.TotpEnabled, updated.TotpSecret, updated.TotpLastStep = user.TotpEnabled, user.TotpSecret, 0
+			fields = append(fields, "totp")
+		}
+		if len(fields) > 0 {
+			result.Changes = append(result.Changes, &Change{Kind: "user", ID: current.ID, Name: user.Email, Action: ActionUpdate, Fields: fields, apply: func() error {
+				return t.users.Save(&updated)
+			}})
+		}
+	}
+	return nil
+}
+
+// planPlugins starts and stops the connected plugins
+func (t *Transfer) planPlugins(doc *Document, result *ImportResult) {
+	for _, p := range doc.Plugins {
+		current, err := t.kernel.GetPlugin(p.ID)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("plugin %s is not connected, its state is not applied", p.ID))
+			continue
+		}
+		if current.State == p.State {
+			continue
+		}
+
+		id, pluginType, state := p.ID, current.Type, p.State
+		result.Changes = append(result.Changes, &Change{Kind: "plugin", ID: id, Name: current.Name, Action: ActionUpdate, Fields: []string{"state"}, apply: func() error {
+			switch {
+			case pluginType == plugin.PluginAdapter && state == types.StateRunning:
+				return t.kernel.StartAdapter(id)
+			case pluginType == plugin.PluginAdapter:
+				return t.kernel.StopAdapter(id)
+			case state == types.StateRunning:
+				return t.kernel.StartScanner(id)
+			default:
+				return t.kernel.StopScanner(id)
+			}
+		}})
+	}
+}
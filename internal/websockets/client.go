@@ -4,18 +4,24 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/Bastien2203/go-home/internal/core"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true }, // TODO remove true for production
-}
+const (
+	writeWait       = 10 * time.Second
+	defaultPongWait = 60 * time.Second // a client must answer pings within this time
+	maxMessageSize  = 16 * 1024
+	sendBufferSize  = 256
+)
 
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan *Message
+	role core.Role
 }
 
 func (c *Client) readPump() {
@@ -24,52 +30,68 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	})
+
 	for {
 		_, p, err := c.conn.ReadMessage()
 		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				log.Printf("[Websocket] read error: %v", err)
+			}
 			break
 		}
 
 		var msg Message
 		if err := json.Unmarshal(p, &msg); err != nil {
-			log.Printf("JSON Error: %v", err)
+			c.hub.incoming <- clientMessage{client: c}
 			continue
 		}
-
-		switch msg.Action {
-		case "subscribe":
-			c.hub.Subscribe(c, msg.Topic)
-			// log.Printf("Client subscribed to : %s", msg.Topic)
-
-		case "publish":
-			c.hub.broadcast <- &msg
-		}
+		c.hub.incoming <- clientMessage{client: c, msg: &msg}
 	}
 }
 
 func (c *Client) writePump() {
-	defer c.conn.Close()
+	ticker := time.NewTicker(c.hub.pongWait * 9 / 10)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
 	for {
-		msg, ok := <-c.send
-		if !ok {
-			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-			return
-		}
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// Closed by the hub
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
 
-		if err := c.conn.WriteJSON(msg); err != nil {
-			return
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
 		}
 	}
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// ServeWs upgrades a request already authenticated, role is the role of the user (or of their api token)
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, role core.Role) {
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	client := &Client{hub: hub, conn: conn, send: make(chan *Message, 256)}
+	client := &Client{hub: hub, conn: conn, send: make(chan *Message, sendBufferSize), role: role}
 	client.hub.register <- client
 
 	go client.writePump()
@@ -2,25 +2,83 @@ package websockets
 
 import (
 	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
+// Hub routes messages between clients and topics. Run is the only goroutine changing topics and clients,
+// and the only one sending to or closing the send channel of a client, so a client is closed exactly once.
 type Hub struct {
-	topics map[Topic]map[*Client]bool
+	topics  map[Topic]map[*Client]bool
+	clients map[*Client]bool
 
 	register   chan *Client
 	unregister chan *Client
+	incoming   chan clientMessage
 	broadcast  chan *Message
 
+	upgrader websocket.Upgrader
+	pongWait time.Duration
+
+	// Current state of a topic, sent to clients when they subscribe
+	snapshot func(topic Topic) (any, error)
+	mirrors  []func(msg *Message)
+
+	// Guards topics and clients for readers outside of Run
 	mu sync.RWMutex
 }
 
-func NewHub() *Hub {
-	return &Hub{
+// A message read from a client, handled by Run. msg is nil when it was not valid json.
+type clientMessage struct {
+	client *Client
+	msg    *Message
+}
+
+// allowedOrigins are the origins (e.g. "https://home.example.com") of pages allowed to open a websocket,
+// besides the origin of the server itself. "*" allows any origin.
+func NewHub(allowedOrigins []string) *Hub {
+	h := &Hub{
 		topics:     make(map[Topic]map[*Client]bool),
+		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		incoming:   make(chan clientMessage, 100),
 		broadcast:  make(chan *Message, 100),
+		pongWait:   defaultPongWait,
+	}
+	h.upgrader = websocket.Upgrader{CheckOrigin: originChecker(allowedOrigins)}
+	return h
+}
+
+// Browsers send the session cookie with cross site websocket requests, the origin check prevents
+// any page the user visits from opening a websocket with their session
+func originChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowAll := slices.Contains(allowedOrigins, "*")
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			// Not a browser
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+			return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin)
+		})
 	}
 }
 
@@ -28,38 +86,161 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-
-			_ = client
+			h.mu.Lock()
+			h.clients[client] = true
+			h.mu.Unlock()
 
 		case client := <-h.unregister:
-			h.mu.Lock()
+			h.removeClient(client)
 
-			for topic := range h.topics {
-				if _, ok := h.topics[topic][client]; ok {
-					delete(h.topics[topic], client)
-					close(client.send)
-				}
-			}
-			h.mu.Unlock()
+		case in := <-h.incoming:
+			h.handle(in.client, in.msg)
 
 		case msg := <-h.broadcast:
-			h.mu.RLock()
-
-			if clients, ok := h.topics[msg.Topic]; ok {
-				for client := range clients {
-					select {
-					case client.send <- msg:
-					default:
-						close(client.send)
-						delete(h.topics[msg.Topic], client)
-					}
-				}
-			}
-			h.mu.RUnlock()
+			h.publish(msg)
 		}
 	}
 }
 
+func (h *Hub) handle(client *Client, msg *Message) {
+	h.mu.RLock()
+	connected := h.clients[client]
+	h.mu.RUnlock()
+	if !connected {
+		// Message read before the client was evicted
+		return
+	}
+	if msg == nil {
+		h.sendError(client, &Message{}, "invalid message")
+		return
+	}
+
+	switch msg.Action {
+	case ActionSubscribe:
+		if !CanSubscribe(client.role, msg.Topic) {
+			h.sendError(client, msg, "forbidden")
+			return
+		}
+		if err := h.subscribe(client, msg.Topic); err != nil {
+			h.sendError(client, msg, err.Error())
+		}
+
+	case ActionUnsubscribe:
+		h.unsubscribe(client, msg.Topic)
+
+	case ActionPublish:
+		if !CanPublish(client.role, msg.Topic) {
+			h.sendError(client, msg, "forbidden")
+			return
+		}
+		h.publish(&Message{Action: ActionBroadcast, Topic: msg.Topic, Message: msg.Message})
+
+	default:
+		h.sendError(client, msg, "unknown action")
+	}
+}
+
+// Snapshot returns the current state of the topic, nil if the topic has none
+func (h *Hub) Snapshot(topic Topic) (*Message, error) {
+	if h.snapshot == nil {
+		return nil, nil
+	}
+	payload, err := h.snapshot(topic)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Action: ActionSnapshot, Topic: topic, Message: jsonPayload}, nil
+}
+
+// subscribe adds the client to the topic and sends it the topic snapshot, if any. Broadcasts are handled by
+// the same goroutine, none can slip between the snapshot and the subscription.
+func (h *Hub) subscribe(client *Client, topic Topic) error {
+	snapshot, err := h.Snapshot(topic)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if _, ok := h.topics[topic]; !ok {
+		h.topics[topic] = make(map[*Client]bool)
+	}
+	h.topics[topic][client] = true
+	h.mu.Unlock()
+
+	if snapshot != nil {
+		h.send(client, snapshot)
+	}
+	return nil
+}
+
+func (h *Hub) unsubscribe(client *Client, topic Topic) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.topics[topic], client)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+func (h *Hub) publish(msg *Message) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.topics[msg.Topic]))
+	for client := range h.topics[msg.Topic] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.send(client, msg)
+	}
+	for _, mirror := range h.mirrors {
+		mirror(msg)
+	}
+}
+
+// Mirror passes every broadcast message to fn, from the hub goroutine. fn must not block.
+// It must be called before Run.
+func (h *Hub) Mirror(fn func(msg *Message)) {
+	h.mirrors = append(h.mirrors, fn)
+}
+
+// send never blocks the hub, a client too slow to empty its buffer is disconnected
+func (h *Hub) send(client *Client, msg *Message) {
+	select {
+	case client.send <- msg:
+	default:
+		log.Printf("[Websocket] evicting slow client")
+		h.removeClient(client)
+	}
+}
+
+func (h *Hub) sendError(client *Client, msg *Message, reason string) {
+	h.send(client, &Message{Action: ActionError, Topic: msg.Topic, Error: reason})
+}
+
+// removeClient can be called several times for the same client, its send channel is only closed once
+func (h *Hub) removeClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.clients[client] {
+		return
+	}
+	delete(h.clients, client)
+	for topic, clients := range h.topics {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+	close(client.send)
+}
+
 func (h *Hub) Broadcast(topic Topic, payload any) error {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
@@ -67,7 +248,7 @@ func (h *Hub) Broadcast(topic Topic, payload any) error {
 	}
 
 	msg := &Message{
-		Action:  "broadcast",
+		Action:  ActionBroadcast,
 		Topic:   topic,
 		Message: jsonPayload,
 	}
@@ -77,12 +258,8 @@ func (h *Hub) Broadcast(topic Topic, payload any) error {
 	return nil
 }
 
-func (h *Hub) Subscribe(client *Client, topic Topic) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if _, ok := h.topics[topic]; !ok {
-		h.topics[topic] = make(map[*Client]bool)
-	}
-	h.topics[topic][client] = true
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
 }
@@ -0,0 +1,219 @@
+package websockets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/gorilla/websocket"
+)
+
+func newTestServer(t *testing.T, hub *Hub, role core.Role) *httptest.Server {
+	go hub.Run()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, w, r, role)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendAction(t *testing.T, conn *websocket.Conn, action string, topic Topic) {
+	if err := conn.WriteJSON(Message{Action: action, Topic: topic}); err != nil {
+		t.Fatalf("Failed to write %v", err)
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) *Message {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Failed to read %v", err)
+	}
+	return &msg
+}
+
+// eventually polls cond, the hub handles messages asynchronously
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func subscriberCount(hub *Hub, topic Topic) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.topics[topic])
+}
+
+func TestSubscribeBroadcastUnsubscribe(t *testing.T) {
+	hub := NewHub(nil)
+	conn := dial(t, newTestServer(t, hub, core.RoleViewer))
+
+	sendAction(t, conn, ActionSubscribe, TopicDeviceState)
+	eventually(t, func() bool { return subscriberCount(hub, TopicDeviceState) == 1 }, "Client not subscribed")
+
+	hub.Broadcast(TopicDeviceState, map[string]int{"value": 1})
+	msg := readMessage(t, conn)
+	if msg.Action != ActionBroadcast || msg.Topic != TopicDeviceState || string(msg.Message) != `{"value":1}` {
+		t.Fatalf("Unexpected message %+v", msg)
+	}
+
+	sendAction(t, conn, ActionUnsubscribe, TopicDeviceState)
+	eventually(t, func() bool { return subscriberCount(hub, TopicDeviceState) == 0 }, "Client still subscribed")
+
+	hub.Broadcast(TopicDeviceState, map[string]int{"value": 2})
+	sendAction(t, conn, ActionSubscribe, TopicPluginState)
+	eventually(t, func() bool { return subscriberCount(hub, TopicPluginState) == 1 }, "Client not subscribed")
+	hub.Broadcast(TopicPluginState, "after")
+
+	// The first message received after unsubscribing must be the one of the other topic
+	msg = readMessage(t, conn)
+	if msg.Topic != TopicPluginState {
+		t.Fatalf("Received a message after unsubscribing %+v", msg)
+	}
+}
+
+func TestSnapshotBeforeBroadcasts(t *testing.T) {
+	hub := NewHub(nil)
+	hub.snapshot = func(topic Topic) (any, error) {
+		if topic == TopicDeviceState {
+			return []string{"current"}, nil
+		}
+		return nil, nil
+	}
+	conn := dial(t, newTestServer(t, hub, core.RoleViewer))
+
+	sendAction(t, conn, ActionSubscribe, TopicDeviceState)
+	hub.Broadcast(TopicDeviceState, "update")
+
+	msg := readMessage(t, conn)
+	if msg.Action != ActionSnapshot || string(msg.Message) != `["current"]` {
+		t.Fatalf("Expected the snapshot first, got %+v", msg)
+	}
+}
+
+func TestForbiddenActions(t *testing.T) {
+	hub := NewHub(nil)
+	conn := dial(t, newTestServer(t, hub, core.RoleViewer))
+
+	sendAction(t, conn, ActionSubscribe, TopicBluetoothDevice)
+	if msg := readMessage(t, conn); msg.Action != ActionError || msg.Topic != TopicBluetoothDevice {
+		t.Fatalf("Expected an error, got %+v", msg)
+	}
+
+	sendAction(t, conn, ActionPublish, TopicDeviceState)
+	if msg := readMessage(t, conn); msg.Action != ActionError {
+		t.Fatalf("Expected an error, got %+v", msg)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if msg := readMessage(t, conn); msg.Action != ActionError || msg.Error != "invalid message" {
+		t.Fatalf("Expected an error, got %+v", msg)
+	}
+
+	if subscriberCount(hub, TopicBluetoothDevice) != 0 {
+		t.Fatalf("Viewer subscribed to a member topic")
+	}
+}
+
+// A client in several topics used to have its send channel closed once per topic
+func TestDisconnectWithSeveralTopics(t *testing.T) {
+	hub := NewHub(nil)
+	conn := dial(t, newTestServer(t, hub, core.RoleViewer))
+
+	for _, topic := range []Topic{TopicDeviceState, TopicPluginState, DeviceTopic("a")} {
+		sendAction(t, conn, ActionSubscribe, topic)
+	}
+	eventually(t, func() bool { return subscriberCount(hub, DeviceTopic("a")) == 1 }, "Client not subscribed")
+
+	conn.Close()
+	eventually(t, func() bool { return hub.ClientCount() == 0 }, "Client not removed")
+	if subscriberCount(hub, TopicDeviceState)+subscriberCount(hub, TopicPluginState) != 0 {
+		t.Fatalf("Client still in topics")
+	}
+}
+
+func TestSlowClientEvicted(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+
+	// Nothing reads the send channel of this client
+	slow := &Client{hub: hub, send: make(chan *Message, 2), role: core.RoleViewer}
+	hub.register <- slow
+	hub.incoming <- clientMessage{client: slow, msg: &Message{Action: ActionSubscribe, Topic: TopicDeviceState}}
+	hub.incoming <- clientMessage{client: slow, msg: &Message{Action: ActionSubscribe, Topic: TopicPluginState}}
+	eventually(t, func() bool { return subscriberCount(hub, TopicPluginState) == 1 }, "Client not subscribed")
+
+	for range 5 {
+		hub.Broadcast(TopicDeviceState, "update")
+		hub.Broadcast(TopicPluginState, "update")
+	}
+	eventually(t, func() bool { return hub.ClientCount() == 0 }, "Slow client not evicted")
+
+	// The pump of an evicted client unregisters it again, it must not close the channel twice
+	hub.unregister <- slow
+	hub.Broadcast(TopicDeviceState, "update")
+
+	received := 0
+	for range slow.send {
+		received++
+	}
+	if received != 2 {
+		t.Fatalf("Expected the 2 buffered messages, got %d", received)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	hub := NewHub(nil)
+	conn := dial(t, newTestServer(t, hub, core.RoleAdmin))
+	eventually(t, func() bool { return hub.ClientCount() == 1 }, "Client not registered")
+
+	payload, _ := json.Marshal(strings.Repeat("a", maxMessageSize))
+	conn.WriteJSON(Message{Action: ActionPublish, Topic: TopicDeviceState, Message: payload})
+
+	eventually(t, func() bool { return hub.ClientCount() == 0 }, "Client sending a too large message not disconnected")
+}
+
+func TestDeadConnectionClosed(t *testing.T) {
+	hub := NewHub(nil)
+	hub.pongWait = 500 * time.Millisecond
+	server := newTestServer(t, hub, core.RoleViewer)
+
+	// Pings are answered while the client reads
+	alive := dial(t, server)
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// This one never reads, so never answers pings
+	dial(t, server)
+
+	eventually(t, func() bool { return hub.ClientCount() == 2 }, "Clients not registered")
+	eventually(t, func() bool { return hub.ClientCount() == 1 }, "Dead connection not closed")
+
+	time.Sleep(3 * hub.pongWait)
+	if hub.ClientCount() != 1 {
+		t.Fatalf("Live connection closed")
+	}
+}
@@ -2,8 +2,21 @@ package websockets
 
 import "encoding/json"
 
+const (
+	// Sent by clients
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionPublish     = "publish"
+
+	// Sent by the server
+	ActionBroadcast = "broadcast"
+	ActionSnapshot  = "snapshot"
+	ActionError     = "error"
+)
+
 type Message struct {
 	Action  string          `json:"action"`
 	Topic   Topic           `json:"topic"`
-	Message json.RawMessage `json:"message"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Error   string          `json:"error,omitempty"`
 }
@@ -0,0 +1,106 @@
+package websockets
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+type DeviceAvailabilityMessage struct {
+	DeviceID    string    `json:"device_id"`
+	DeviceName  string    `json:"name"`
+	Available   bool      `json:"available"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+func availabilityMessage(device *types.Device) DeviceAvailabilityMessage {
+	return DeviceAvailabilityMessage{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		Available:   device.Available,
+		LastUpdated: device.LastUpdated,
+	}
+}
+
+// StreamKernel broadcasts the kernel events on their topics and sends the current state to new subscribers.
+// It must be called before Run.
+func (h *Hub) StreamKernel(kernel *core.Kernel) {
+	h.snapshot = func(topic Topic) (any, error) {
+		return kernelSnapshot(kernel, topic)
+	}
+
+	kernel.OnDeviceStateUpdate(func(update types.DeviceStateUpdate) {
+		h.broadcastLogged(TopicDeviceState, update)
+	})
+
+	kernel.OnDeviceEvent(func(event core.DeviceEvent) {
+		switch event.Type {
+		case core.DeviceRegistered:
+			h.broadcastLogged(TopicDeviceRegistered, event.Device)
+		case core.DeviceChanged:
+			h.broadcastLogged(TopicDeviceChanged, event.Device)
+		case core.DeviceRemoved:
+			h.broadcastLogged(TopicDeviceRemoved, event.Device)
+			return
+		case core.DeviceAvailability:
+			h.broadcastLogged(TopicDeviceAvailability, availabilityMessage(event.Device))
+		}
+		h.broadcastLogged(DeviceTopic(event.Device.ID), event.Device)
+	})
+
+	kernel.OnPluginEvent(func(event core.PluginEvent) {
+		h.broadcastLogged(TopicPluginState, event)
+	})
+}
+
+func (h *Hub) broadcastLogged(topic Topic, payload any) {
+	if err := h.Broadcast(topic, payload); err != nil {
+		log.Printf("[Websocket] error broadcasting on %s : %v", topic, err)
+	}
+}
+
+// kernelSnapshot returns the state a client needs before the first message of a topic, nil for event only topics
+func kernelSnapshot(kernel *core.Kernel, topic Topic) (any, error) {
+	switch topic {
+	case TopicDeviceState:
+		return listDevices(kernel)
+
+	case TopicDeviceAvailability:
+		devices, err := listDevices(kernel)
+		if err != nil {
+			return nil, err
+		}
+		availability := make([]DeviceAvailabilityMessage, 0, len(devices))
+		for _, device := range devices {
+			availability = append(availability, availabilityMessage(device))
+		}
+		return availability, nil
+
+	case TopicPluginState:
+		return kernel.ListPlugins(), nil
+	}
+
+	if deviceID, ok := strings.CutPrefix(string(topic), string(TopicDevicePrefix)); ok {
+		device, err := kernel.GetDevice(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if device == nil {
+			return nil, fmt.Errorf("device not found: %s", deviceID)
+		}
+		return device, nil
+	}
+	return nil, nil
+}
+
+func listDevices(kernel *core.Kernel) ([]*types.Device, error) {
+	devices, err := kernel.ListDevices()
+	if devices == nil {
+		devices = []*types.Device{}
+	}
+	return devices, err
+}
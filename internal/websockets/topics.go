@@ -1,7 +1,80 @@
 package websockets
 
+import (
+	"slices"
+	"strings"
+
+	"github.com/Bastien2203/go-home/internal/core"
+)
+
 type Topic string
 
 const (
-	TopicBluetoothDevice Topic = "topic_bluetooth_device"
+	TopicBluetoothDevice    Topic = "topic_bluetooth_device"
+	TopicDeviceState        Topic = "topic_device_state"
+	TopicDeviceRegistered   Topic = "topic_device_registered"
+	TopicDeviceRemoved      Topic = "topic_device_removed"
+	TopicDeviceChanged      Topic = "topic_device_changed"
+	TopicDeviceAvailability Topic = "topic_device_availability"
+	TopicPluginState        Topic = "topic_plugin_state"
+
+	// Family of the per device topics, "device:{id}" streams the whole device after each change
+	TopicDevicePrefix Topic = "device:"
 )
+
+func DeviceTopic(deviceID string) Topic {
+	return TopicDevicePrefix + Topic(deviceID)
+}
+
+// TopicRule sets the minimum role to use a topic, topics without rule are refused
+type TopicRule struct {
+	Subscribe core.Role
+	Publish   core.Role // empty for server only topics, clients cannot publish to them
+}
+
+// Rules of topic families like "device:{id}" are registered under their prefix, "device:"
+var topicRules = map[Topic]TopicRule{
+	// Nearby devices are only useful to add devices, which requires the member role
+	TopicBluetoothDevice: {Subscribe: core.RoleMember},
+
+	TopicDeviceState:        {Subscribe: core.RoleViewer},
+	TopicDeviceRegistered:   {Subscribe: core.RoleViewer},
+	TopicDeviceRemoved:      {Subscribe: core.RoleViewer},
+	TopicDeviceChanged:      {Subscribe: core.RoleViewer},
+	TopicDeviceAvailability: {Subscribe: core.RoleViewer},
+	TopicPluginState:        {Subscribe: core.RoleViewer},
+	TopicDevicePrefix:       {Subscribe: core.RoleViewer},
+}
+
+// Topics returns the topics with a fixed name, sorted, topic families excluded
+func Topics() []Topic {
+	topics := make([]Topic, 0, len(topicRules))
+	for topic := range topicRules {
+		if !strings.HasSuffix(string(topic), ":") {
+			topics = append(topics, topic)
+		}
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+func ruleFor(topic Topic) (TopicRule, bool) {
+	if rule, ok := topicRules[topic]; ok {
+		return rule, true
+	}
+	if prefix, _, found := strings.Cut(string(topic), ":"); found {
+		rule, ok := topicRules[Topic(prefix+":")]
+		return rule, ok
+	}
+	return TopicRule{}, false
+}
+
+func CanSubscribe(role core.Role, topic Topic) bool {
+	rule, ok := ruleFor(topic)
+	return ok && role.Allows(rule.Subscribe)
+}
+
+func CanPublish(role core.Role, topic Topic) bool {
+	rule, ok := ruleFor(topic)
+	return ok && rule.Publish != "" && role.Allows(rule.Publish)
+}
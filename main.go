@@ -2,15 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
 
+	"github.com/Bastien2203/go-home/internal/broker"
 	"github.com/Bastien2203/go-home/internal/core"
+	"github.com/Bastien2203/go-home/internal/declarative"
+	"github.com/Bastien2203/go-home/internal/metrics"
 	"github.com/Bastien2203/go-home/internal/repository"
 	"github.com/Bastien2203/go-home/internal/server"
+	"github.com/Bastien2203/go-home/internal/sse"
+	"github.com/Bastien2203/go-home/internal/transfer"
 	"github.com/Bastien2203/go-home/internal/websockets"
 	"github.com/Bastien2203/go-home/shared/config"
 	"github.com/Bastien2203/go-home/shared/events"
@@ -20,38 +31,101 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	migrate := flag.String("migrate", "", `"status" prints the database migrations, "up" applies the pending ones, then exits`)
+	flag.Parse()
+
 	cfg := config.LoadFromEnv(ctx)
 
-	eventBus, err := events.NewEventBus(cfg.BrokerUrl, "gohome-core")
-	if err != nil {
-		log.Fatalf("Failed to start event bus : %v", err)
+	if *migrate != "" {
+		if err := runMigrateCommand(*migrate, storageOptions(cfg)); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	defer eventBus.Close()
-
-	db, err := repository.SetupSQLiteDB(cfg.SqliteDbPath)
+	store, err := repository.OpenStore(storageOptions(cfg))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer store.Close()
+
+	if cfg.EmbeddedBroker {
+		embeddedBroker, err := broker.Start(broker.Options{
+			Address:        cfg.EmbeddedBrokerAddress,
+			Username:       cfg.EmbeddedBrokerUsername,
+			Password:       cfg.EmbeddedBrokerPassword,
+			PersistenceDir: cfg.EmbeddedBrokerDataDir,
+			CertFile:       cfg.EmbeddedBrokerCertFile,
+			KeyFile:        cfg.EmbeddedBrokerKeyFile,
+			Credentials:    store.PluginCredentials,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start the embedded broker: %v", err)
+		}
+		defer embeddedBroker.Close()
+		if cfg.BrokerUrl == "" {
+			cfg.BrokerUrl = embeddedBroker.URL()
+			cfg.BrokerUsername, cfg.BrokerPassword = cfg.EmbeddedBrokerUsername, cfg.EmbeddedBrokerPassword
+			if cfg.EmbeddedBrokerCertFile != "" && cfg.BrokerCAFile == "" {
+				cfg.BrokerCAFile = cfg.EmbeddedBrokerCertFile
+			}
+		}
+	}
 
-	deviceRepo, err := repository.NewDeviceRepository(db)
+	eventBus, err := events.NewEventBus(events.Transport(cfg.EventBus), cfg.BrokerConnection, "gohome-core")
 	if err != nil {
-		log.Fatalf("Error init sqlite device repo: %v", err)
+		log.Fatalf("Failed to start event bus : %v", err)
+	}
+	if cfg.EventBus == string(events.TransportMemory) {
+		log.Println("[EventBus] In-memory event bus, plugins running in their own process cannot connect")
 	}
 
-	userRepo, err := repository.NewUserRepository(db)
-	if err != nil {
-		log.Fatalf("Error init sqlite users repo: %v", err)
+	defer eventBus.Close()
+
+	// PostgreSQL databases are backed up with pg_dump
+	var backups *repository.Backups
+	if store.DB.Dialect() == repository.DialectSQLite {
+		backupDir := cfg.BackupDir
+		if backupDir == "" {
+			backupDir = filepath.Join(filepath.Dir(cfg.SqliteDbPath), "backups")
+		}
+		backups = repository.NewBackups(store.DB, backupDir, cfg.BackupInterval, cfg.BackupRetention)
+		go backups.Run(ctx)
 	}
-	kernel, err := core.NewKernel(eventBus, deviceRepo)
+
+	kernel, err := core.NewKernel(eventBus, store.Devices, store.Areas)
 	if err != nil {
 		log.Fatalf("Failed to create kernel: %v", err)
 	}
 
-	wsHub := websockets.NewHub()
+	// An invalid gohome.yaml stops the startup, later changes are only applied when valid
+	reconciler := declarative.NewReconciler(cfg.ConfigFile, kernel, transfer.NewTransfer(kernel, store.Users))
+	if _, err := reconciler.Apply(); errors.Is(err, os.ErrNotExist) {
+		log.Printf("[Config] No %s, devices are configured from the UI", reconciler.Path())
+	} else if err != nil {
+		log.Fatalf("[Config] Invalid %s:\n%s", reconciler.Path(), declarative.FormatError(err))
+	}
+	reconciler.Start(ctx, cfg.ConfigWatch)
+
+	wsOrigins := cfg.WsAllowedOrigins
+	if len(wsOrigins) == 0 && cfg.AppEnv == config.Dev {
+		// The vite dev server runs on another port
+		wsOrigins = []string{"*"}
+	}
+	wsHub := websockets.NewHub(wsOrigins)
+	wsHub.StreamKernel(kernel)
+	sseBroker := sse.NewBroker(wsHub, cfg.SseBufferSize)
 	go wsHub.Run()
-	apiServer := server.NewServer(kernel, cfg.ApiPort, cfg.SessionSecret, cfg.AppEnv, wsHub, userRepo)
+
+	kernel.WatchAvailability(ctx, cfg.DeviceAvailabilityTimeout)
+	kernel.PersistLiveState(ctx, cfg.DeviceStateSaveInterval)
+
+	var m *metrics.Metrics
+	if cfg.MetricsEnabled {
+		m = metrics.New(eventBus, kernel, wsHub)
+	}
+
+	apiServer := server.NewServer(kernel, cfg, wsHub, sseBroker, store, backups, m)
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.Printf("Server error: %v", err)
@@ -74,5 +148,70 @@ func main() {
 	fmt.Println("Stopping adapters...")
 	kernel.StopAdapters()
 
+	if err := kernel.FlushLiveState(); err != nil {
+		log.Printf("[Kernel] Failed to save device states: %v", err)
+	}
+
 	fmt.Println("\nShutting down...")
 }
+
+func storageOptions(cfg *config.Config) repository.StorageOptions {
+	return repository.StorageOptions{
+		Driver:     repository.Dialect(cfg.StorageDriver),
+		SQLitePath: cfg.SqliteDbPath,
+		SQLite: repository.SQLiteOptions{
+			JournalMode:     cfg.SqliteJournalMode,
+			Synchronous:     cfg.SqliteSynchronous,
+			BusyTimeout:     cfg.SqliteBusyTimeout,
+			ForeignKeys:     cfg.SqliteForeignKeys,
+			MaxOpenConns:    cfg.SqliteMaxOpenConns,
+			MaxIdleConns:    cfg.SqliteMaxIdleConns,
+			ConnMaxIdleTime: cfg.SqliteConnMaxIdleTime,
+		},
+		PostgresURL: cfg.DatabaseUrl,
+		Postgres: repository.PostgresOptions{
+			MaxOpenConns:    cfg.PostgresMaxOpenConns,
+			MaxIdleConns:    cfg.PostgresMaxIdleConns,
+			ConnMaxIdleTime: cfg.PostgresConnMaxIdleTime,
+		},
+	}
+}
+
+func runMigrateCommand(command string, options repository.StorageOptions) error {
+	switch command {
+	case "up":
+		store, err := repository.OpenStore(options)
+		if err != nil {
+			return err
+		}
+		return store.Close()
+
+	case "status":
+		db, err := repository.OpenDB(options)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		statuses, err := repository.MigrationStatuses(db)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(statuses, func(s repository.MigrationStatus) bool { return s.AppliedAt != nil }) {
+			fmt.Println("No migrations applied")
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected status or up", command)
+	}
+}
@@ -25,6 +25,10 @@ func LoadFromEnv(ctx context.Context) *Config {
 	if err := envconfig.Process(ctx, cfg); err != nil {
 		log.Fatalf("%+v\n", err)
 	}
+	// Metrics carry device and plugin names
+	if cfg.AppEnv == Production && cfg.MetricsEnabled && cfg.MetricsToken == "" {
+		log.Fatal("METRICS_TOKEN is required with METRICS_ENABLED in production")
+	}
 	return cfg
 }
 
@@ -43,6 +47,9 @@ func LoadFromEnvPlugin(ctx context.Context) *PluginConfig {
 	if err := envconfig.Process(ctx, cfg); err != nil {
 		log.Fatalf("%+v\n", err)
 	}
+	if cfg.BrokerUrl == "" {
+		log.Fatal("BROKER_URL is required")
+	}
 	return cfg
 }
 
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Delivery is how the events of a type travel through the broker
+type Delivery struct {
+	QoS      byte // 0 at most once, 1 at least once
+	Retained bool // the broker keeps the last event of the topic and hands it to new subscribers
+}
+
+// DeliveryOf gives the delivery of an event type, a subscription filter gets the delivery of the topics it
+// matches. Commands, acks and lifecycle events are delivered at least once, a lost one would make the core
+// wait for an ack until its timeout.
+func DeliveryOf(eventType EventType) Delivery {
+	topic := string(eventType)
+	switch {
+	case strings.HasPrefix(topic, string(PluginState(""))):
+		return Delivery{QoS: 1, Retained: true}
+	case eventType == ParsedDataReceived, eventType == BluetoothDeviceFound, strings.HasPrefix(topic, string(UpdateDataForAdapter(""))):
+		// Streams of values, a lost one is replaced by the next
+		return Delivery{QoS: 0}
+	}
+	return Delivery{QoS: 1}
+}
+
+// encodePayload encodes the payload in JSON. The nil payload of a retained event type is empty instead,
+// it clears the retained event of the topic.
+func encodePayload(event Event) ([]byte, error) {
+	if event.Payload == nil && DeliveryOf(event.Type).Retained {
+		return []byte{}, nil
+	}
+	return json.Marshal(event.Payload)
+}
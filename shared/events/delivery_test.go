@@ -0,0 +1,25 @@
+package events
+
+import "testing"
+
+func TestDeliveryOf(t *testing.T) {
+	tests := []struct {
+		eventType EventType
+		delivery  Delivery
+	}{
+		{ParsedDataReceived, Delivery{QoS: 0}},
+		{BluetoothDeviceFound, Delivery{QoS: 0}},
+		{UpdateDataForAdapter("homekit"), Delivery{QoS: 0}},
+		{PluginAck, Delivery{QoS: 1}},
+		{PluginStart("homekit"), Delivery{QoS: 1}},
+		{RegisterDeviceForAdapter("homekit"), Delivery{QoS: 1}},
+		{PluginState("homekit"), Delivery{QoS: 1, Retained: true}},
+		{PluginState("+"), Delivery{QoS: 1, Retained: true}},
+		{"zigbee2mqtt/#", Delivery{QoS: 1}},
+	}
+	for _, test := range tests {
+		if delivery := DeliveryOf(test.eventType); delivery != test.delivery {
+			t.Fatalf("DeliveryOf(%s) is %+v, expected %+v", test.eventType, delivery, test.delivery)
+		}
+	}
+}
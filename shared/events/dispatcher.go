@@ -0,0 +1,60 @@
+package events
+
+import "sync"
+
+// dispatcher runs the deliveries of a bus on its own goroutine, one at a time in the order they were pushed.
+// The transport never waits for a handler, so a handler can publish and wait for the broker.
+type dispatcher struct {
+	mu      sync.Mutex
+	pending *sync.Cond
+	queue   []func()
+	closed  bool
+	done    chan struct{}
+}
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{done: make(chan struct{})}
+	d.pending = sync.NewCond(&d.mu)
+	go d.run()
+	return d
+}
+
+// push queues a delivery, it is dropped once the dispatcher is closed
+func (d *dispatcher) push(delivery func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.queue = append(d.queue, delivery)
+	d.pending.Signal()
+	return true
+}
+
+func (d *dispatcher) run() {
+	defer close(d.done)
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			d.pending.Wait()
+		}
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		delivery := d.queue[0]
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+
+		delivery()
+	}
+}
+
+// close runs the deliveries already pushed then stops
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.pending.Signal()
+	d.mu.Unlock()
+	<-d.done
+}
@@ -2,13 +2,13 @@ package events
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-
 	"log"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/Bastien2203/go-home/shared/config"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 type EventType string
@@ -18,7 +18,7 @@ const (
 	BluetoothDeviceFound EventType = "gohome/bluetooth/found"
 	PluginConnected      EventType = "gohome/plugin/connected"
 	PluginDisconnected   EventType = "gohome/plugin/disconnected"
-	PluginStateChanged   EventType = "gohome/plugin/newstate"
+	PluginStateChanged   EventType = "gohome/plugin/newstate" // sent by plugins built before PluginState
 	PluginAck            EventType = "gohome/plugin/ack"
 	PluginNegativeAck    EventType = "gohome/plugin/negative-ack"
 )
@@ -31,6 +31,12 @@ func PluginStart(id string) EventType {
 	return EventType(fmt.Sprintf("gohome/plugin/start/%s", id))
 }
 
+// Retained with the last state of the plugin, a subscriber learns the running plugins as soon as it subscribes.
+// The plugin clears it when it disconnects, the broker with its will when it crashes.
+func PluginState(id string) EventType {
+	return EventType(fmt.Sprintf("gohome/plugin/state/%s", id))
+}
+
 func RegisterDeviceForAdapter(id string) EventType {
 	return EventType(fmt.Sprintf("gohome/device/register/%s", id))
 }
@@ -43,51 +49,59 @@ func UpdateDataForAdapter(id string) EventType {
 	return EventType(fmt.Sprintf("gohome/device/updated/%s", id))
 }
 
+// Sent with the whole device when its name, address or metadata changed
+func UpdateDeviceForAdapter(id string) EventType {
+	return EventType(fmt.Sprintf("gohome/device/changed/%s", id))
+}
+
 type Event struct {
 	Type    EventType
 	Payload any
 }
 
-type EventBus struct {
-	client mqtt.Client
-	debug  bool
+// EventBus carries events between the core and the plugins. Payloads travel as JSON whatever the transport,
+// handlers of a bus are called one at a time in the order the events were published. The delivery of each event
+// type is given by DeliveryOf.
+type EventBus interface {
+	Publish(event Event) error
+	// SubscribeRaw calls handler with the topic and the JSON payload of each event of the type, MQTT wildcards
+	// are allowed. The empty payloads of the cleared retained events are passed too.
+	SubscribeRaw(eventType EventType, handler func(topic EventType, payload []byte)) error
+	Stats() map[EventType]TopicStats
+	Close()
 }
 
-func NewEventBus(brokerURL string, clientID string) (*EventBus, error) {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
-	opts.SetClientID(clientID)
-	opts.SetKeepAlive(60 * time.Second)
-	opts.SetPingTimeout(1 * time.Second)
+type Transport string
 
-	opts.SetOnConnectHandler(func(c mqtt.Client) {
-		log.Println("[EventBus] connected to the mqtt broker")
-	})
-	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
-		log.Println("[EventBus] connection to mqtt broker lost")
-	})
-
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
-	}
-	return &EventBus{client: client, debug: config.IsDebug()}, nil
-}
-
-func (eb *EventBus) subscribeRaw(eventType EventType, handler func(payload []byte)) error {
-	topic := string(eventType)
+const (
+	TransportMQTT   Transport = "mqtt"   // through a broker, plugins run in their own process
+	TransportMemory Transport = "memory" // inside the process, for a core without external plugins and for tests
+)
 
-	mqttHandler := func(client mqtt.Client, msg mqtt.Message) {
-		handler(msg.Payload())
+// NewEventBus opens the bus of the transport, the broker connection and the options are only used by MQTT
+func NewEventBus(transport Transport, conn config.BrokerConnection, clientID string, options ...MQTTOption) (EventBus, error) {
+	switch transport {
+	case TransportMQTT:
+		if conn.BrokerUrl == "" {
+			return nil, errors.New("a broker url is required with the mqtt event bus")
+		}
+		eb, err := NewMQTTEventBus(conn, clientID, options...)
+		if err != nil {
+			return nil, err
+		}
+		return eb, nil
+	case TransportMemory:
+		return NewMemoryEventBus(), nil
 	}
-
-	token := eb.client.Subscribe(topic, 0, mqttHandler)
-	token.Wait()
-	return token.Error()
+	return nil, fmt.Errorf("unknown event bus %q, expected %s or %s", transport, TransportMQTT, TransportMemory)
 }
 
-func Subscribe[T any](eb *EventBus, eventType EventType, handler func(T)) error {
-	return eb.subscribeRaw(eventType, func(rawPayload []byte) {
+func Subscribe[T any](eb EventBus, eventType EventType, handler func(T)) error {
+	return eb.SubscribeRaw(eventType, func(_ EventType, rawPayload []byte) {
+		if len(rawPayload) == 0 {
+			// A retained event was cleared
+			return
+		}
 		var target T
 
 		err := json.Unmarshal(rawPayload, &target)
@@ -100,22 +114,65 @@ func Subscribe[T any](eb *EventBus, eventType EventType, handler func(T)) error
 	})
 }
 
-func (eb *EventBus) Publish(event Event) error {
-	payloadBytes, err := json.Marshal(event.Payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
-	}
+// Number of messages published and received per topic since startup
+type TopicStats struct {
+	Published uint64 `json:"published"`
+	Received  uint64 `json:"received"`
+}
+
+// topicCounters is shared by the transports
+type topicCounters struct {
+	mu    sync.Mutex
+	stats map[EventType]*TopicStats
+}
+
+func (c *topicCounters) countPublished(eventType EventType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topicStats(eventType).Published++
+}
 
-	if eb.debug {
-		log.Printf("[EventBus] Publish event (%s) : %s\n", event.Type, string(payloadBytes))
+func (c *topicCounters) countReceived(eventType EventType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topicStats(eventType).Received++
+}
+
+// must be called with mu held
+func (c *topicCounters) topicStats(eventType EventType) *TopicStats {
+	if c.stats == nil {
+		c.stats = make(map[EventType]*TopicStats)
 	}
+	stats, ok := c.stats[eventType]
+	if !ok {
+		stats = &TopicStats{}
+		c.stats[eventType] = stats
+	}
+	return stats
+}
 
-	token := eb.client.Publish(string(event.Type), 0, false, payloadBytes)
-	token.Wait()
+func (c *topicCounters) Stats() map[EventType]TopicStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return token.Error()
+	stats := make(map[EventType]TopicStats, len(c.stats))
+	for t, s := range c.stats {
+		stats[t] = *s
+	}
+	return stats
 }
 
-func (eb *EventBus) Close() {
-	eb.client.Disconnect(250)
+// topicMatches tells if a topic matches an MQTT subscription filter, with + for one level and # for the rest
+func topicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
 }
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Bastien2203/go-home/shared/config"
+)
+
+var ErrClosed = errors.New("event bus closed")
+
+// MemoryEventBus delivers events inside the process, like MQTT the handlers run on their own goroutine so
+// a handler can publish, payloads are copied through JSON so handlers cannot share memory, and retained
+// events are handed to the later subscribers
+type MemoryEventBus struct {
+	topicCounters
+	debug      bool
+	dispatcher *dispatcher
+
+	mu            sync.Mutex
+	subscriptions []memorySubscription
+	retained      map[EventType][]byte
+	closed        bool
+}
+
+type memorySubscription struct {
+	filter  string
+	handler func(topic EventType, payload []byte)
+}
+
+func NewMemoryEventBus() *MemoryEventBus {
+	return &MemoryEventBus{debug: config.IsDebug(), dispatcher: newDispatcher(), retained: make(map[EventType][]byte)}
+}
+
+func (eb *MemoryEventBus) SubscribeRaw(eventType EventType, handler func(topic EventType, payload []byte)) error {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.closed {
+		return ErrClosed
+	}
+	eb.subscriptions = append(eb.subscriptions, memorySubscription{filter: string(eventType), handler: handler})
+	for topic, payload := range eb.retained {
+		if topicMatches(string(eventType), string(topic)) {
+			eb.dispatcher.push(func() {
+				eb.countReceived(topic)
+				handler(topic, payload)
+			})
+		}
+	}
+	return nil
+}
+
+// Publish queues the event, it never waits for the handlers
+func (eb *MemoryEventBus) Publish(event Event) error {
+	payloadBytes, err := encodePayload(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if eb.debug {
+		log.Printf("[EventBus] Publish event (%s) : %s\n", event.Type, string(payloadBytes))
+	}
+
+	eb.mu.Lock()
+	if eb.closed {
+		eb.mu.Unlock()
+		return ErrClosed
+	}
+	if DeliveryOf(event.Type).Retained {
+		if len(payloadBytes) == 0 {
+			delete(eb.retained, event.Type)
+		} else {
+			eb.retained[event.Type] = payloadBytes
+		}
+	}
+	var handlers []func(topic EventType, payload []byte)
+	for _, s := range eb.subscriptions {
+		if topicMatches(s.filter, string(event.Type)) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	eb.dispatcher.push(func() {
+		for _, handler := range handlers {
+			eb.countReceived(event.Type)
+			handler(event.Type, payloadBytes)
+		}
+	})
+	eb.mu.Unlock()
+
+	eb.countPublished(event.Type)
+	return nil
+}
+
+// Close delivers the events already published then stops
+func (eb *MemoryEventBus) Close() {
+	eb.mu.Lock()
+	eb.closed = true
+	eb.mu.Unlock()
+	eb.dispatcher.close()
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	N int `json:"n"`
+}
+
+func TestMemoryEventBusDeliversInOrder(t *testing.T) {
+	eb := NewMemoryEventBus()
+	defer eb.Close()
+
+	received := make(chan int, 10)
+	if err := Subscribe(eb, "test/numbers", func(p testPayload) { received <- p.N }); err != nil {
+		t.Fatal(err)
+	}
+	// A handler may publish, delivery does not wait for it
+	if err := Subscribe(eb, "test/numbers", func(p testPayload) {
+		if p.N == 1 {
+			eb.Publish(Event{Type: "test/numbers", Payload: testPayload{N: 3}})
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{1, 2} {
+		if err := eb.Publish(Event{Type: "test/numbers", Payload: testPayload{N: n}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []int{1, 2, 3} {
+		select {
+		case n := <-received:
+			if n != expected {
+				t.Fatalf("Expected %d, received %d", expected, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Event %d not delivered", expected)
+		}
+	}
+
+	stats := eb.Stats()["test/numbers"]
+	if stats.Published != 3 || stats.Received != 6 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMemoryEventBusClose(t *testing.T) {
+	eb := NewMemoryEventBus()
+	received := make(chan struct{}, 1)
+	Subscribe(eb, "test/close", func(testPayload) { received <- struct{}{} })
+	eb.Publish(Event{Type: "test/close", Payload: testPayload{}})
+	eb.Close()
+
+	// Events published before closing are still delivered
+	select {
+	case <-received:
+	default:
+		t.Fatal("Event published before Close was dropped")
+	}
+	if err := eb.Publish(Event{Type: "test/close"}); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"gohome/parsed_data", "gohome/parsed_data", true},
+		{"gohome/plugin/stop/+", "gohome/plugin/stop/homekit", true},
+		{"gohome/plugin/+", "gohome/plugin/stop/homekit", false},
+		{"gohome/#", "gohome/plugin/stop/homekit", true},
+		{"gohome/device/register/a", "gohome/device/register/ab", false},
+		{"gohome/plugin/ack/x", "gohome/plugin/ack", false},
+	}
+	for _, test := range tests {
+		if topicMatches(test.filter, test.topic) != test.match {
+			t.Fatalf("topicMatches(%q, %q) should be %v", test.filter, test.topic, test.match)
+		}
+	}
+}
+
+func TestMemoryEventBusRetainsState(t *testing.T) {
+	eb := NewMemoryEventBus()
+	defer eb.Close()
+
+	eb.Publish(Event{Type: PluginState("a"), Payload: testPayload{N: 1}})
+	eb.Publish(Event{Type: PluginState("b"), Payload: testPayload{N: 2}})
+	eb.Publish(Event{Type: PluginState("b")})
+
+	// Only the state of a is still retained
+	received := make(chan int, 10)
+	Subscribe(eb, PluginState("+"), func(p testPayload) { received <- p.N })
+	select {
+	case n := <-received:
+		if n != 1 {
+			t.Fatalf("Received the state %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Retained state not delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(received) != 0 {
+		t.Fatal("A cleared state was delivered")
+	}
+}
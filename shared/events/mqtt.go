@@ -0,0 +1,249 @@
+package events
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Bastien2203/go-home/shared/config"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// publishTimeout bounds the wait for the broker ack, an event not acked in time stays queued by the client
+const publishTimeout = 5 * time.Second
+
+// MQTTEventBus keeps a persistent session under its client id and reconnects on its own. The subscriptions
+// are made again on each reconnection, a broker restarted without its persistence has forgotten them.
+type MQTTEventBus struct {
+	topicCounters
+	client     mqtt.Client
+	debug      bool
+	dispatcher *dispatcher
+
+	mu            sync.Mutex
+	subscriptions []mqttSubscription
+	connections   int
+	// Retained events published by a client with a will, its will may have cleared them while it was away
+	retained map[EventType][]byte
+}
+
+type mqttSubscription struct {
+	filter  string
+	handler func(topic EventType, payload []byte)
+}
+
+// MQTTOption configures the client of the MQTT event bus
+type MQTTOption func(*mqttOptions)
+
+type mqttOptions struct {
+	will *Event
+}
+
+// WithWill has the broker publish the event when the client goes away without disconnecting, a crash or a
+// lost connection. An event without payload clears a retained event.
+func WithWill(event Event) MQTTOption {
+	return func(o *mqttOptions) { o.will = &event }
+}
+
+func NewMQTTEventBus(conn config.BrokerConnection, clientID string, options ...MQTTOption) (*MQTTEventBus, error) {
+	var o mqttOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(conn.BrokerUrl)
+	opts.SetClientID(clientID)
+	// Credentials in the url take precedence
+	opts.SetUsername(conn.BrokerUsername)
+	opts.SetPassword(conn.BrokerPassword)
+	if conn.BrokerCAFile != "" || conn.BrokerCertFile != "" {
+		tlsConfig, err := tlsConfig(conn)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetPingTimeout(1 * time.Second)
+	// The broker keeps the subscriptions and the QoS 1 events while the client is away
+	opts.SetCleanSession(false)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(10 * time.Second)
+	if o.will != nil {
+		payload, err := encodePayload(*o.will)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the will: %w", err)
+		}
+		delivery := DeliveryOf(o.will.Type)
+		opts.SetBinaryWill(string(o.will.Type), payload, delivery.QoS, delivery.Retained)
+	}
+
+	eb := &MQTTEventBus{debug: config.IsDebug(), dispatcher: newDispatcher()}
+	if o.will != nil {
+		eb.retained = make(map[EventType][]byte)
+	}
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		log.Println("[EventBus] connected to the mqtt broker")
+		eb.resubscribe(c)
+		eb.republish(c)
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Println("[EventBus] connection to mqtt broker lost")
+	})
+
+	eb.client = mqtt.NewClient(opts)
+	if token := eb.client.Connect(); token.Wait() && token.Error() != nil {
+		eb.dispatcher.close()
+		return nil, token.Error()
+	}
+	return eb, nil
+}
+
+func tlsConfig(conn config.BrokerConnection) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conn.BrokerCAFile != "" {
+		pem, err := os.ReadFile(conn.BrokerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the broker CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", conn.BrokerCAFile)
+		}
+	}
+	if conn.BrokerCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conn.BrokerCertFile, conn.BrokerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the broker client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// SubscribeRaw adds a handler to the filter, the filter is subscribed once whatever the number of handlers.
+// A subscription that failed is still made again on the next reconnection.
+func (eb *MQTTEventBus) SubscribeRaw(eventType EventType, handler func(topic EventType, payload []byte)) error {
+	filter := string(eventType)
+
+	eb.mu.Lock()
+	subscribed := slices.ContainsFunc(eb.subscriptions, func(s mqttSubscription) bool { return s.filter == filter })
+	eb.subscriptions = append(eb.subscriptions, mqttSubscription{filter: filter, handler: handler})
+	eb.mu.Unlock()
+
+	if subscribed {
+		return nil
+	}
+	return eb.subscribe(eb.client, filter)
+}
+
+func (eb *MQTTEventBus) subscribe(client mqtt.Client, filter string) error {
+	token := client.Subscribe(filter, DeliveryOf(EventType(filter)).QoS, func(_ mqtt.Client, msg mqtt.Message) {
+		topic, payload := EventType(msg.Topic()), msg.Payload()
+		eb.dispatcher.push(func() { eb.deliver(filter, topic, payload) })
+	})
+	token.Wait()
+	return token.Error()
+}
+
+func (eb *MQTTEventBus) deliver(filter string, topic EventType, payload []byte) {
+	eb.mu.Lock()
+	var handlers []func(topic EventType, payload []byte)
+	for _, s := range eb.subscriptions {
+		if s.filter == filter {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	eb.mu.Unlock()
+
+	for _, handler := range handlers {
+		eb.countReceived(topic)
+		handler(topic, payload)
+	}
+}
+
+func (eb *MQTTEventBus) resubscribe(client mqtt.Client) {
+	eb.mu.Lock()
+	eb.connections++
+	if eb.connections == 1 {
+		// SubscribeRaw subscribes during the first connection
+		eb.mu.Unlock()
+		return
+	}
+	var filters []string
+	for _, s := range eb.subscriptions {
+		if !slices.Contains(filters, s.filter) {
+			filters = append(filters, s.filter)
+		}
+	}
+	eb.mu.Unlock()
+
+	for _, filter := range filters {
+		if err := eb.subscribe(client, filter); err != nil {
+			log.Printf("[EventBus] Failed to subscribe again to %s: %v", filter, err)
+		}
+	}
+}
+
+// republish sends the retained events again after a reconnection, the broker published the will when the
+// connection was lost
+func (eb *MQTTEventBus) republish(client mqtt.Client) {
+	eb.mu.Lock()
+	if eb.connections == 1 || len(eb.retained) == 0 {
+		eb.mu.Unlock()
+		return
+	}
+	retained := maps.Clone(eb.retained)
+	eb.mu.Unlock()
+
+	for eventType, payload := range retained {
+		token := client.Publish(string(eventType), DeliveryOf(eventType).QoS, true, payload)
+		if !token.WaitTimeout(publishTimeout) || token.Error() != nil {
+			log.Printf("[EventBus] Failed to publish %s again: %v", eventType, token.Error())
+		}
+	}
+}
+
+func (eb *MQTTEventBus) Publish(event Event) error {
+	payloadBytes, err := encodePayload(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if eb.debug {
+		log.Printf("[EventBus] Publish event (%s) : %s\n", event.Type, string(payloadBytes))
+	}
+
+	delivery := DeliveryOf(event.Type)
+	eb.mu.Lock()
+	if delivery.Retained && eb.retained != nil {
+		if len(payloadBytes) == 0 {
+			delete(eb.retained, event.Type)
+		} else {
+			eb.retained[event.Type] = payloadBytes
+		}
+	}
+	eb.mu.Unlock()
+	token := eb.client.Publish(string(event.Type), delivery.QoS, delivery.Retained, payloadBytes)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("%s not acked by the broker, it is sent again on reconnection", event.Type)
+	}
+	if token.Error() == nil {
+		eb.countPublished(event.Type)
+	}
+
+	return token.Error()
+}
+
+// Close delivers the events already received then stops
+func (eb *MQTTEventBus) Close() {
+	eb.client.Disconnect(250)
+	eb.dispatcher.close()
+}
@@ -0,0 +1,244 @@
+package events_test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bastien2203/go-home/internal/broker"
+	"github.com/Bastien2203/go-home/shared/config"
+	"github.com/Bastien2203/go-home/shared/events"
+	"github.com/Bastien2203/go-home/shared/plugin"
+	"github.com/Bastien2203/go-home/shared/types"
+)
+
+func startBroker(t *testing.T, address string) *broker.Broker {
+	t.Helper()
+	b, err := broker.Start(broker.Options{Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func connect(t *testing.T, url, clientID string) *events.MQTTEventBus {
+	t.Helper()
+	eb, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: url}, clientID)
+	if err != nil {
+		t.Fatalf("%s failed to connect %v", clientID, err)
+	}
+	t.Cleanup(eb.Close)
+	return eb
+}
+
+func receive[T any](t *testing.T, ch <-chan T, timeout time.Duration) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(timeout):
+		t.Fatal("Event not delivered through the broker")
+	}
+	var zero T
+	return zero
+}
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestMQTTEventBusResubscribesAfterReconnect(t *testing.T) {
+	address := freeAddress(t)
+	b := startBroker(t, address)
+	subscriber := connect(t, b.URL(), "subscriber")
+
+	// Both handlers of the filter are called
+	received := make(chan int, 10)
+	for range 2 {
+		if err := events.Subscribe(subscriber, "test/numbers", func(p struct{ N int }) { received <- p.N }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The restarted broker has no persistence, it forgot the subscriptions of the session
+	b.Close()
+	b = startBroker(t, address)
+	defer b.Close()
+	publisher := connect(t, b.URL(), "publisher")
+
+	deadline := time.Now().Add(15 * time.Second)
+	for len(received) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("The subscriptions were not made again after the reconnection")
+		}
+		if err := publisher.Publish(events.Event{Type: "test/numbers", Payload: struct{ N int }{1}}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if stats := subscriber.Stats()["test/numbers"]; stats.Received < 2 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMQTTEventBusRetainsPluginState(t *testing.T) {
+	b := startBroker(t, "127.0.0.1:0")
+	defer b.Close()
+	url := b.URL()
+
+	pluginBus := connect(t, url, "zigbee")
+	client := plugin.NewPluginClient(&plugin.Plugin{ID: "zigbee", Type: plugin.PluginScanner}, pluginBus)
+	client.EmitNewState(types.StateRunning)
+
+	// A core started after the plugin learns it from the retained state
+	states := make(chan plugin.Plugin, 10)
+	coreBus := connect(t, url, "core")
+	if err := events.Subscribe(coreBus, events.PluginState("+"), func(p plugin.Plugin) { states <- p }); err != nil {
+		t.Fatal(err)
+	}
+	if p := receive(t, states, 2*time.Second); p.ID != "zigbee" || p.State != types.StateRunning {
+		t.Fatalf("Received %+v", p)
+	}
+
+	// Once cleared, the state is not handed to new subscribers
+	if err := pluginBus.Publish(events.Event{Type: events.PluginState("zigbee")}); err != nil {
+		t.Fatal(err)
+	}
+	late := connect(t, url, "late")
+	events.Subscribe(late, events.PluginState("+"), func(p plugin.Plugin) { states <- p })
+	time.Sleep(200 * time.Millisecond)
+	if len(states) != 0 {
+		t.Fatalf("A cleared state was delivered %+v", <-states)
+	}
+}
+
+// The will of a plugin that crashed clears its retained state, a later subscriber does not learn it
+func TestMQTTEventBusWillClearsPluginState(t *testing.T) {
+	b := startBroker(t, "127.0.0.1:0")
+	defer b.Close()
+
+	proxy := startProxy(t, strings.TrimPrefix(b.URL(), "tcp://"))
+	pluginBus, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: "tcp://" + proxy.address}, "zigbee", plugin.StateWill("zigbee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pluginBus.Close)
+	client := plugin.NewPluginClient(&plugin.Plugin{ID: "zigbee", Type: plugin.PluginScanner}, pluginBus)
+	client.EmitNewState(types.StateRunning)
+
+	payloads := make(chan []byte, 10)
+	coreBus := connect(t, b.URL(), "core")
+	if err := coreBus.SubscribeRaw(events.PluginState("+"), func(_ events.EventType, payload []byte) { payloads <- payload }); err != nil {
+		t.Fatal(err)
+	}
+	if payload := receive(t, payloads, 2*time.Second); len(payload) == 0 {
+		t.Fatal("The state was not retained")
+	}
+
+	// The connection drops without a disconnect packet
+	proxy.close()
+	if payload := receive(t, payloads, 2*time.Second); len(payload) != 0 {
+		t.Fatalf("Received %s instead of the will", payload)
+	}
+
+	states := make(chan plugin.Plugin, 10)
+	late := connect(t, b.URL(), "late")
+	events.Subscribe(late, events.PluginState("+"), func(p plugin.Plugin) { states <- p })
+	time.Sleep(200 * time.Millisecond)
+	if len(states) != 0 {
+		t.Fatalf("The state of a crashed plugin was delivered %+v", <-states)
+	}
+}
+
+// A plugin that lost its connection publishes its state again once reconnected, its will had cleared it
+func TestMQTTEventBusRepublishesStateAfterReconnect(t *testing.T) {
+	b := startBroker(t, "127.0.0.1:0")
+	defer b.Close()
+
+	proxy := startProxy(t, strings.TrimPrefix(b.URL(), "tcp://"))
+	pluginBus, err := events.NewMQTTEventBus(config.BrokerConnection{BrokerUrl: "tcp://" + proxy.address}, "zigbee", plugin.StateWill("zigbee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pluginBus.Close)
+	client := plugin.NewPluginClient(&plugin.Plugin{ID: "zigbee", Type: plugin.PluginScanner}, pluginBus)
+	client.EmitNewState(types.StateRunning)
+
+	payloads := make(chan []byte, 10)
+	coreBus := connect(t, b.URL(), "core")
+	if err := coreBus.SubscribeRaw(events.PluginState("+"), func(_ events.EventType, payload []byte) { payloads <- payload }); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, payloads, 2*time.Second)
+
+	// The proxy keeps listening, the plugin reconnects through it
+	proxy.drop()
+	if payload := receive(t, payloads, 2*time.Second); len(payload) != 0 {
+		t.Fatalf("Received %s instead of the will", payload)
+	}
+	if payload := receive(t, payloads, 15*time.Second); len(payload) == 0 {
+		t.Fatal("The state was not published again")
+	}
+}
+
+// proxy forwards the connections to the broker until it is closed, the way a crashed process drops them
+type proxy struct {
+	address  string
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startProxy(t *testing.T, target string) *proxy {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &proxy{address: l.Addr().String(), listener: l}
+	t.Cleanup(p.close)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, conn, upstream)
+			p.mu.Unlock()
+			go io.Copy(upstream, conn)
+			go io.Copy(conn, upstream)
+		}
+	}()
+	return p
+}
+
+func (p *proxy) close() {
+	p.listener.Close()
+	p.drop()
+}
+
+// drop cuts the open connections, new ones are still accepted
+func (p *proxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
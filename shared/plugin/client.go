@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/Bastien2203/go-home/shared/events"
@@ -11,13 +12,14 @@ import (
 )
 
 type PluginClient struct {
+	mu             sync.Mutex
 	pluginInstance *Plugin
-	eventBus       *events.EventBus
+	eventBus       events.EventBus
 	onStart        func() error
 	onStop         func() error
 }
 
-func NewPluginClient(instance *Plugin, eventBus *events.EventBus) *PluginClient {
+func NewPluginClient(instance *Plugin, eventBus events.EventBus) *PluginClient {
 	client := &PluginClient{
 		eventBus:       eventBus,
 		pluginInstance: instance,
@@ -26,6 +28,12 @@ func NewPluginClient(instance *Plugin, eventBus *events.EventBus) *PluginClient
 	return client
 }
 
+// StateWill is the event bus option of a plugin, the broker clears the retained state of a plugin that went
+// away without a clean shutdown
+func StateWill(id string) events.MQTTOption {
+	return events.WithWill(events.Event{Type: events.PluginState(id)})
+}
+
 func (m *PluginClient) subscribeToEvents() error {
 	if err := events.Subscribe(m.eventBus, events.PluginStop(m.pluginInstance.ID), m.onPluginStop); err != nil {
 		return err
@@ -48,6 +56,9 @@ func (c *PluginClient) RunPlugin(onStart func() error, onStop func() error) {
 		Type:    events.PluginConnected,
 		Payload: c.pluginInstance,
 	})
+	c.mu.Lock()
+	c.publishState()
+	c.mu.Unlock()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -57,12 +68,28 @@ func (c *PluginClient) RunPlugin(onStart func() error, onStop func() error) {
 		Type:    events.PluginDisconnected,
 		Payload: c.pluginInstance,
 	})
+	c.eventBus.Publish(events.Event{Type: events.PluginState(c.pluginInstance.ID)})
 }
 
 func (c *PluginClient) EmitNewState(s types.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.pluginInstance.State = s
+	c.publishState()
+}
+
+// Status is visible through the core api, with the plugin state
+func (c *PluginClient) EmitStatus(status map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pluginInstance.Status = status
+	c.publishState()
+}
+
+// publishState retains the plugin on its state topic, must be called with mu held
+func (c *PluginClient) publishState() {
 	c.eventBus.Publish(events.Event{
-		Type:    events.PluginStateChanged,
+		Type:    events.PluginState(c.pluginInstance.ID),
 		Payload: c.pluginInstance,
 	})
 }
@@ -7,6 +7,8 @@ type Plugin struct {
 	Name  string      `json:"name"`
 	Type  PluginType  `json:"type"`
 	State types.State `json:"state"`
+	// Free form details reported by the plugin (counters, errors, ...)
+	Status map[string]any `json:"status,omitempty"`
 }
 
 type PluginType string
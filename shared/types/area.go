@@ -0,0 +1,27 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Area is where devices live (a room, a floor, the garden, ...). Areas can be nested,
+// e.g. rooms in a floor, and a device belongs to at most one area.
+type Area struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parent_id"` // empty for top level areas
+	Icon      string    `json:"icon"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewArea(name, parentID, icon string) *Area {
+	return &Area{
+		ID:        uuid.New().String(),
+		Name:      name,
+		ParentID:  parentID,
+		Icon:      icon,
+		CreatedAt: time.Now(),
+	}
+}
@@ -25,6 +25,7 @@ type DeviceStateUpdate struct {
 	CapabilityType CapabilityType `json:"capability_type"`
 	Timestamp      time.Time      `json:"timestamp"`
 	Value          any            `json:"value"`
+	Unit           Unit           `json:"unit,omitempty"`
 }
 
 type Device struct {
@@ -36,6 +37,19 @@ type Device struct {
 	CreatedAt    time.Time                      `json:"created_at"`
 	Capabilities map[CapabilityType]*Capability `json:"capabilities"`
 	LastUpdated  time.Time                      `json:"last_updated"`
+	// Set by the core, true while the device keeps sending data
+	Available bool `json:"available"`
+
+	AreaID string `json:"area_id"`
+	// Name of the area, set by the core
+	Area string `json:"area"`
+
+	// Metadata edited by the user
+	Icon         string   `json:"icon"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	Notes        string   `json:"notes"`
+	Tags         []string `json:"tags"`
 }
 
 func NewDevice(address, name string, adapterIDs []string, addressType AddressType) *Device {
@@ -48,6 +62,7 @@ func NewDevice(address, name string, adapterIDs []string, addressType AddressTyp
 		CreatedAt:    time.Now(),
 		Capabilities: make(map[CapabilityType]*Capability),
 		LastUpdated:  time.Now(),
+		Tags:         []string{},
 	}
 }
 